@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	rdb "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+	"github.com/case-framework/recruitment-list-backend/pkg/sync"
+)
+
+const (
+	PHASE_ALL          = "all"
+	PHASE_PARTICIPANTS = "participants"
+	PHASE_DATA         = "data"
+
+	PHASE_STATUS_SUCCESS     = "success"
+	PHASE_STATUS_FAILED      = "failed"
+	PHASE_STATUS_PLANNED     = "planned"
+	PHASE_STATUS_INTERRUPTED = "interrupted"
+
+	EXIT_CODE_FAILED = 1
+	EXIT_CODE_USAGE  = 2
+)
+
+type CliOptions struct {
+	ListIDs    []string
+	Tags       []string
+	Phase      string
+	FullResync bool
+	DryRun     bool
+	// path of the JSON summary file, "-" for stdout
+	SummaryPath string
+	// run a single batch sync, even if the scheduler or change stream mode is configured
+	Once bool
+}
+
+type SyncSummary struct {
+	StartedAt  time.Time         `json:"startedAt"`
+	FinishedAt time.Time         `json:"finishedAt"`
+	DryRun     bool              `json:"dryRun"`
+	FullResync bool              `json:"fullResync"`
+	Lists      []ListSyncSummary `json:"lists"`
+	Failed     int               `json:"failed"`
+}
+
+type ListSyncSummary struct {
+	ID           string        `json:"id"`
+	Name         string        `json:"name"`
+	Participants *PhaseSummary `json:"participants,omitempty"`
+	Data         *PhaseSummary `json:"data,omitempty"`
+}
+
+type PhaseSummary struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration,omitempty"`
+	// data phase only
+	Stats *rdb.DataSyncStats `json:"stats,omitempty"`
+}
+
+func parseCliOptions() (CliOptions, error) {
+	var (
+		opts    CliOptions
+		listIDs string
+		tags    string
+	)
+
+	flag.StringVar(&listIDs, "lists", "", "comma separated IDs of the recruitment lists to sync (default: all lists)")
+	flag.StringVar(&tags, "tags", "", "comma separated tags, only lists with at least one of the tags are synced")
+	flag.StringVar(&opts.Phase, "phase", PHASE_ALL, "sync phase to run: all, participants or data")
+	flag.BoolVar(&opts.FullResync, "full-resync", false, "ignore the last data sync time and fetch all participant data and responses again")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "only print which lists and phases would be synced, without changing anything")
+	flag.StringVar(&opts.SummaryPath, "summary", "", "write a JSON summary of the run to this file, \"-\" for stdout (mixed with the log output if logging to stdout)")
+	flag.BoolVar(&opts.Once, "once", false, "run a single batch sync, even if scheduler or change stream mode is configured")
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		return opts, fmt.Errorf("unexpected arguments: %s", strings.Join(flag.Args(), " "))
+	}
+
+	opts.ListIDs = splitFlagValues(listIDs)
+	opts.Tags = splitFlagValues(tags)
+
+	if !slices.Contains([]string{PHASE_ALL, PHASE_PARTICIPANTS, PHASE_DATA}, opts.Phase) {
+		return opts, fmt.Errorf("unknown phase: %s", opts.Phase)
+	}
+	if opts.FullResync && opts.Phase == PHASE_PARTICIPANTS {
+		return opts, fmt.Errorf("full-resync can only be used with the data phase")
+	}
+	return opts, nil
+}
+
+// isBatchOnly returns true if a flag was given that only applies to a single batch run
+func (opts CliOptions) isBatchOnly() bool {
+	return opts.Once || len(opts.ListIDs) > 0 || len(opts.Tags) > 0 || opts.Phase != PHASE_ALL ||
+		opts.FullResync || opts.DryRun || opts.SummaryPath != ""
+}
+
+func (opts CliOptions) runParticipantSync() bool {
+	return opts.Phase == PHASE_ALL || opts.Phase == PHASE_PARTICIPANTS
+}
+
+func (opts CliOptions) runDataSync() bool {
+	return opts.Phase == PHASE_ALL || opts.Phase == PHASE_DATA
+}
+
+// selectLists filters the recruitment lists by the IDs and tags given on the command line
+func (opts CliOptions) selectLists(lists []rdb.RecruitmentList) ([]rdb.RecruitmentList, error) {
+	for _, id := range opts.ListIDs {
+		if !slices.ContainsFunc(lists, func(rl rdb.RecruitmentList) bool { return rl.ID.Hex() == id }) {
+			return nil, fmt.Errorf("recruitment list not found: %s", id)
+		}
+	}
+
+	selected := []rdb.RecruitmentList{}
+	for _, rl := range lists {
+		if len(opts.ListIDs) > 0 && !slices.Contains(opts.ListIDs, rl.ID.Hex()) {
+			continue
+		}
+		if len(opts.Tags) > 0 && !slices.ContainsFunc(rl.Tags, func(tag string) bool { return slices.Contains(opts.Tags, tag) }) {
+			continue
+		}
+		selected = append(selected, rl)
+	}
+	return selected, nil
+}
+
+func splitFlagValues(value string) []string {
+	values := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func newPhaseSummary(startedAt time.Time, err error) *PhaseSummary {
+	summary := &PhaseSummary{
+		Status:   PHASE_STATUS_SUCCESS,
+		Duration: time.Since(startedAt).Round(time.Millisecond).String(),
+	}
+	if errors.Is(err, sync.ErrSyncInterrupted) {
+		summary.Status = PHASE_STATUS_INTERRUPTED
+	} else if err != nil {
+		summary.Status = PHASE_STATUS_FAILED
+		summary.Error = err.Error()
+	}
+	return summary
+}
+
+func (summary *SyncSummary) countFailed() {
+	summary.Failed = 0
+	for _, l := range summary.Lists {
+		for _, phase := range []*PhaseSummary{l.Participants, l.Data} {
+			if phase != nil && (phase.Status == PHASE_STATUS_FAILED || phase.Status == PHASE_STATUS_INTERRUPTED) {
+				summary.Failed++
+			}
+		}
+	}
+}
+
+func (summary *SyncSummary) write(path string) error {
+	out := os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(summary)
+}
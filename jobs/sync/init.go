@@ -45,6 +45,29 @@ type RecruitmentListApiConfig struct {
 		StudyDB           db.DBConfigYaml `json:"study_db" yaml:"study_db"`
 	} `json:"db_configs" yaml:"db_configs"`
 
+	SyncConfig struct {
+		DataSyncWorkers int `json:"data_sync_workers" yaml:"data_sync_workers"`
+		// running syncs without heartbeat for this long are treated as interrupted on startup
+		StaleSyncTimeout time.Duration `json:"stale_sync_timeout" yaml:"stale_sync_timeout"`
+
+		// Keep running and apply changes of the study DB as they happen, instead of a single batch run
+		ChangeStream struct {
+			Enabled         bool          `json:"enabled" yaml:"enabled"`
+			RefreshInterval time.Duration `json:"refresh_interval" yaml:"refresh_interval"`
+		} `json:"change_stream" yaml:"change_stream"`
+
+		// Keep running and sync each list according to its schedule, instead of a single batch run
+		Scheduler struct {
+			Enabled         bool `json:"enabled" yaml:"enabled"`
+			DefaultSchedule struct {
+				Cron     string `json:"cron" yaml:"cron"`
+				Interval string `json:"interval" yaml:"interval"`
+			} `json:"default_schedule" yaml:"default_schedule"`
+			MaxJitter     time.Duration `json:"max_jitter" yaml:"max_jitter"`
+			CheckInterval time.Duration `json:"check_interval" yaml:"check_interval"`
+		} `json:"scheduler" yaml:"scheduler"`
+	} `json:"sync_config" yaml:"sync_config"`
+
 	SmtpBridgeConfig *struct {
 		URL            string        `json:"url" yaml:"url"`
 		APIKey         string        `json:"api_key" yaml:"api_key"`
@@ -89,6 +112,14 @@ func init() {
 	// Init DBs
 	initDBs()
 
+	if conf.SyncConfig.DataSyncWorkers > 0 {
+		sync.DataSyncWorkers = conf.SyncConfig.DataSyncWorkers
+	}
+
+	if conf.SyncConfig.StaleSyncTimeout > 0 {
+		sync.StaleSyncTimeout = conf.SyncConfig.StaleSyncTimeout
+	}
+
 	if conf.SmtpBridgeConfig != nil && conf.SmtpBridgeConfig.URL != "" {
 		slog.Info("SMTP bridge configured, will send emails to researchers")
 		sync.HttpClient = loadEmailClientHTTPConfig()
@@ -1,48 +1,245 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	rdb "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
 	"github.com/case-framework/recruitment-list-backend/pkg/sync"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultChangeStreamRefreshInterval = 5 * time.Minute
+	defaultSchedulerCheckInterval      = time.Minute
 )
 
 func main() {
-	slog.Info("Sync job started")
+	opts, err := parseCliOptions()
+	if err != nil {
+		slog.Error("invalid command line options", slog.String("error", err.Error()))
+		os.Exit(EXIT_CODE_USAGE)
+	}
+
+	// on SIGINT/SIGTERM the participants being synced are finished and the sync is marked as interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if !opts.DryRun {
+		// syncs of a killed previous run are resumed by the next sync of the list
+		if err := sync.RecoverStaleSyncs(recruitmentListDBService); err != nil {
+			slog.Error("could not recover stale syncs", slog.String("error", err.Error()))
+		}
+	}
+
+	if !opts.isBatchOnly() {
+		if conf.SyncConfig.ChangeStream.Enabled {
+			runChangeStreamSync(ctx)
+			return
+		}
+
+		if conf.SyncConfig.Scheduler.Enabled {
+			runScheduler(ctx)
+			return
+		}
+	}
+
+	summary, err := runBatchSync(ctx, opts)
+	if err != nil {
+		slog.Error("sync job failed", slog.String("error", err.Error()))
+		os.Exit(EXIT_CODE_FAILED)
+	}
+
+	if opts.SummaryPath != "" {
+		if err := summary.write(opts.SummaryPath); err != nil {
+			slog.Error("could not write summary", slog.String("error", err.Error()))
+			os.Exit(EXIT_CODE_FAILED)
+		}
+	}
+
+	if summary.Failed > 0 {
+		stop()
+		os.Exit(EXIT_CODE_FAILED)
+	}
+}
+
+func runBatchSync(ctx context.Context, opts CliOptions) (*SyncSummary, error) {
+	slog.Info("Sync job started", slog.String("phase", opts.Phase), slog.Bool("dryRun", opts.DryRun), slog.Bool("fullResync", opts.FullResync))
+
+	summary := &SyncSummary{
+		StartedAt:  time.Now(),
+		DryRun:     opts.DryRun,
+		FullResync: opts.FullResync,
+		Lists:      []ListSyncSummary{},
+	}
 
 	rls, err := recruitmentListDBService.GetRecruitmentListsInfos()
 	if err != nil {
 		slog.Error("could not retrieve recruitment lists", slog.String("error", err.Error()))
-		return
+		return nil, err
+	}
+
+	rls, err = opts.selectLists(rls)
+	if err != nil {
+		return nil, err
 	}
 
 	for _, rl := range rls {
+		if ctx.Err() != nil {
+			slog.Warn("sync job interrupted, skipping remaining lists")
+			break
+		}
+
+		listSummary := ListSyncSummary{
+			ID:   rl.ID.Hex(),
+			Name: rl.Name,
+		}
+
+		if opts.DryRun {
+			slog.Info("would sync recruitment list", slog.String("id", rl.ID.Hex()), slog.String("name", rl.Name))
+			if opts.runParticipantSync() {
+				listSummary.Participants = &PhaseSummary{Status: PHASE_STATUS_PLANNED}
+			}
+			if opts.runDataSync() && ctx.Err() == nil {
+				listSummary.Data = &PhaseSummary{Status: PHASE_STATUS_PLANNED}
+			}
+			summary.Lists = append(summary.Lists, listSummary)
+			continue
+		}
+
 		slog.Info("start sync for recruitment list", slog.String("id", rl.ID.Hex()), slog.String("name", rl.Name))
 
 		// sync participants
-		if err := sync.SyncParticipantsForRL(
-			recruitmentListDBService,
-			studyDBService,
-			rl.ID.Hex(),
-			conf.StudyServicesConnection.InstanceID,
-		); err != nil {
-			slog.Error("could not sync participants", slog.String("id", rl.ID.Hex()), slog.String("name", rl.Name), slog.String("error", err.Error()))
-		} else {
-			slog.Info("participant sync finished", slog.String("id", rl.ID.Hex()), slog.String("name", rl.Name))
+		if opts.runParticipantSync() {
+			startedAt := time.Now()
+			err := sync.SyncParticipantsForRL(
+				ctx,
+				recruitmentListDBService,
+				studyDBService,
+				rl.ID.Hex(),
+				conf.StudyServicesConnection.InstanceID,
+			)
+			if err != nil {
+				slog.Error("could not sync participants", slog.String("id", rl.ID.Hex()), slog.String("name", rl.Name), slog.String("error", err.Error()))
+			} else {
+				slog.Info("participant sync finished", slog.String("id", rl.ID.Hex()), slog.String("name", rl.Name))
+			}
+			listSummary.Participants = newPhaseSummary(startedAt, err)
 		}
 
 		// sync responses
-		if err := sync.SyncResearchDataForRL(
-			recruitmentListDBService,
-			studyDBService,
-			rl.ID.Hex(),
-			conf.StudyServicesConnection.InstanceID,
-			conf.StudyServicesConnection.GlobalSecret,
-		); err != nil {
-			slog.Error("could not sync research data", slog.String("id", rl.ID.Hex()), slog.String("name", rl.Name), slog.String("error", err.Error()))
-		} else {
-			slog.Info("response sync finished", slog.String("id", rl.ID.Hex()), slog.String("name", rl.Name))
+		if opts.runDataSync() && ctx.Err() == nil {
+			startedAt := time.Now()
+			err := resetDataSyncTimeForFullResync(rl.ID.Hex(), opts)
+			if err == nil {
+				err = sync.SyncResearchDataForRL(
+					ctx,
+					recruitmentListDBService,
+					studyDBService,
+					rl.ID.Hex(),
+					conf.StudyServicesConnection.InstanceID,
+					conf.StudyServicesConnection.GlobalSecret,
+				)
+			}
+			if err != nil {
+				slog.Error("could not sync research data", slog.String("id", rl.ID.Hex()), slog.String("name", rl.Name), slog.String("error", err.Error()))
+			} else {
+				slog.Info("response sync finished", slog.String("id", rl.ID.Hex()), slog.String("name", rl.Name))
+			}
+			listSummary.Data = newPhaseSummary(startedAt, err)
+			if syncInfo, err := recruitmentListDBService.GetSyncInfoByRLID(rl.ID.Hex()); err == nil {
+				listSummary.Data.Stats = syncInfo.DataSyncStats
+			}
 		}
+
+		summary.Lists = append(summary.Lists, listSummary)
+	}
+
+	summary.FinishedAt = time.Now()
+	summary.countFailed()
+
+	slog.Info("Sync job finished", slog.Int("lists", len(summary.Lists)), slog.Int("failed", summary.Failed))
+	return summary, nil
+}
+
+// resetDataSyncTimeForFullResync removes the last data sync time and the participants' sync state,
+// so the data sync fetches everything again
+func resetDataSyncTimeForFullResync(rlID string, opts CliOptions) error {
+	if !opts.FullResync {
+		return nil
+	}
+
+	syncInfo, err := recruitmentListDBService.GetSyncInfoByRLID(rlID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// never synced, nothing to reset
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if syncInfo.DataSyncStatus == rdb.SYNC_STATUS_RUNNING {
+		return errors.New("data sync is currently running, cannot force full resync")
+	}
+	if err := recruitmentListDBService.ResetParticipantsDataSync(rlID); err != nil {
+		return err
 	}
+	return recruitmentListDBService.ResetDataSyncTime(rlID)
+}
+
+func runChangeStreamSync(ctx context.Context) {
+	slog.Info("Change stream sync started")
+
+	refreshInterval := conf.SyncConfig.ChangeStream.RefreshInterval
+	if refreshInterval <= 0 {
+		refreshInterval = defaultChangeStreamRefreshInterval
+	}
+
+	sync.RunChangeStreamSync(
+		ctx,
+		recruitmentListDBService,
+		studyDBService,
+		conf.StudyServicesConnection.InstanceID,
+		conf.StudyServicesConnection.GlobalSecret,
+		refreshInterval,
+	)
+
+	slog.Info("Change stream sync stopped")
+}
+
+func runScheduler(ctx context.Context) {
+	slog.Info("Sync scheduler started")
+
+	schedulerConf := conf.SyncConfig.Scheduler
+	defaultSchedule := rdb.SyncSchedule{
+		Cron:     schedulerConf.DefaultSchedule.Cron,
+		Interval: schedulerConf.DefaultSchedule.Interval,
+	}
+	if _, err := sync.ParseSyncSchedule(defaultSchedule); err != nil {
+		slog.Error("invalid default schedule", slog.String("error", err.Error()))
+		return
+	}
+
+	checkInterval := schedulerConf.CheckInterval
+	if checkInterval <= 0 {
+		checkInterval = defaultSchedulerCheckInterval
+	}
+
+	sync.RunScheduler(
+		ctx,
+		recruitmentListDBService,
+		studyDBService,
+		conf.StudyServicesConnection.InstanceID,
+		conf.StudyServicesConnection.GlobalSecret,
+		sync.SchedulerConfig{
+			DefaultSchedule: defaultSchedule,
+			MaxJitter:       schedulerConf.MaxJitter,
+			CheckInterval:   checkInterval,
+		},
+	)
 
-	slog.Info("Sync job finished")
+	slog.Info("Sync scheduler stopped")
 }
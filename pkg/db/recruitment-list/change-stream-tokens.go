@@ -0,0 +1,51 @@
+package recruitmentlist
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (dbService *RecruitmentListDBService) collectionChangeStreamTokens() *mongo.Collection {
+	return dbService.DBClient.Database(dbService.getDBName()).Collection(COL_NAME_CHANGE_STREAM_TOKENS)
+}
+
+// ChangeStreamToken stores the resume token of a change stream, so watching can continue after a restart
+type ChangeStreamToken struct {
+	StreamID    string    `json:"streamId,omitempty" bson:"_id,omitempty"`
+	ResumeToken bson.Raw  `json:"resumeToken,omitempty" bson:"resumeToken,omitempty"`
+	UpdatedAt   time.Time `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+func (dbService *RecruitmentListDBService) GetChangeStreamToken(streamID string) (*ChangeStreamToken, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	var token ChangeStreamToken
+	err := dbService.collectionChangeStreamTokens().FindOne(ctx, bson.M{"_id": streamID}).Decode(&token)
+	return &token, err
+}
+
+func (dbService *RecruitmentListDBService) SaveChangeStreamToken(streamID string, resumeToken bson.Raw) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{"_id": streamID}
+	update := bson.M{"$set": bson.M{
+		"resumeToken": resumeToken,
+		"updatedAt":   time.Now(),
+	}}
+	opts := options.Update().SetUpsert(true)
+	_, err := dbService.collectionChangeStreamTokens().UpdateOne(ctx, filter, update, opts)
+	return err
+}
+
+func (dbService *RecruitmentListDBService) DeleteChangeStreamToken(streamID string) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	_, err := dbService.collectionChangeStreamTokens().DeleteOne(ctx, bson.M{"_id": streamID})
+	return err
+}
@@ -21,6 +21,11 @@ const (
 	COL_NAME_PARTICIPANT_NOTES = "participant_notes"
 	COL_NAME_RESEARCH_DATA     = "research_data"
 	COL_NAME_DOWNLOADS         = "downloads"
+
+	COL_NAME_CHANGE_STREAM_TOKENS       = "change_stream_tokens"
+	COL_NAME_PARTICIPANT_INFO_CHANGES   = "participant_info_changes"
+	COL_NAME_PARTICIPANT_VIEWS          = "participant_views"
+	COL_NAME_PARTICIPANT_STATUS_CHANGES = "participant_status_changes"
 )
 
 const (
@@ -122,9 +127,34 @@ func (dbService *RecruitmentListDBService) ensureIndexes() error {
 		slog.Error("Error creating indexes for participants: ", slog.String("error", err.Error()))
 	}
 
+	// create index for participant notes
+	if err := dbService.createIndexesForParticipantNotes(); err != nil {
+		slog.Error("Error creating indexes for participant notes: ", slog.String("error", err.Error()))
+	}
+
 	// create index for research data
 	if err := dbService.createIndexesForResearchData(); err != nil {
 		slog.Error("Error creating indexes for research data: ", slog.String("error", err.Error()))
 	}
+
+	// create index for participant info changes
+	if err := dbService.createIndexesForParticipantInfoChanges(); err != nil {
+		slog.Error("Error creating indexes for participant info changes: ", slog.String("error", err.Error()))
+	}
+
+	// create index for participant status changes
+	if err := dbService.createIndexesForParticipantStatusChanges(); err != nil {
+		slog.Error("Error creating indexes for participant status changes: ", slog.String("error", err.Error()))
+	}
+
+	// create index for participant views
+	if err := dbService.createIndexesForParticipantViews(); err != nil {
+		slog.Error("Error creating indexes for participant views: ", slog.String("error", err.Error()))
+	}
+
+	// create text indexes for participant search
+	if err := dbService.createIndexesForParticipantSearch(); err != nil {
+		slog.Error("Error creating indexes for participant search: ", slog.String("error", err.Error()))
+	}
 	return nil
 }
@@ -15,18 +15,37 @@ const (
 
 	FILE_TYPE_CSV  = "csv"
 	FILE_TYPE_JSON = "json"
+	FILE_TYPE_XLSX = "xlsx"
+	FILE_TYPE_SAV  = "sav"
+	// ZIP with the responses as CSV, a codebook and an R import script
+	FILE_TYPE_CSV_CODEBOOK = "csv-codebook"
+	// ZIP with the responses of several surveys, participant infos, notes, status history and a manifest
+	FILE_TYPE_ZIP = "zip"
+
+	// AES encrypted ZIP with a password chosen for the download
+	DOWNLOAD_ENCRYPTION_PASSWORD = "password"
+	// age encrypted for the public key registered by the researcher
+	DOWNLOAD_ENCRYPTION_PUBLIC_KEY = "publicKey"
 )
 
 type Download struct {
-	ID                primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	RecruitmentListID string             `json:"recruitmentListId,omitempty" bson:"recruitmentListId,omitempty"`
-	FilterInfo        string             `json:"filterInfo,omitempty" bson:"filterInfo,omitempty"`
-	Status            string             `json:"status,omitempty" bson:"status,omitempty"`
-	CreatedAt         time.Time          `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
-	CreatedBy         string             `json:"createdBy,omitempty" bson:"createdBy,omitempty"`
-	FileType          string             `json:"fileType,omitempty" bson:"fileType,omitempty"`
-	FileName          string             `json:"fileName,omitempty" bson:"fileName,omitempty"`
-	Path              string             `json:"path,omitempty" bson:"path,omitempty"`
+	ID                primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	RecruitmentListID string              `json:"recruitmentListId,omitempty" bson:"recruitmentListId,omitempty"`
+	FilterInfo        string              `json:"filterInfo,omitempty" bson:"filterInfo,omitempty"`
+	Status            string              `json:"status,omitempty" bson:"status,omitempty"`
+	CreatedAt         time.Time           `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	CreatedBy         string              `json:"createdBy,omitempty" bson:"createdBy,omitempty"`
+	FileType          string              `json:"fileType,omitempty" bson:"fileType,omitempty"`
+	FileName          string              `json:"fileName,omitempty" bson:"fileName,omitempty"`
+	Path              string              `json:"path,omitempty" bson:"path,omitempty"`
+	Encryption        *DownloadEncryption `json:"encryption,omitempty" bson:"encryption,omitempty"`
+}
+
+type DownloadEncryption struct {
+	// DOWNLOAD_ENCRYPTION_PASSWORD or DOWNLOAD_ENCRYPTION_PUBLIC_KEY, empty if only encrypted at rest
+	Method string `json:"method,omitempty" bson:"method,omitempty"`
+	// the stored file is encrypted with the filestore key and decrypted when served
+	AtRest bool `json:"atRest,omitempty" bson:"atRest,omitempty"`
 }
 
 func (dbService *RecruitmentListDBService) collectionDownloads() *mongo.Collection {
@@ -40,6 +59,7 @@ func (dbService *RecruitmentListDBService) CreateDownload(
 	fileName string,
 	path string,
 	by string,
+	encryption *DownloadEncryption,
 ) (*Download, error) {
 	download := Download{
 		RecruitmentListID: recruitmentListID,
@@ -50,6 +70,7 @@ func (dbService *RecruitmentListDBService) CreateDownload(
 		FileType:          fileType,
 		FileName:          fileName,
 		Path:              path,
+		Encryption:        encryption,
 	}
 
 	ctx, cancel := dbService.getContext()
@@ -6,12 +6,29 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func (dbService *RecruitmentListDBService) collectionParticipantNotes() *mongo.Collection {
 	return dbService.DBClient.Database(dbService.getDBName()).Collection(COL_NAME_PARTICIPANT_NOTES)
 }
 
+func (dbService *RecruitmentListDBService) createIndexesForParticipantNotes() error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	_, err := dbService.collectionParticipantNotes().Indexes().CreateOne(
+		ctx,
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "recruitmentListId", Value: 1},
+				{Key: "pid", Value: 1},
+			},
+		},
+	)
+	return err
+}
+
 type ParticipantNote struct {
 	ID                primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
 	PID               string             `json:"pid,omitempty" bson:"pid,omitempty"`
@@ -68,6 +85,33 @@ func (dbService *RecruitmentListDBService) GetParticipantNotes(
 	return participantNotes, nil
 }
 
+// IterateParticipantNotes goes through the notes of the list's participants, per participant in the order they were written
+func (dbService *RecruitmentListDBService) IterateParticipantNotes(
+	recruitmentListID string,
+	callback func(note *ParticipantNote) error,
+) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "pid", Value: 1}, {Key: "createdAt", Value: 1}})
+	cur, err := dbService.collectionParticipantNotes().Find(ctx, bson.M{"recruitmentListId": recruitmentListID}, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var note ParticipantNote
+		if err := cur.Decode(&note); err != nil {
+			return err
+		}
+		if err := callback(&note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (dbService *RecruitmentListDBService) GetParticipantNoteByID(noteID string) (*ParticipantNote, error) {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
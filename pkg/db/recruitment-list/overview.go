@@ -0,0 +1,255 @@
+package recruitmentlist
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	SYNC_HEALTH_OK           = "ok"
+	SYNC_HEALTH_RUNNING      = "running"
+	SYNC_HEALTH_STUCK        = "stuck"
+	SYNC_HEALTH_FAILING      = "failing"
+	SYNC_HEALTH_PAUSED       = "paused"
+	SYNC_HEALTH_NEVER_SYNCED = "neverSynced"
+)
+
+// RecruitmentListOverview summarizes a list for the admin overview
+type RecruitmentListOverview struct {
+	RecruitmentList    RecruitmentList `json:"recruitmentList"`
+	Participants       int64           `json:"participants"`
+	ActiveParticipants int64           `json:"activeParticipants"`
+	SyncInfo           *SyncInfo       `json:"syncInfo,omitempty"`
+	// ok, running, stuck (running without heartbeat), failing (errors in the last data sync, or interrupted), paused or neverSynced
+	SyncHealth string `json:"syncHealth"`
+	// start of the last participant sync or end of the last data sync
+	LastSyncAt         *time.Time `json:"lastSyncAt,omitempty"`
+	PreparingDownloads int64      `json:"preparingDownloads"`
+	AvailableDownloads int64      `json:"availableDownloads"`
+	// latest inclusion, note, participant info change or download
+	LastActivityAt *time.Time `json:"lastActivityAt,omitempty"`
+	// users with a permission for the list, admins are not counted
+	Researchers int64 `json:"researchers"`
+}
+
+// GetRecruitmentListsOverview aggregates participants, syncs, downloads, activity and permissions of all lists.
+// Running syncs without heartbeat since staleBefore are stuck.
+func (dbService *RecruitmentListDBService) GetRecruitmentListsOverview(staleBefore time.Time) ([]RecruitmentListOverview, error) {
+	lists, err := dbService.GetRecruitmentListsInfos()
+	if err != nil {
+		return nil, err
+	}
+
+	syncInfos, err := dbService.getAllSyncInfos()
+	if err != nil {
+		return nil, err
+	}
+
+	type participantCounts struct {
+		RecruitmentListID string    `bson:"_id"`
+		Total             int64     `bson:"total"`
+		Active            int64     `bson:"active"`
+		LastIncludedAt    time.Time `bson:"lastIncludedAt"`
+	}
+	var participants []participantCounts
+	if err := dbService.aggregateByRecruitmentList(dbService.collectionParticipants(), nil, bson.M{
+		"_id":            "$recruitmentListId",
+		"total":          bson.M{"$sum": 1},
+		"active":         bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$ifNull": bson.A{"$deletedAt", false}}, 0, 1}}},
+		"lastIncludedAt": bson.M{"$max": "$includedAt"},
+	}, &participants); err != nil {
+		return nil, err
+	}
+
+	type downloadCounts struct {
+		ID struct {
+			RecruitmentListID string `bson:"recruitmentListId"`
+			Status            string `bson:"status"`
+		} `bson:"_id"`
+		Count         int64     `bson:"count"`
+		LastCreatedAt time.Time `bson:"lastCreatedAt"`
+	}
+	var downloads []downloadCounts
+	if err := dbService.aggregateByRecruitmentList(dbService.collectionDownloads(), nil, bson.M{
+		"_id":           bson.M{"recruitmentListId": "$recruitmentListId", "status": "$status"},
+		"count":         bson.M{"$sum": 1},
+		"lastCreatedAt": bson.M{"$max": "$createdAt"},
+	}, &downloads); err != nil {
+		return nil, err
+	}
+
+	type lastActivity struct {
+		RecruitmentListID string    `bson:"_id"`
+		Last              time.Time `bson:"last"`
+	}
+	var notes, infoChanges []lastActivity
+	if err := dbService.aggregateByRecruitmentList(dbService.collectionParticipantNotes(), nil, bson.M{
+		"_id":  "$recruitmentListId",
+		"last": bson.M{"$max": "$createdAt"},
+	}, &notes); err != nil {
+		return nil, err
+	}
+	if err := dbService.aggregateByRecruitmentList(dbService.collectionParticipantInfoChanges(), nil, bson.M{
+		"_id":  "$recruitmentListId",
+		"last": bson.M{"$max": "$changedAt"},
+	}, &infoChanges); err != nil {
+		return nil, err
+	}
+
+	type researcherCount struct {
+		RecruitmentListID string   `bson:"_id"`
+		Users             []string `bson:"users"`
+	}
+	var researchers []researcherCount
+	if err := dbService.aggregateByRecruitmentList(dbService.collectionPermissions(), bson.M{"resourceId": bson.M{"$nin": bson.A{nil, ""}}}, bson.M{
+		"_id":   "$resourceId",
+		"users": bson.M{"$addToSet": "$userId"},
+	}, &researchers); err != nil {
+		return nil, err
+	}
+
+	overviews := make([]RecruitmentListOverview, len(lists))
+	byID := map[string]*RecruitmentListOverview{}
+	for i, list := range lists {
+		overviews[i] = RecruitmentListOverview{RecruitmentList: list}
+		byID[list.ID.Hex()] = &overviews[i]
+	}
+	activity := func(o *RecruitmentListOverview, t time.Time) {
+		if !t.IsZero() && (o.LastActivityAt == nil || t.After(*o.LastActivityAt)) {
+			o.LastActivityAt = &t
+		}
+	}
+
+	for _, p := range participants {
+		if o, ok := byID[p.RecruitmentListID]; ok {
+			o.Participants = p.Total
+			o.ActiveParticipants = p.Active
+			activity(o, p.LastIncludedAt)
+		}
+	}
+	for _, d := range downloads {
+		o, ok := byID[d.ID.RecruitmentListID]
+		if !ok {
+			continue
+		}
+		switch d.ID.Status {
+		case DOWNLOAD_STATUS_PREPARING:
+			o.PreparingDownloads += d.Count
+		case DONWLOAD_STATUS_AVAILABLE:
+			o.AvailableDownloads += d.Count
+		}
+		activity(o, d.LastCreatedAt)
+	}
+	for _, a := range append(notes, infoChanges...) {
+		if o, ok := byID[a.RecruitmentListID]; ok {
+			activity(o, a.Last)
+		}
+	}
+	for _, r := range researchers {
+		if o, ok := byID[r.RecruitmentListID]; ok {
+			o.Researchers = int64(len(r.Users))
+		}
+	}
+	for i := range overviews {
+		o := &overviews[i]
+		if syncInfo, ok := syncInfos[o.RecruitmentList.ID.Hex()]; ok {
+			o.SyncInfo = &syncInfo
+			o.LastSyncAt = lastSyncAt(syncInfo)
+		}
+		schedule := o.RecruitmentList.SyncConfig.Schedule
+		o.SyncHealth = syncHealth(o.SyncInfo, schedule != nil && schedule.Paused, staleBefore)
+	}
+	return overviews, nil
+}
+
+func (dbService *RecruitmentListDBService) getAllSyncInfos() (map[string]SyncInfo, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	cur, err := dbService.collectionSyncInfos().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var syncInfos []SyncInfo
+	if err := cur.All(ctx, &syncInfos); err != nil {
+		return nil, err
+	}
+	byList := make(map[string]SyncInfo, len(syncInfos))
+	for _, syncInfo := range syncInfos {
+		byList[syncInfo.RecruitmentListID] = syncInfo
+	}
+	return byList, nil
+}
+
+func (dbService *RecruitmentListDBService) aggregateByRecruitmentList(collection *mongo.Collection, match bson.M, group bson.M, results any) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	pipeline := []bson.M{}
+	if match != nil {
+		pipeline = append(pipeline, bson.M{"$match": match})
+	}
+	pipeline = append(pipeline, bson.M{"$group": group})
+
+	cur, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	return cur.All(ctx, results)
+}
+
+func lastSyncAt(syncInfo SyncInfo) *time.Time {
+	last := syncInfo.ParticipantSyncStartedAt
+	if syncInfo.DataSyncStats != nil && syncInfo.DataSyncStats.FinishedAt != nil &&
+		(last == nil || syncInfo.DataSyncStats.FinishedAt.After(*last)) {
+		last = syncInfo.DataSyncStats.FinishedAt
+	}
+	return last
+}
+
+func syncHealth(syncInfo *SyncInfo, paused bool, staleBefore time.Time) string {
+	if syncInfo == nil {
+		if paused {
+			return SYNC_HEALTH_PAUSED
+		}
+		return SYNC_HEALTH_NEVER_SYNCED
+	}
+
+	health := SYNC_HEALTH_OK
+	for _, s := range []struct {
+		status      string
+		startedAt   *time.Time
+		heartbeatAt *time.Time
+	}{
+		{syncInfo.ParticipantSyncStatus, syncInfo.ParticipantSyncStartedAt, syncInfo.ParticipantSyncHeartbeatAt},
+		{syncInfo.DataSyncStatus, syncInfo.DataSyncStartedAt, syncInfo.DataSyncHeartbeatAt},
+	} {
+		switch s.status {
+		case SYNC_STATUS_RUNNING:
+			if !isSyncActive(s.status, s.startedAt, s.heartbeatAt, staleBefore) {
+				return SYNC_HEALTH_STUCK
+			}
+			health = SYNC_HEALTH_RUNNING
+		case SYNC_STATUS_INTERRUPTED:
+			if health == SYNC_HEALTH_OK {
+				health = SYNC_HEALTH_FAILING
+			}
+		}
+	}
+	if health == SYNC_HEALTH_OK && syncInfo.DataSyncStatus != SYNC_STATUS_RUNNING && syncInfo.DataSyncStats.HasErrors() {
+		health = SYNC_HEALTH_FAILING
+	}
+	if health == SYNC_HEALTH_OK && paused {
+		return SYNC_HEALTH_PAUSED
+	}
+	if health == SYNC_HEALTH_OK && lastSyncAt(*syncInfo) == nil {
+		// sync info only created by the scheduler
+		return SYNC_HEALTH_NEVER_SYNCED
+	}
+	return health
+}
@@ -0,0 +1,174 @@
+package recruitmentlist
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// CursorPaginationInfos describes a page of participants loaded with a cursor
+type CursorPaginationInfos struct {
+	PageSize int64 `json:"pageSize"`
+	// cursor of the next page, empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+	HasMore    bool   `json:"hasMore"`
+	// only set if the count was requested
+	TotalCount *int64 `json:"totalCount,omitempty"`
+}
+
+// participantCursor is the position after the last participant of a page, for the sort it was created with
+type participantCursor struct {
+	Field string             `bson:"f"`
+	Order string             `bson:"o"`
+	Value bson.RawValue      `bson:"v"`
+	ID    primitive.ObjectID `bson:"id"`
+}
+
+// GetParticipantsByCursor loads the participants after the cursor (empty for the first page), sorted by the sort field and _id.
+// Unlike the paginated variant, pages stay consistent while participants are added, and the total count is only
+// computed if requested. Values of the sort field are expected to have the same type in all participants.
+func (dbService *RecruitmentListDBService) GetParticipantsByCursor(rlID string, limit int64,
+	pFilter ParticipantFilter,
+	sort ParticipantSort,
+	cursor string,
+	withCount bool,
+) (participants []Participant, paginationInfo CursorPaginationInfos, err error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	if limit < 1 {
+		limit = FALLBACK_PAGE_SIZE
+	}
+	if sort.Order != "desc" {
+		sort.Order = "asc"
+	}
+	paginationInfo.PageSize = limit
+
+	filter := participantFilterToBson(rlID, pFilter)
+	if withCount {
+		count, err := dbService.countParticipants(ctx, rlID, filter)
+		if err != nil {
+			return nil, paginationInfo, err
+		}
+		paginationInfo.TotalCount = &count
+	}
+
+	if cursor != "" {
+		after, err := decodeParticipantCursor(cursor, sort)
+		if err != nil {
+			return nil, paginationInfo, err
+		}
+		filter = bson.M{"$and": bson.A{filter, after.condition()}}
+	}
+
+	opts := options.Find()
+	opts.SetLimit(limit + 1)
+	opts.SetSort(participantSortToBson(sort))
+	cur, err := dbService.findParticipants(ctx, rlID, filter, opts)
+	if err != nil {
+		return nil, paginationInfo, err
+	}
+	defer cur.Close(ctx)
+
+	participants = []Participant{}
+	var last bson.Raw
+	for cur.Next(ctx) {
+		if int64(len(participants)) == limit {
+			paginationInfo.HasMore = true
+			break
+		}
+		var participant Participant
+		if err := cur.Decode(&participant); err != nil {
+			return nil, paginationInfo, err
+		}
+		participants = append(participants, participant)
+		// the cursor reuses its buffer on the next call of Next
+		last = slices.Clone(cur.Current)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, paginationInfo, err
+	}
+
+	if paginationInfo.HasMore {
+		paginationInfo.NextCursor, err = encodeParticipantCursor(sort, last)
+		if err != nil {
+			return nil, paginationInfo, err
+		}
+	}
+	return participants, paginationInfo, nil
+}
+
+func encodeParticipantCursor(sort ParticipantSort, last bson.Raw) (string, error) {
+	c := participantCursor{
+		Field: sort.Field,
+		Order: sort.Order,
+		Value: bson.RawValue{Type: bsontype.Null},
+	}
+	if value, err := last.LookupErr(strings.Split(sort.Field, ".")...); err == nil {
+		c.Value = value
+	}
+	id, ok := last.Lookup("_id").ObjectIDOK()
+	if !ok {
+		return "", errors.New("participant without _id")
+	}
+	c.ID = id
+
+	raw, err := bson.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeParticipantCursor(cursor string, sort ParticipantSort) (*participantCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c participantCursor
+	if err := bson.Unmarshal(raw, &c); err != nil || c.ID.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	if c.Field != sort.Field || c.Order != sort.Order {
+		return nil, fmt.Errorf("%w: created for another sort", ErrInvalidCursor)
+	}
+	if !IsParticipantQueryField(c.Field) {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// condition matches the participants after the cursor position. Missing values sort first, like null.
+func (c *participantCursor) condition() bson.M {
+	sameValueAfter := bson.M{c.Field: c.Value, "_id": bson.M{"$gt": c.ID}}
+	isNull := c.Value.Type == bsontype.Null || c.Value.Type == bsontype.Undefined
+
+	if isNull {
+		sameValueAfter = bson.M{c.Field: nil, "_id": bson.M{"$gt": c.ID}}
+		if c.Order == "desc" {
+			return sameValueAfter
+		}
+		return bson.M{"$or": bson.A{bson.M{c.Field: bson.M{"$ne": nil}}, sameValueAfter}}
+	}
+
+	if c.Order == "desc" {
+		return bson.M{"$or": bson.A{
+			bson.M{c.Field: bson.M{"$lt": c.Value}},
+			sameValueAfter,
+			bson.M{c.Field: nil},
+		}}
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{c.Field: bson.M{"$gt": c.Value}},
+		sameValueAfter,
+	}}
+}
@@ -0,0 +1,146 @@
+package recruitmentlist
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	INFO_CHANGE_SOURCE_SYNC          = "sync"
+	INFO_CHANGE_SOURCE_CHANGE_STREAM = "changeStream"
+	INFO_CHANGE_SOURCE_ACTION        = "participantAction"
+)
+
+func (dbService *RecruitmentListDBService) collectionParticipantInfoChanges() *mongo.Collection {
+	return dbService.DBClient.Database(dbService.getDBName()).Collection(COL_NAME_PARTICIPANT_INFO_CHANGES)
+}
+
+// ParticipantInfoChange records the change of one participant info label.
+// OldValue is empty if the label was added, NewValue if it was removed.
+type ParticipantInfoChange struct {
+	ID                primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	ParticipantID     string             `json:"participantId,omitempty" bson:"participantId,omitempty"`
+	RecruitmentListID string             `json:"recruitmentListId,omitempty" bson:"recruitmentListId,omitempty"`
+	Label             string             `json:"label,omitempty" bson:"label,omitempty"`
+	OldValue          any                `json:"oldValue,omitempty" bson:"oldValue,omitempty"`
+	NewValue          any                `json:"newValue,omitempty" bson:"newValue,omitempty"`
+	ChangedAt         time.Time          `json:"changedAt" bson:"changedAt"`
+	Source            string             `json:"source,omitempty" bson:"source,omitempty"`
+}
+
+func (dbService *RecruitmentListDBService) createIndexesForParticipantInfoChanges() error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+	_, err := dbService.collectionParticipantInfoChanges().Indexes().CreateMany(
+		ctx,
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{
+					{Key: "recruitmentListId", Value: 1},
+					{Key: "participantId", Value: 1},
+					{Key: "changedAt", Value: -1},
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "recruitmentListId", Value: 1},
+					{Key: "changedAt", Value: -1},
+				},
+			},
+		},
+	)
+	return err
+}
+
+func (dbService *RecruitmentListDBService) SaveParticipantInfoChanges(changes []ParticipantInfoChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	docs := make([]interface{}, len(changes))
+	for i, change := range changes {
+		docs[i] = change
+	}
+	_, err := dbService.collectionParticipantInfoChanges().InsertMany(ctx, docs)
+	return err
+}
+
+// GetParticipantInfoChanges returns the info history of a participant, latest first
+func (dbService *RecruitmentListDBService) GetParticipantInfoChanges(
+	pid string,
+	rlID string,
+) ([]ParticipantInfoChange, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{"participantId": pid, "recruitmentListId": rlID}
+	opts := options.Find().SetSort(bson.D{{Key: "changedAt", Value: -1}})
+
+	cur, err := dbService.collectionParticipantInfoChanges().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	changes := []ParticipantInfoChange{}
+	if err := cur.All(ctx, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// GetRecentParticipantInfoChanges returns the latest info changes of all participants of the list,
+// optionally only changes after since and of the given labels
+func (dbService *RecruitmentListDBService) GetRecentParticipantInfoChanges(
+	rlID string,
+	since *time.Time,
+	labels []string,
+	limit int64,
+) ([]ParticipantInfoChange, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{"recruitmentListId": rlID}
+	if since != nil {
+		filter["changedAt"] = bson.M{"$gt": since}
+	}
+	if len(labels) > 0 {
+		filter["label"] = bson.M{"$in": labels}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "changedAt", Value: -1}}).SetLimit(limit)
+
+	cur, err := dbService.collectionParticipantInfoChanges().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	changes := []ParticipantInfoChange{}
+	if err := cur.All(ctx, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (dbService *RecruitmentListDBService) DeleteParticipantInfoChanges(pid string, rlID string) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	_, err := dbService.collectionParticipantInfoChanges().DeleteMany(ctx, bson.M{"participantId": pid, "recruitmentListId": rlID})
+	return err
+}
+
+func (dbService *RecruitmentListDBService) DeleteParticipantInfoChangesByRecruitmentListID(rlID string) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	_, err := dbService.collectionParticipantInfoChanges().DeleteMany(ctx, bson.M{"recruitmentListId": rlID})
+	return err
+}
@@ -0,0 +1,464 @@
+package recruitmentlist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type QueryOp string
+
+const (
+	QueryOpEq           QueryOp = "eq"
+	QueryOpNe           QueryOp = "ne"
+	QueryOpContains     QueryOp = "contains"     // case insensitive substring
+	QueryOpStartsWith   QueryOp = "startsWith"   // case insensitive prefix
+	QueryOpIn           QueryOp = "in"           // value is a list
+	QueryOpNotIn        QueryOp = "nin"          // value is a list
+	QueryOpExists       QueryOp = "exists"       // field has a non-empty value
+	QueryOpEmpty        QueryOp = "empty"        // field is missing, null, "" or []
+	QueryOpGt           QueryOp = "gt"           // numbers and dates
+	QueryOpGte          QueryOp = "gte"          // numbers and dates
+	QueryOpLt           QueryOp = "lt"           // numbers and dates
+	QueryOpLte          QueryOp = "lte"          // numbers and dates
+	QueryOpBetween      QueryOp = "between"      // value is [min, max], inclusive
+	QueryOpHasNotes     QueryOp = "hasNotes"     // no field, value false negates
+	QueryOpHasResponses QueryOp = "hasResponses" // no field, value is the survey key
+)
+
+const (
+	participantQueryMaxDepth = 8
+	participantQueryMaxNodes = 100
+
+	// fields added by $lookup stages for conditions on other collections, never returned with the participants
+	queryLookupNotes   = "_queryNotes"
+	queryLookupSurveys = "_querySurveys"
+)
+
+// ParticipantQuery is a filter expression over the participants of a list.
+// A node is either a combination (and, or, not) or a condition on a field.
+//
+// Fields: participantId, recruitmentStatus, includedAt, includedBy, deletedAt, infos.<label>
+type ParticipantQuery struct {
+	And   []ParticipantQuery `json:"and,omitempty"`
+	Or    []ParticipantQuery `json:"or,omitempty"`
+	Not   *ParticipantQuery  `json:"not,omitempty"`
+	Field string             `json:"field,omitempty"`
+	Op    QueryOp            `json:"op,omitempty"`
+	Value any                `json:"value,omitempty"`
+}
+
+var participantQueryFields = map[string]bool{
+	"participantId":     true,
+	"recruitmentStatus": true,
+	"includedAt":        true,
+	"includedBy":        true,
+	"deletedAt":         true,
+}
+
+var participantQueryDateFields = map[string]bool{
+	"includedAt": true,
+	"deletedAt":  true,
+}
+
+// InfoLabel returns the participant info label of the condition's field, or false if it's no info field
+func (q *ParticipantQuery) InfoLabel() (string, bool) {
+	return strings.CutPrefix(q.Field, "infos.")
+}
+
+// ConvertValues replaces the values of all conditions with the result of convert, which is called for every value
+// (every item of in, nin and between). Used to convert values of participant infos to their value type.
+func (q *ParticipantQuery) ConvertValues(convert func(q *ParticipantQuery, value any) (any, error)) error {
+	for i := range q.And {
+		if err := q.And[i].ConvertValues(convert); err != nil {
+			return err
+		}
+	}
+	for i := range q.Or {
+		if err := q.Or[i].ConvertValues(convert); err != nil {
+			return err
+		}
+	}
+	if q.Not != nil {
+		if err := q.Not.ConvertValues(convert); err != nil {
+			return err
+		}
+	}
+	if q.Field == "" || q.Value == nil {
+		return nil
+	}
+
+	if values, ok := q.Value.([]any); ok {
+		converted := make([]any, len(values))
+		for i, v := range values {
+			c, err := convert(q, v)
+			if err != nil {
+				return err
+			}
+			converted[i] = c
+		}
+		q.Value = converted
+		return nil
+	}
+	converted, err := convert(q, q.Value)
+	if err != nil {
+		return err
+	}
+	q.Value = converted
+	return nil
+}
+
+// ParticipantQueryFilter translates the query to a filter on the participants collection of the list.
+// Only whitelisted fields and operators are accepted, string values are never interpreted as operators or patterns.
+// Conditions on notes and responses refer to fields that are added by $lookup stages when participants are read
+// with the filter (see findParticipants).
+func (dbService *RecruitmentListDBService) ParticipantQueryFilter(rlID string, q *ParticipantQuery) (bson.M, error) {
+	nodes := 0
+	condition, err := participantQueryCondition(q, 0, &nodes)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{"$and": bson.A{bson.M{"recruitmentListId": rlID}, condition}}, nil
+}
+
+func participantQueryCondition(q *ParticipantQuery, depth int, nodes *int) (bson.M, error) {
+	*nodes++
+	if depth > participantQueryMaxDepth {
+		return nil, errors.New("query is nested too deep")
+	}
+	if *nodes > participantQueryMaxNodes {
+		return nil, errors.New("query has too many conditions")
+	}
+
+	combined := 0
+	for _, set := range []bool{len(q.And) > 0, len(q.Or) > 0, q.Not != nil, q.Field != "" || q.Op != ""} {
+		if set {
+			combined++
+		}
+	}
+	if combined != 1 {
+		return nil, errors.New("a query node must have exactly one of and, or, not or a condition")
+	}
+
+	switch {
+	case len(q.And) > 0 || len(q.Or) > 0:
+		children, op := q.And, "$and"
+		if len(q.Or) > 0 {
+			children, op = q.Or, "$or"
+		}
+		conditions := bson.A{}
+		for i := range children {
+			c, err := participantQueryCondition(&children[i], depth+1, nodes)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, c)
+		}
+		return bson.M{op: conditions}, nil
+	case q.Not != nil:
+		c, err := participantQueryCondition(q.Not, depth+1, nodes)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$nor": bson.A{c}}, nil
+	}
+
+	switch q.Op {
+	case QueryOpHasNotes:
+		hasNotes, ok := q.Value.(bool)
+		return bson.M{queryLookupNotes + ".0": bson.M{"$exists": !ok || hasNotes}}, nil
+	case QueryOpHasResponses:
+		surveyKey, ok := q.Value.(string)
+		if !ok || surveyKey == "" {
+			return nil, errors.New("hasResponses needs a survey key as value")
+		}
+		return bson.M{queryLookupSurveys + "._id": surveyKey}, nil
+	}
+
+	field, err := participantQueryField(q.Field)
+	if err != nil {
+		return nil, err
+	}
+	value := q.Value
+	if participantQueryDateFields[q.Field] {
+		if value, err = parseQueryDates(value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch q.Op {
+	case QueryOpEq:
+		return bson.M{field: bson.M{"$eq": value}}, nil
+	case QueryOpNe:
+		return bson.M{field: bson.M{"$ne": value}}, nil
+	case QueryOpContains, QueryOpStartsWith:
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s needs a string value", q.Op)
+		}
+		pattern := regexp.QuoteMeta(str)
+		if q.Op == QueryOpStartsWith {
+			pattern = "^" + pattern
+		}
+		return bson.M{field: primitive.Regex{Pattern: pattern, Options: "i"}}, nil
+	case QueryOpIn, QueryOpNotIn:
+		values, ok := value.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s needs a list value", q.Op)
+		}
+		return bson.M{field: bson.M{"$" + string(q.Op): values}}, nil
+	case QueryOpExists:
+		return bson.M{field: bson.M{"$exists": true, "$nin": bson.A{nil, "", bson.A{}}}}, nil
+	case QueryOpEmpty:
+		return bson.M{field: bson.M{"$in": bson.A{nil, "", bson.A{}}}}, nil
+	case QueryOpGt, QueryOpGte, QueryOpLt, QueryOpLte:
+		if err := checkRangeValue(value); err != nil {
+			return nil, err
+		}
+		return bson.M{field: bson.M{"$" + string(q.Op): value}}, nil
+	case QueryOpBetween:
+		values, ok := value.([]any)
+		if !ok || len(values) != 2 {
+			return nil, errors.New("between needs [min, max] as value")
+		}
+		for _, v := range values {
+			if err := checkRangeValue(v); err != nil {
+				return nil, err
+			}
+		}
+		return bson.M{field: bson.M{"$gte": values[0], "$lte": values[1]}}, nil
+	default:
+		return nil, fmt.Errorf("unknown operator: %s", q.Op)
+	}
+}
+
+// IsParticipantQueryField returns true if the participants can be filtered and sorted by the field
+func IsParticipantQueryField(field string) bool {
+	_, err := participantQueryField(field)
+	return err == nil
+}
+
+func participantQueryField(field string) (string, error) {
+	if participantQueryFields[field] {
+		return field, nil
+	}
+	if label, ok := strings.CutPrefix(field, "infos."); ok && label != "" && !strings.HasPrefix(label, "$") && !strings.ContainsRune(label, 0) {
+		return field, nil
+	}
+	return "", fmt.Errorf("unknown field: %s", field)
+}
+
+func checkRangeValue(value any) error {
+	switch value.(type) {
+	case float64, int, int64, time.Time, string:
+		return nil
+	default:
+		return errors.New("range operators need a number, date or string value")
+	}
+}
+
+// parseQueryDates converts the date strings of the value to times
+func parseQueryDates(value any) (any, error) {
+	parse := func(v any) (any, error) {
+		str, ok := v.(string)
+		if !ok {
+			return v, nil
+		}
+		for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+			if t, err := time.Parse(layout, str); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid date: %s", str)
+	}
+
+	if values, ok := value.([]any); ok {
+		converted := make([]any, len(values))
+		for i, v := range values {
+			c, err := parse(v)
+			if err != nil {
+				return nil, err
+			}
+			converted[i] = c
+		}
+		return converted, nil
+	}
+	return parse(value)
+}
+
+// participantQueryLookups are the collections a participant filter has conditions on
+type participantQueryLookups struct {
+	notes      bool
+	surveyKeys []string
+}
+
+func getParticipantQueryLookups(filter bson.M) participantQueryLookups {
+	lookups := participantQueryLookups{}
+	lookups.collect(filter)
+	return lookups
+}
+
+func (l *participantQueryLookups) collect(value any) {
+	switch v := value.(type) {
+	case bson.M:
+		for key, child := range v {
+			switch key {
+			case queryLookupNotes + ".0":
+				l.notes = true
+			case queryLookupSurveys + "._id":
+				if surveyKey, ok := child.(string); ok && !slices.Contains(l.surveyKeys, surveyKey) {
+					l.surveyKeys = append(l.surveyKeys, surveyKey)
+				}
+			default:
+				l.collect(child)
+			}
+		}
+	case bson.A:
+		for _, child := range v {
+			l.collect(child)
+		}
+	}
+}
+
+func (l *participantQueryLookups) empty() bool {
+	return !l.notes && len(l.surveyKeys) == 0
+}
+
+// stages returns the $lookup stages adding the fields the filter's conditions on notes and responses refer to
+func (l *participantQueryLookups) stages(rlID string) bson.A {
+	stages := bson.A{}
+	if l.notes {
+		stages = append(stages, bson.M{"$lookup": bson.M{
+			"from": COL_NAME_PARTICIPANT_NOTES,
+			"let":  bson.M{"pid": bson.M{"$toString": "$_id"}},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{
+					"recruitmentListId": rlID,
+					"$expr":             bson.M{"$eq": bson.A{"$pid", "$$pid"}},
+				}},
+				bson.M{"$limit": 1},
+				bson.M{"$project": bson.M{"_id": 1}},
+			},
+			"as": queryLookupNotes,
+		}})
+	}
+	if len(l.surveyKeys) > 0 {
+		stages = append(stages, bson.M{"$lookup": bson.M{
+			"from": COL_NAME_RESEARCH_DATA,
+			"let":  bson.M{"participantId": "$participantId"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{
+					"recruitmentListId": rlID,
+					"surveyKey":         bson.M{"$in": l.surveyKeys},
+					"$expr":             bson.M{"$eq": bson.A{"$participantId", "$$participantId"}},
+				}},
+				bson.M{"$group": bson.M{"_id": "$surveyKey"}},
+			},
+			"as": queryLookupSurveys,
+		}})
+	}
+	return stages
+}
+
+// participantsPipeline selects the participants of the list matching the filter, with the lookups it needs
+func (l *participantQueryLookups) participantsPipeline(rlID string, filter bson.M) bson.A {
+	pipeline := bson.A{bson.M{"$match": bson.M{"recruitmentListId": rlID}}}
+	pipeline = append(pipeline, l.stages(rlID)...)
+	return append(pipeline, bson.M{"$match": filter})
+}
+
+// findParticipants finds the participants of the list matching the filter. Filters with conditions on notes or
+// responses are run as aggregation with $lookup stages, the looked up fields are removed from the results.
+// Only the sort, skip, limit and projection of opts are applied to aggregations.
+func (dbService *RecruitmentListDBService) findParticipants(ctx context.Context, rlID string, filter bson.M, opts *options.FindOptions) (*mongo.Cursor, error) {
+	lookups := getParticipantQueryLookups(filter)
+	if lookups.empty() {
+		if opts == nil {
+			opts = options.Find()
+		}
+		return dbService.collectionParticipants().Find(ctx, filter, opts)
+	}
+
+	pipeline := lookups.participantsPipeline(rlID, filter)
+	if opts != nil {
+		if opts.Sort != nil {
+			pipeline = append(pipeline, bson.M{"$sort": opts.Sort})
+		}
+		if opts.Skip != nil && *opts.Skip > 0 {
+			pipeline = append(pipeline, bson.M{"$skip": *opts.Skip})
+		}
+		if opts.Limit != nil && *opts.Limit > 0 {
+			pipeline = append(pipeline, bson.M{"$limit": *opts.Limit})
+		}
+	}
+	if opts != nil && opts.Projection != nil {
+		pipeline = append(pipeline, bson.M{"$project": opts.Projection})
+	} else {
+		pipeline = append(pipeline, bson.M{"$project": bson.M{queryLookupNotes: 0, queryLookupSurveys: 0}})
+	}
+	// sorting all participants of a large list can exceed the memory limit of a pipeline stage
+	return dbService.collectionParticipants().Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+}
+
+// countParticipants counts the participants of the list matching the filter, see findParticipants
+func (dbService *RecruitmentListDBService) countParticipants(ctx context.Context, rlID string, filter bson.M) (int64, error) {
+	lookups := getParticipantQueryLookups(filter)
+	if lookups.empty() {
+		return dbService.collectionParticipants().CountDocuments(ctx, filter)
+	}
+
+	pipeline := append(lookups.participantsPipeline(rlID, filter), bson.M{"$count": "count"})
+	cur, err := dbService.collectionParticipants().Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	var result struct {
+		Count int64 `bson:"count"`
+	}
+	if cur.Next(ctx) {
+		if err := cur.Decode(&result); err != nil {
+			return 0, err
+		}
+	}
+	return result.Count, cur.Err()
+}
+
+// GetParticipantIDsByQuery returns the participant IDs (of the study) of the list's participants matching the query filter
+func (dbService *RecruitmentListDBService) GetParticipantIDsByQuery(rlID string, filter bson.M) ([]string, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	opts := options.Find().SetProjection(bson.M{"participantId": 1})
+	cur, err := dbService.findParticipants(ctx, rlID, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	pids := []string{}
+	seen := map[string]bool{}
+	for cur.Next(ctx) {
+		var participant struct {
+			ParticipantID string `bson:"participantId"`
+		}
+		if err := cur.Decode(&participant); err != nil {
+			return nil, err
+		}
+		if participant.ParticipantID != "" && !seen[participant.ParticipantID] {
+			seen[participant.ParticipantID] = true
+			pids = append(pids, participant.ParticipantID)
+		}
+	}
+	return pids, cur.Err()
+}
@@ -0,0 +1,224 @@
+package recruitmentlist
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testRLID = "list1"
+
+func parseTestQuery(t *testing.T, query string) *ParticipantQuery {
+	t.Helper()
+	var q ParticipantQuery
+	if err := json.Unmarshal([]byte(query), &q); err != nil {
+		t.Fatalf("invalid test query: %v", err)
+	}
+	return &q
+}
+
+func translateTestQuery(t *testing.T, query string) (bson.M, error) {
+	t.Helper()
+	return (&RecruitmentListDBService{}).ParticipantQueryFilter(testRLID, parseTestQuery(t, query))
+}
+
+func TestParticipantQueryFilter(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  bson.M
+	}{
+		{
+			name:  "eq",
+			query: `{"field": "recruitmentStatus", "op": "eq", "value": "invited"}`,
+			want:  bson.M{"recruitmentStatus": bson.M{"$eq": "invited"}},
+		},
+		{
+			name:  "operator-like string values are compared as values",
+			query: `{"field": "infos.city", "op": "eq", "value": "$ne"}`,
+			want:  bson.M{"infos.city": bson.M{"$eq": "$ne"}},
+		},
+		{
+			name:  "contains escapes the pattern",
+			query: `{"field": "infos.email", "op": "contains", "value": "a.b*"}`,
+			want:  bson.M{"infos.email": primitive.Regex{Pattern: `a\.b\*`, Options: "i"}},
+		},
+		{
+			name:  "startsWith",
+			query: `{"field": "participantId", "op": "startsWith", "value": "p1"}`,
+			want:  bson.M{"participantId": primitive.Regex{Pattern: "^p1", Options: "i"}},
+		},
+		{
+			name:  "in",
+			query: `{"field": "infos.city", "op": "in", "value": ["Berlin", "Paris"]}`,
+			want:  bson.M{"infos.city": bson.M{"$in": []any{"Berlin", "Paris"}}},
+		},
+		{
+			name:  "nin",
+			query: `{"field": "recruitmentStatus", "op": "nin", "value": ["excluded", ""]}`,
+			want:  bson.M{"recruitmentStatus": bson.M{"$nin": []any{"excluded", ""}}},
+		},
+		{
+			name:  "between numbers",
+			query: `{"field": "infos.age", "op": "between", "value": [18, 65]}`,
+			want:  bson.M{"infos.age": bson.M{"$gte": float64(18), "$lte": float64(65)}},
+		},
+		{
+			name:  "between dates of a date field",
+			query: `{"field": "includedAt", "op": "between", "value": ["2024-01-01", "2024-02-01T12:00:00Z"]}`,
+			want:  bson.M{"includedAt": bson.M{"$gte": date("2024-01-01T00:00:00Z"), "$lte": date("2024-02-01T12:00:00Z")}},
+		},
+		{
+			name:  "gt",
+			query: `{"field": "infos.score", "op": "gt", "value": 3}`,
+			want:  bson.M{"infos.score": bson.M{"$gt": float64(3)}},
+		},
+		{
+			name:  "exists",
+			query: `{"field": "infos.phone", "op": "exists"}`,
+			want:  bson.M{"infos.phone": bson.M{"$exists": true, "$nin": bson.A{nil, "", bson.A{}}}},
+		},
+		{
+			name:  "not",
+			query: `{"not": {"field": "recruitmentStatus", "op": "eq", "value": "excluded"}}`,
+			want:  bson.M{"$nor": bson.A{bson.M{"recruitmentStatus": bson.M{"$eq": "excluded"}}}},
+		},
+		{
+			name: "and with nested or",
+			query: `{"and": [
+				{"field": "infos.city", "op": "eq", "value": "Berlin"},
+				{"or": [{"field": "infos.age", "op": "lt", "value": 30}, {"field": "infos.age", "op": "empty"}]}
+			]}`,
+			want: bson.M{"$and": bson.A{
+				bson.M{"infos.city": bson.M{"$eq": "Berlin"}},
+				bson.M{"$or": bson.A{
+					bson.M{"infos.age": bson.M{"$lt": float64(30)}},
+					bson.M{"infos.age": bson.M{"$in": bson.A{nil, "", bson.A{}}}},
+				}},
+			}},
+		},
+		{
+			name:  "hasNotes",
+			query: `{"op": "hasNotes"}`,
+			want:  bson.M{queryLookupNotes + ".0": bson.M{"$exists": true}},
+		},
+		{
+			name:  "hasNotes false",
+			query: `{"op": "hasNotes", "value": false}`,
+			want:  bson.M{queryLookupNotes + ".0": bson.M{"$exists": false}},
+		},
+		{
+			name:  "hasResponses",
+			query: `{"op": "hasResponses", "value": "intake"}`,
+			want:  bson.M{queryLookupSurveys + "._id": "intake"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := translateTestQuery(t, tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := bson.M{"$and": bson.A{bson.M{"recruitmentListId": testRLID}, tt.want}}
+			if !reflect.DeepEqual(filter, want) {
+				t.Errorf("got  %v\nwant %v", filter, want)
+			}
+		})
+	}
+}
+
+func TestParticipantQueryFilterErrors(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat(`{"not": `, depth) + `{"field": "participantId", "op": "eq", "value": "p1"}` + strings.Repeat(`}`, depth)
+	}
+	conditions := func(n int) string {
+		items := make([]string, n)
+		for i := range items {
+			items[i] = `{"field": "participantId", "op": "eq", "value": "p1"}`
+		}
+		return `{"or": [` + strings.Join(items, ",") + `]}`
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{name: "max depth", query: nested(participantQueryMaxDepth)},
+		{name: "too deep", query: nested(participantQueryMaxDepth + 1), wantErr: "nested too deep"},
+		{name: "max nodes", query: conditions(participantQueryMaxNodes - 1)},
+		{name: "too many nodes", query: conditions(participantQueryMaxNodes), wantErr: "too many conditions"},
+		{name: "unknown field", query: `{"field": "password", "op": "eq", "value": "x"}`, wantErr: "unknown field"},
+		{name: "operator as field", query: `{"field": "$where", "op": "eq", "value": "x"}`, wantErr: "unknown field"},
+		{name: "operator as info label", query: `{"field": "infos.$gt", "op": "eq", "value": "x"}`, wantErr: "unknown field"},
+		{name: "empty info label", query: `{"field": "infos.", "op": "eq", "value": "x"}`, wantErr: "unknown field"},
+		{name: "unknown operator", query: `{"field": "participantId", "op": "regex", "value": "x"}`, wantErr: "unknown operator"},
+		{name: "empty node", query: `{}`, wantErr: "exactly one of"},
+		{name: "condition and combination", query: `{"field": "participantId", "op": "eq", "value": "x", "not": {"op": "hasNotes"}}`, wantErr: "exactly one of"},
+		{name: "and and or", query: `{"and": [{"op": "hasNotes"}], "or": [{"op": "hasNotes"}]}`, wantErr: "exactly one of"},
+		{name: "nin without list", query: `{"field": "recruitmentStatus", "op": "nin", "value": "excluded"}`, wantErr: "needs a list value"},
+		{name: "between with one value", query: `{"field": "infos.age", "op": "between", "value": [18]}`, wantErr: "between needs"},
+		{name: "between with object", query: `{"field": "infos.age", "op": "between", "value": [18, {"$gt": 1}]}`, wantErr: "range operators"},
+		{name: "contains with number", query: `{"field": "infos.city", "op": "contains", "value": 1}`, wantErr: "needs a string value"},
+		{name: "invalid date", query: `{"field": "includedAt", "op": "gt", "value": "yesterday"}`, wantErr: "invalid date"},
+		{name: "hasResponses without survey key", query: `{"op": "hasResponses"}`, wantErr: "survey key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := translateTestQuery(t, tt.query)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParticipantQueryLookups(t *testing.T) {
+	filter, err := translateTestQuery(t, `{"or": [
+		{"op": "hasResponses", "value": "intake"},
+		{"not": {"op": "hasNotes", "value": false}},
+		{"and": [{"op": "hasResponses", "value": "weekly"}, {"op": "hasResponses", "value": "intake"}]}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookups := getParticipantQueryLookups(bson.M{"recruitmentListId": testRLID, "$and": bson.A{filter}})
+	if !lookups.notes {
+		t.Error("expected notes lookup")
+	}
+	if !reflect.DeepEqual(lookups.surveyKeys, []string{"intake", "weekly"}) && !reflect.DeepEqual(lookups.surveyKeys, []string{"weekly", "intake"}) {
+		t.Errorf("survey keys: got %v", lookups.surveyKeys)
+	}
+	if stages := lookups.stages(testRLID); len(stages) != 2 {
+		t.Errorf("expected 2 lookup stages, got %d", len(stages))
+	}
+
+	filter, err = translateTestQuery(t, `{"field": "infos.note", "op": "eq", "value": "_queryNotes.0"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lookups := getParticipantQueryLookups(filter); !lookups.empty() {
+		t.Errorf("expected no lookups, got %+v", lookups)
+	}
+}
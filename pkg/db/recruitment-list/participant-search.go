@@ -0,0 +1,473 @@
+package recruitmentlist
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// score of a participant whose ID starts with the search text, ranked above text matches
+	participantIDMatchScore = 10
+	searchSnippetContext    = 60
+)
+
+// ParticipantSearchHit is a participant matching a search, with the fields the search text was found in
+type ParticipantSearchHit struct {
+	Participant Participant   `json:"participant"`
+	Score       float64       `json:"score"`
+	Matches     []SearchMatch `json:"matches"`
+}
+
+// SearchMatch is a field containing the search text. Highlights are rune offsets in Text.
+type SearchMatch struct {
+	// participantId, infos.<label> or note
+	Field      string      `json:"field"`
+	NoteID     string      `json:"noteId,omitempty"`
+	Text       string      `json:"text"`
+	Highlights []TextRange `json:"highlights"`
+}
+
+type TextRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// createIndexesForParticipantSearch creates the text indexes over participants (all string fields, including the infos)
+// and notes. Stemming is disabled, as most infos are names, emails and codes.
+func (dbService *RecruitmentListDBService) createIndexesForParticipantSearch() error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+	_, err := dbService.collectionParticipants().Indexes().CreateOne(
+		ctx,
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "$**", Value: "text"}},
+			Options: options.Index().SetName("participant_search").SetDefaultLanguage("none"),
+		},
+	)
+	if err != nil {
+		return err
+	}
+	_, err = dbService.collectionParticipantNotes().Indexes().CreateOne(
+		ctx,
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "recruitmentListId", Value: 1},
+				{Key: "note", Value: "text"},
+			},
+			Options: options.Index().SetName("note_search").SetDefaultLanguage("none"),
+		},
+	)
+	return err
+}
+
+// SearchParticipants searches the participant IDs, participant info values and notes of the list.
+// restriction is an additional filter on the participants (e.g. from permission limiters) and may be nil.
+// Hits are sorted by score, a participant ID starting with the text ranks first.
+func (dbService *RecruitmentListDBService) SearchParticipants(rlID string, text string, restriction bson.M, limit int64) ([]ParticipantSearchHit, error) {
+	terms := searchTerms(text)
+	if len(terms) == 0 {
+		return []ParticipantSearchHit{}, nil
+	}
+
+	participantFilter := func(condition bson.M) bson.M {
+		conditions := bson.A{bson.M{"recruitmentListId": rlID}, condition}
+		if restriction != nil {
+			conditions = append(conditions, restriction)
+		}
+		return bson.M{"$and": conditions}
+	}
+
+	hits := map[string]*ParticipantSearchHit{}
+	addHit := func(participant Participant, score float64) *ParticipantSearchHit {
+		hit, ok := hits[participant.ID.Hex()]
+		if !ok {
+			hit = &ParticipantSearchHit{Participant: participant, Matches: []SearchMatch{}}
+			hits[participant.ID.Hex()] = hit
+		}
+		hit.Score += score
+		return hit
+	}
+
+	// participant IDs
+	idMatches, err := dbService.findParticipantsForSearch(
+		participantFilter(bson.M{"participantId": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(strings.TrimSpace(text))}}),
+		false,
+		limit,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range idMatches {
+		addHit(m.Participant, participantIDMatchScore)
+	}
+
+	// participant infos, the text index also covers fields that are not searched, like the status
+	textMatches, err := dbService.findParticipantsForSearch(
+		participantFilter(bson.M{"$text": bson.M{"$search": text}}),
+		true,
+		limit,
+		func(m participantWithScore) bool {
+			return len(participantFieldMatches(m.Participant, terms)) > 0
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range textMatches {
+		addHit(m.Participant, m.Score)
+	}
+
+	// notes, only of participants allowed by the restriction
+	notes, noteParticipants, err := dbService.findNotesForSearch(rlID, text, participantFilter, limit)
+	if err != nil {
+		return nil, err
+	}
+	noteScores := map[string]float64{}
+	noteMatches := map[string][]SearchMatch{}
+	for _, n := range notes {
+		noteScores[n.PID] += n.Score
+		noteMatches[n.PID] = append(noteMatches[n.PID], noteSearchMatch(n.ParticipantNote, terms))
+	}
+	for pid := range noteScores {
+		if _, ok := hits[pid]; !ok {
+			addHit(noteParticipants[pid], 0)
+		}
+	}
+	for pid, score := range noteScores {
+		if hit, ok := hits[pid]; ok {
+			hit.Score += score
+			hit.Matches = append(hit.Matches, noteMatches[pid]...)
+		}
+	}
+
+	results := make([]ParticipantSearchHit, 0, len(hits))
+	for _, hit := range hits {
+		hit.Matches = append(participantFieldMatches(hit.Participant, terms), hit.Matches...)
+		results = append(results, *hit)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Participant.ParticipantID < results[j].Participant.ParticipantID
+	})
+	if limit > 0 && int64(len(results)) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+type participantWithScore struct {
+	Participant `bson:",inline"`
+	Score       float64 `bson:"score,omitempty"`
+}
+
+type noteWithScore struct {
+	ParticipantNote `bson:",inline"`
+	Score           float64 `bson:"score,omitempty"`
+}
+
+// findParticipantsForSearch returns up to limit participants matching the filter that are accepted by accept (all if nil).
+// Rejected participants don't count towards the limit, so the cursor is read until enough participants are accepted.
+func (dbService *RecruitmentListDBService) findParticipantsForSearch(filter bson.M, textScore bool, limit int64, accept func(m participantWithScore) bool) ([]participantWithScore, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	opts := options.Find()
+	if textScore {
+		opts.SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}})
+		opts.SetSort(bson.M{"score": bson.M{"$meta": "textScore"}})
+	}
+	if limit > 0 {
+		if accept == nil {
+			opts.SetLimit(limit)
+		} else {
+			opts.SetBatchSize(int32(min(2*limit, 1000)))
+		}
+	}
+
+	cur, err := dbService.collectionParticipants().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	participants := []participantWithScore{}
+	for cur.Next(ctx) {
+		var m participantWithScore
+		if err := cur.Decode(&m); err != nil {
+			return nil, err
+		}
+		if accept != nil && !accept(m) {
+			continue
+		}
+		participants = append(participants, m)
+		if limit > 0 && int64(len(participants)) >= limit {
+			break
+		}
+	}
+	return participants, cur.Err()
+}
+
+// findNotesForSearch returns up to limit notes of the list matching the text, with their participants by document ID.
+// Only notes of participants matching participantFilter are returned and count towards the limit, the participants
+// are looked up per batch of notes until enough notes are accepted.
+func (dbService *RecruitmentListDBService) findNotesForSearch(
+	rlID string,
+	text string,
+	participantFilter func(condition bson.M) bson.M,
+	limit int64,
+) ([]noteWithScore, map[string]Participant, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	batchSize := 1000
+	if limit > 0 {
+		batchSize = int(min(2*limit, 1000))
+	}
+	opts := options.Find().
+		SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetSort(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetBatchSize(int32(batchSize))
+
+	cur, err := dbService.collectionParticipantNotes().Find(ctx, bson.M{"recruitmentListId": rlID, "$text": bson.M{"$search": text}}, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cur.Close(ctx)
+
+	notes := []noteWithScore{}
+	participants := map[string]Participant{}
+	checked := map[string]bool{}
+	batch := make([]noteWithScore, 0, batchSize)
+
+	// acceptBatch adds the notes of the batch whose participants match, returns true once the limit is reached
+	acceptBatch := func() (bool, error) {
+		ids := bson.A{}
+		for _, n := range batch {
+			if checked[n.PID] {
+				continue
+			}
+			checked[n.PID] = true
+			if id, err := primitive.ObjectIDFromHex(n.PID); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) > 0 {
+			found, err := dbService.findParticipantsForSearch(participantFilter(bson.M{"_id": bson.M{"$in": ids}}), false, 0, nil)
+			if err != nil {
+				return false, err
+			}
+			for _, m := range found {
+				participants[m.ID.Hex()] = m.Participant
+			}
+		}
+
+		for _, n := range batch {
+			if _, ok := participants[n.PID]; !ok {
+				continue
+			}
+			notes = append(notes, n)
+			if limit > 0 && int64(len(notes)) >= limit {
+				return true, nil
+			}
+		}
+		batch = batch[:0]
+		return false, nil
+	}
+
+	for cur.Next(ctx) {
+		var n noteWithScore
+		if err := cur.Decode(&n); err != nil {
+			return nil, nil, err
+		}
+		batch = append(batch, n)
+		if len(batch) < batchSize {
+			continue
+		}
+		if done, err := acceptBatch(); err != nil || done {
+			return notes, participants, err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return nil, nil, err
+	}
+	if _, err := acceptBatch(); err != nil {
+		return nil, nil, err
+	}
+	return notes, participants, nil
+}
+
+// searchTerms returns the lower case words of the search text, without phrase quotes and negations
+func searchTerms(text string) []string {
+	terms := []string{}
+	for _, word := range strings.Fields(strings.ReplaceAll(text, "\"", " ")) {
+		if strings.HasPrefix(word, "-") {
+			continue
+		}
+		word = lowerRunes(word)
+		if word != "" && !slices.Contains(terms, word) {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// participantFieldMatches returns the participant ID and the info values containing one of the terms
+func participantFieldMatches(participant Participant, terms []string) []SearchMatch {
+	matches := []SearchMatch{}
+	if ranges := highlightTerms(participant.ParticipantID, terms); len(ranges) > 0 {
+		matches = append(matches, SearchMatch{Field: "participantId", Text: participant.ParticipantID, Highlights: ranges})
+	}
+
+	labels := make([]string, 0, len(participant.Infos))
+	for label := range participant.Infos {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		text, ok := searchableInfoText(participant.Infos[label])
+		if !ok {
+			continue
+		}
+		if ranges := highlightTerms(text, terms); len(ranges) > 0 {
+			matches = append(matches, SearchMatch{Field: "infos." + label, Text: text, Highlights: ranges})
+		}
+	}
+	return matches
+}
+
+// searchableInfoText returns the text of string and list infos, other value types are not text indexed
+func searchableInfoText(value any) (string, bool) {
+	switch typedValue := value.(type) {
+	case string:
+		return typedValue, true
+	case primitive.A:
+		return searchableInfoText([]any(typedValue))
+	case []any:
+		items := []string{}
+		for _, item := range typedValue {
+			if str, ok := item.(string); ok {
+				items = append(items, str)
+			}
+		}
+		return strings.Join(items, ", "), len(items) > 0
+	default:
+		return "", false
+	}
+}
+
+// noteSearchMatch returns the part of the note around the first match
+func noteSearchMatch(note ParticipantNote, terms []string) SearchMatch {
+	text := []rune(note.Note)
+	ranges := highlightTerms(note.Note, terms)
+
+	start, end := 0, len(text)
+	if len(ranges) > 0 {
+		start = max(0, ranges[0].Start-searchSnippetContext)
+		end = min(len(text), ranges[0].End+searchSnippetContext)
+	} else {
+		end = min(len(text), 2*searchSnippetContext)
+	}
+
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = "…"
+	}
+	if end < len(text) {
+		suffix = "…"
+	}
+	offset := len([]rune(prefix)) - start
+
+	highlights := []TextRange{}
+	for _, r := range ranges {
+		if r.Start >= start && r.End <= end {
+			highlights = append(highlights, TextRange{Start: r.Start + offset, End: r.End + offset})
+		}
+	}
+	return SearchMatch{
+		Field:      "note",
+		NoteID:     note.ID.Hex(),
+		Text:       prefix + string(text[start:end]) + suffix,
+		Highlights: highlights,
+	}
+}
+
+// highlightTerms returns the case insensitive occurrences of the terms in the text as merged rune ranges
+func highlightTerms(text string, terms []string) []TextRange {
+	lower := []rune(lowerRunes(text))
+	ranges := []TextRange{}
+	for _, term := range terms {
+		t := []rune(term)
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if slices.Equal(lower[i:i+len(t)], t) {
+				ranges = append(ranges, TextRange{Start: i, End: i + len(t)})
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		return ranges
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	merged := []TextRange{ranges[0]}
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End {
+			last.End = max(last.End, r.End)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// lowerRunes lower cases rune by rune, so rune offsets stay the same as in the original text
+func lowerRunes(text string) string {
+	return strings.Map(unicode.ToLower, text)
+}
+
+// ParticipantFilterForPermissions returns the filter limiting the participants a user can see with the given permissions.
+// Each limiter entry is a set of field values that must all match, a participant is visible if any entry matches.
+// convert is called for every limiter value, e.g. to convert values of participant infos to their value type.
+// Returns nil if one of the permissions has no limiter.
+func ParticipantFilterForPermissions(permissions []Permission, convert func(field string, value string) (any, error)) (bson.M, error) {
+	entries := bson.A{}
+	for _, permission := range permissions {
+		if len(permission.Limiter) == 0 {
+			return nil, nil
+		}
+		for _, limiter := range permission.Limiter {
+			if len(limiter) == 0 {
+				return nil, nil
+			}
+			conditions := bson.M{}
+			for field, value := range limiter {
+				f, err := participantQueryField(field)
+				if err != nil {
+					return nil, fmt.Errorf("invalid limiter: %w", err)
+				}
+				converted, err := convert(field, value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid limiter: %w", err)
+				}
+				conditions[f] = bson.M{"$eq": converted}
+			}
+			entries = append(entries, conditions)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return bson.M{"$or": entries}, nil
+}
@@ -0,0 +1,84 @@
+package recruitmentlist
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (dbService *RecruitmentListDBService) collectionParticipantStatusChanges() *mongo.Collection {
+	return dbService.DBClient.Database(dbService.getDBName()).Collection(COL_NAME_PARTICIPANT_STATUS_CHANGES)
+}
+
+// ParticipantStatusChange records a change of the recruitment status of a participant
+type ParticipantStatusChange struct {
+	ID                primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	ParticipantID     string             `json:"participantId,omitempty" bson:"participantId,omitempty"`
+	RecruitmentListID string             `json:"recruitmentListId,omitempty" bson:"recruitmentListId,omitempty"`
+	OldStatus         string             `json:"oldStatus" bson:"oldStatus"`
+	NewStatus         string             `json:"newStatus" bson:"newStatus"`
+	ChangedAt         time.Time          `json:"changedAt" bson:"changedAt"`
+	ChangedBy         string             `json:"changedBy,omitempty" bson:"changedBy,omitempty"`
+}
+
+func (dbService *RecruitmentListDBService) createIndexesForParticipantStatusChanges() error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+	_, err := dbService.collectionParticipantStatusChanges().Indexes().CreateOne(
+		ctx,
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "recruitmentListId", Value: 1},
+				{Key: "participantId", Value: 1},
+				{Key: "changedAt", Value: 1},
+			},
+		},
+	)
+	return err
+}
+
+func (dbService *RecruitmentListDBService) SaveParticipantStatusChange(change ParticipantStatusChange) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	_, err := dbService.collectionParticipantStatusChanges().InsertOne(ctx, change)
+	return err
+}
+
+// IterateParticipantStatusChanges goes through the status history of the list's participants, per participant in the order of the changes
+func (dbService *RecruitmentListDBService) IterateParticipantStatusChanges(
+	rlID string,
+	callback func(change *ParticipantStatusChange) error,
+) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "participantId", Value: 1}, {Key: "changedAt", Value: 1}})
+	cur, err := dbService.collectionParticipantStatusChanges().Find(ctx, bson.M{"recruitmentListId": rlID}, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var change ParticipantStatusChange
+		if err := cur.Decode(&change); err != nil {
+			return err
+		}
+		if err := callback(&change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dbService *RecruitmentListDBService) DeleteParticipantStatusChangesByRecruitmentListID(rlID string) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	_, err := dbService.collectionParticipantStatusChanges().DeleteMany(ctx, bson.M{"recruitmentListId": rlID})
+	return err
+}
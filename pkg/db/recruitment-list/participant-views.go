@@ -0,0 +1,185 @@
+package recruitmentlist
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ParticipantView is a saved configuration of the participant table of a list
+type ParticipantView struct {
+	ID                primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	RecruitmentListID string             `json:"recruitmentListId,omitempty" bson:"recruitmentListId,omitempty"`
+	OwnerID           string             `json:"ownerId,omitempty" bson:"ownerId,omitempty"`
+	Name              string             `json:"name,omitempty" bson:"name,omitempty"`
+	Filter            *ParticipantQuery  `json:"filter,omitempty" bson:"filter,omitempty"`
+	Sort              *ParticipantSort   `json:"sort,omitempty" bson:"sort,omitempty"`
+	// visible participant info labels, in order
+	Columns  []string `json:"columns,omitempty" bson:"columns,omitempty"`
+	PageSize int64    `json:"pageSize,omitempty" bson:"pageSize,omitempty"`
+	// visible for all users of the list
+	Shared bool `json:"shared,omitempty" bson:"shared,omitempty"`
+	// default view of the list, only one per list and always shared
+	IsDefault bool      `json:"isDefault,omitempty" bson:"isDefault,omitempty"`
+	CreatedAt time.Time `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+func (dbService *RecruitmentListDBService) collectionParticipantViews() *mongo.Collection {
+	return dbService.DBClient.Database(dbService.getDBName()).Collection(COL_NAME_PARTICIPANT_VIEWS)
+}
+
+func (dbService *RecruitmentListDBService) createIndexesForParticipantViews() error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+	_, err := dbService.collectionParticipantViews().Indexes().CreateOne(
+		ctx,
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "recruitmentListId", Value: 1},
+				{Key: "ownerId", Value: 1},
+			},
+		},
+	)
+	return err
+}
+
+func (dbService *RecruitmentListDBService) CreateParticipantView(view ParticipantView) (*ParticipantView, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	view.ID = primitive.NilObjectID
+	view.IsDefault = false
+	view.CreatedAt = time.Now()
+	view.UpdatedAt = view.CreatedAt
+
+	_id, err := dbService.collectionParticipantViews().InsertOne(ctx, view)
+	if err != nil {
+		return nil, err
+	}
+	view.ID = _id.InsertedID.(primitive.ObjectID)
+	return &view, nil
+}
+
+// GetParticipantViewsForUser returns the views of the user and the shared views of the list
+func (dbService *RecruitmentListDBService) GetParticipantViewsForUser(rlID string, userID string) ([]ParticipantView, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{
+		"recruitmentListId": rlID,
+		"$or": bson.A{
+			bson.M{"ownerId": userID},
+			bson.M{"shared": true},
+		},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+
+	cur, err := dbService.collectionParticipantViews().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	views := []ParticipantView{}
+	if err := cur.All(ctx, &views); err != nil {
+		return nil, err
+	}
+	return views, nil
+}
+
+func (dbService *RecruitmentListDBService) GetParticipantViewByID(viewID string, rlID string) (*ParticipantView, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	_id, err := primitive.ObjectIDFromHex(viewID)
+	if err != nil {
+		return nil, err
+	}
+
+	var view ParticipantView
+	err = dbService.collectionParticipantViews().FindOne(ctx, bson.M{"_id": _id, "recruitmentListId": rlID}).Decode(&view)
+	return &view, err
+}
+
+// UpdateParticipantView saves the editable fields of the view, a view that is not shared anymore is no longer the default
+func (dbService *RecruitmentListDBService) UpdateParticipantView(view ParticipantView) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"name":      view.Name,
+			"filter":    view.Filter,
+			"sort":      view.Sort,
+			"columns":   view.Columns,
+			"pageSize":  view.PageSize,
+			"shared":    view.Shared,
+			"updatedAt": time.Now(),
+		},
+	}
+	if !view.Shared {
+		update["$unset"] = bson.M{"isDefault": 1}
+	}
+	_, err := dbService.collectionParticipantViews().UpdateOne(ctx, bson.M{"_id": view.ID}, update)
+	return err
+}
+
+// SetDefaultParticipantView makes the view the default of the list, an empty viewID removes the default.
+// Returns mongo.ErrNoDocuments and keeps the current default if the view is not a shared view of the list.
+func (dbService *RecruitmentListDBService) SetDefaultParticipantView(rlID string, viewID string) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	otherDefaults := bson.M{"recruitmentListId": rlID, "isDefault": true}
+	if viewID != "" {
+		_id, err := primitive.ObjectIDFromHex(viewID)
+		if err != nil {
+			return mongo.ErrNoDocuments
+		}
+		// the new default is set first, so the current one is only removed if the view can be the default
+		res, err := dbService.collectionParticipantViews().UpdateOne(
+			ctx,
+			bson.M{"_id": _id, "recruitmentListId": rlID, "shared": true},
+			bson.M{"$set": bson.M{"isDefault": true}},
+		)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		otherDefaults["_id"] = bson.M{"$ne": _id}
+	}
+
+	_, err := dbService.collectionParticipantViews().UpdateMany(
+		ctx,
+		otherDefaults,
+		bson.M{"$unset": bson.M{"isDefault": 1}},
+	)
+	return err
+}
+
+func (dbService *RecruitmentListDBService) DeleteParticipantView(viewID string) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	_id, err := primitive.ObjectIDFromHex(viewID)
+	if err != nil {
+		return err
+	}
+
+	_, err = dbService.collectionParticipantViews().DeleteOne(ctx, bson.M{"_id": _id})
+	return err
+}
+
+func (dbService *RecruitmentListDBService) DeleteParticipantViewsByRecruitmentListID(rlID string) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	_, err := dbService.collectionParticipantViews().DeleteMany(ctx, bson.M{"recruitmentListId": rlID})
+	return err
+}
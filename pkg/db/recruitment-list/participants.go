@@ -16,14 +16,28 @@ func (dbService *RecruitmentListDBService) collectionParticipants() *mongo.Colle
 }
 
 type Participant struct {
-	ID                primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	ParticipantID     string             `json:"participantId,omitempty" bson:"participantId,omitempty"`
-	RecruitmentListID string             `json:"recruitmentListId,omitempty" bson:"recruitmentListId,omitempty"`
-	IncludedAt        time.Time          `json:"includedAt,omitempty" bson:"includedAt,omitempty"`
-	IncludedBy        string             `json:"includedBy,omitempty" bson:"includedBy,omitempty"`
-	DeletedAt         *time.Time         `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
-	RecruitmentStatus string             `json:"recruitmentStatus" bson:"recruitmentStatus"`
-	Infos             map[string]any     `json:"infos,omitempty" bson:"infos,omitempty"`
+	ID                primitive.ObjectID   `json:"id,omitempty" bson:"_id,omitempty"`
+	ParticipantID     string               `json:"participantId,omitempty" bson:"participantId,omitempty"`
+	RecruitmentListID string               `json:"recruitmentListId,omitempty" bson:"recruitmentListId,omitempty"`
+	IncludedAt        time.Time            `json:"includedAt,omitempty" bson:"includedAt,omitempty"`
+	IncludedBy        string               `json:"includedBy,omitempty" bson:"includedBy,omitempty"`
+	DeletedAt         *time.Time           `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	DeletionReason    string               `json:"deletionReason,omitempty" bson:"deletionReason,omitempty"`
+	RecruitmentStatus string               `json:"recruitmentStatus" bson:"recruitmentStatus"`
+	Infos             map[string]any       `json:"infos,omitempty" bson:"infos,omitempty"`
+	DataSync          *ParticipantDataSync `json:"dataSync,omitempty" bson:"dataSync,omitempty"`
+	// only filled for API responses, stored in the participant info changes collection
+	InfoHistory []ParticipantInfoChange `json:"infoHistory,omitempty" bson:"-"`
+}
+
+// ParticipantDataSync holds how far the data of a participant has been synced
+type ParticipantDataSync struct {
+	// start of the last successful participant info update
+	InfosSyncedAt *time.Time `json:"infosSyncedAt,omitempty" bson:"infosSyncedAt,omitempty"`
+	// arrivedAt of the latest synced response per survey key
+	LastArrivedAt map[string]int64 `json:"lastArrivedAt,omitempty" bson:"lastArrivedAt,omitempty"`
+	// start of the last successful check for deleted or changed responses
+	ResponsesCheckedAt *time.Time `json:"responsesCheckedAt,omitempty" bson:"responsesCheckedAt,omitempty"`
 }
 
 func (dbService *RecruitmentListDBService) createIndexesForParticipants() error {
@@ -87,12 +101,72 @@ func (dbService *RecruitmentListDBService) GetParticipantByID(pid string, rlID s
 	return &participant, err
 }
 
+func (dbService *RecruitmentListDBService) GetParticipantByParticipantID(pid string, rlID string) (*Participant, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	var participant Participant
+	err := dbService.collectionParticipants().FindOne(ctx, bson.M{"participantId": pid, "recruitmentListId": rlID}).Decode(&participant)
+	return &participant, err
+}
+
+const (
+	DELETION_REASON_DELETED_IN_STUDY = "deleted in study DB"
+	DELETION_REASON_EXCLUDED         = "excluded by exclusion conditions"
+)
+
+// IsParticipantInAnyList returns true if the participant is in one of the lists and not deleted there
+func (dbService *RecruitmentListDBService) IsParticipantInAnyList(pid string, rlIDs []string) (bool, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	if len(rlIDs) == 0 {
+		return false, nil
+	}
+	filter := bson.M{
+		"participantId":     pid,
+		"recruitmentListId": bson.M{"$in": rlIDs},
+		"deletedAt":         nil,
+	}
+	count, err := dbService.collectionParticipants().CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+func (dbService *RecruitmentListDBService) CountParticipants(filter bson.M) (int64, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	return dbService.collectionParticipants().CountDocuments(ctx, filter)
+}
+
+// GetParticipantInOtherLists returns the entries of the participant in all lists except the given one
+func (dbService *RecruitmentListDBService) GetParticipantInOtherLists(pid string, rlID string) ([]Participant, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{
+		"participantId":     pid,
+		"recruitmentListId": bson.M{"$ne": rlID},
+	}
+	cur, err := dbService.collectionParticipants().Find(ctx, filter, options.Find().SetProjection(bson.M{"infos": 0}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	participants := []Participant{}
+	if err := cur.All(ctx, &participants); err != nil {
+		return nil, err
+	}
+	return participants, nil
+}
+
 func (dbService *RecruitmentListDBService) OnParticipantDeleted(p *Participant, rlID string, reason string) error {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
 	filter := bson.M{"participantId": p.ParticipantID, "recruitmentListId": rlID}
-	update := bson.M{"$set": bson.M{"deletedAt": time.Now()}, "$unset": bson.M{"infos": 1}}
+	update := bson.M{"$set": bson.M{"deletedAt": time.Now(), "deletionReason": reason}, "$unset": bson.M{"infos": 1}}
 	_, err := dbService.collectionParticipants().UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
@@ -105,6 +179,11 @@ func (dbService *RecruitmentListDBService) OnParticipantDeleted(p *Participant,
 		slog.Error("could not delete research data", slog.String("error", err.Error()))
 	}
 
+	// the history contains the removed infos
+	if err := dbService.DeleteParticipantInfoChanges(p.ParticipantID, rlID); err != nil {
+		slog.Error("could not delete participant info changes", slog.String("error", err.Error()))
+	}
+
 	// Add particpant note
 	_, err = dbService.CreateParticipantNote(
 		p.ID.Hex(),
@@ -149,14 +228,74 @@ func (dbService *RecruitmentListDBService) UpdateParticipantInfos(
 	return err
 }
 
+func (dbService *RecruitmentListDBService) UpdateParticipantInfosSyncedAt(
+	pid string,
+	rlID string,
+	syncedAt time.Time,
+) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{"participantId": pid, "recruitmentListId": rlID}
+	update := bson.M{"$set": bson.M{"dataSync.infosSyncedAt": syncedAt}}
+	_, err := dbService.collectionParticipants().UpdateOne(ctx, filter, update)
+	return err
+}
+
+// UpdateParticipantLastArrivedAt moves the response sync watermark of a survey forward (never backwards)
+func (dbService *RecruitmentListDBService) UpdateParticipantLastArrivedAt(
+	pid string,
+	rlID string,
+	surveyKey string,
+	lastArrivedAt int64,
+) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{"participantId": pid, "recruitmentListId": rlID}
+	update := bson.M{"$max": bson.M{"dataSync.lastArrivedAt." + surveyKey: lastArrivedAt}}
+	_, err := dbService.collectionParticipants().UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (dbService *RecruitmentListDBService) UpdateParticipantResponsesCheckedAt(
+	pid string,
+	rlID string,
+	checkedAt time.Time,
+) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{"participantId": pid, "recruitmentListId": rlID}
+	update := bson.M{"$set": bson.M{"dataSync.responsesCheckedAt": checkedAt}}
+	_, err := dbService.collectionParticipants().UpdateOne(ctx, filter, update)
+	return err
+}
+
+// ResetParticipantsDataSync removes the data sync state of all participants of the list, so everything is synced again
+func (dbService *RecruitmentListDBService) ResetParticipantsDataSync(rlID string) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{"recruitmentListId": rlID}
+	update := bson.M{"$unset": bson.M{"dataSync": 1}}
+	_, err := dbService.collectionParticipants().UpdateMany(ctx, filter, update)
+	return err
+}
+
 func (dbService *RecruitmentListDBService) IterateParticipantsByRecruitmentListID(
 	rlID string,
+	query bson.M,
 	callback func(participant *Participant) error,
 ) error {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
-	cur, err := dbService.collectionParticipants().Find(ctx, bson.M{"recruitmentListId": rlID})
+	filter := bson.M{"recruitmentListId": rlID}
+	if query != nil {
+		filter["$and"] = bson.A{query}
+	}
+	cur, err := dbService.findParticipants(ctx, rlID, filter, nil)
 	if err != nil {
 		return err
 	}
@@ -171,7 +310,45 @@ func (dbService *RecruitmentListDBService) IterateParticipantsByRecruitmentListI
 			return err
 		}
 	}
-	return nil
+	return cur.Err()
+}
+
+// IterateParticipantsByRecruitmentListIDAfter iterates the participants of a list in the order of their document IDs,
+// starting after the participant with the document ID afterID (from the beginning if empty)
+func (dbService *RecruitmentListDBService) IterateParticipantsByRecruitmentListIDAfter(
+	rlID string,
+	afterID string,
+	callback func(participant *Participant) error,
+) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{"recruitmentListId": rlID}
+	if afterID != "" {
+		_id, err := primitive.ObjectIDFromHex(afterID)
+		if err != nil {
+			return err
+		}
+		filter["_id"] = bson.M{"$gt": _id}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+
+	cur, err := dbService.collectionParticipants().Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var participant Participant
+		if err := cur.Decode(&participant); err != nil {
+			return err
+		}
+		if err := callback(&participant); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
 }
 
 func (dbService *RecruitmentListDBService) DeleteAllParticipantsByRecruitmentListID(rlID string) error {
@@ -202,12 +379,22 @@ type ParticipantFilter struct {
 	IncludedUntil     *time.Time
 	ParticipantID     string
 	RecruitmentStatus string
-	Infos             map[string]string
+	// exact values, converted to the value type of the info
+	Infos map[string]any
+	// inclusive ranges for number and date infos
+	InfoRanges map[string]InfoRange
+	// translated participant query, see ParticipantQueryFilter
+	Query bson.M
+}
+
+type InfoRange struct {
+	Min any
+	Max any
 }
 
 type ParticipantSort struct {
-	Field string
-	Order string
+	Field string `json:"field" bson:"field"`
+	Order string `json:"order" bson:"order"`
 }
 
 func (dbService *RecruitmentListDBService) GetParticipantsByRecruitmentListID(rlID string, page int64, limit int64,
@@ -217,6 +404,36 @@ func (dbService *RecruitmentListDBService) GetParticipantsByRecruitmentListID(rl
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
+	filter := participantFilterToBson(rlID, pFilter)
+
+	count, err := dbService.countParticipants(ctx, rlID, filter)
+	if err != nil {
+		return participants, paginationInfo, err
+	}
+
+	paginationInfo = prepPaginationInfos(
+		count,
+		page,
+		limit,
+	)
+
+	opts := options.Find()
+	opts.SetLimit(limit)
+	opts.SetSkip((page - 1) * limit)
+	opts.SetSort(participantSortToBson(sort))
+	cur, err := dbService.findParticipants(ctx, rlID, filter, opts)
+	if err != nil {
+		return nil, paginationInfo, err
+	}
+	defer cur.Close(ctx)
+
+	if err := cur.All(ctx, &participants); err != nil {
+		return nil, paginationInfo, err
+	}
+	return participants, paginationInfo, nil
+}
+
+func participantFilterToBson(rlID string, pFilter ParticipantFilter) bson.M {
 	filter := bson.M{"recruitmentListId": rlID}
 	if pFilter.IncludedSince != nil && pFilter.IncludedUntil != nil {
 		filter["includedAt"] = bson.M{"$gte": pFilter.IncludedSince, "$lte": pFilter.IncludedUntil}
@@ -242,38 +459,37 @@ func (dbService *RecruitmentListDBService) GetParticipantsByRecruitmentListID(rl
 		}
 		filter["infos."+key] = value
 	}
-
-	count, err := dbService.collectionParticipants().CountDocuments(ctx, filter)
-	if err != nil {
-		return participants, paginationInfo, err
+	if pFilter.Query != nil {
+		filter["$and"] = bson.A{pFilter.Query}
 	}
+	for key, infoRange := range pFilter.InfoRanges {
+		if key == "" {
+			continue
+		}
+		rangeFilter := bson.M{}
+		if infoRange.Min != nil {
+			rangeFilter["$gte"] = infoRange.Min
+		}
+		if infoRange.Max != nil {
+			rangeFilter["$lte"] = infoRange.Max
+		}
+		if len(rangeFilter) == 0 {
+			continue
+		}
+		if value, ok := filter["infos."+key]; ok {
+			rangeFilter["$eq"] = value
+		}
+		filter["infos."+key] = rangeFilter
+	}
+	return filter
+}
 
-	paginationInfo = prepPaginationInfos(
-		count,
-		page,
-		limit,
-	)
-
+func participantSortToBson(sort ParticipantSort) bson.D {
 	sortBy := bson.D{}
 	if sort.Order == "desc" {
 		sortBy = append(sortBy, bson.E{Key: sort.Field, Value: -1})
 	} else {
 		sortBy = append(sortBy, bson.E{Key: sort.Field, Value: 1})
 	}
-	sortBy = append(sortBy, bson.E{Key: "_id", Value: 1})
-
-	opts := options.Find()
-	opts.SetLimit(limit)
-	opts.SetSkip((page - 1) * limit)
-	opts.SetSort(sortBy)
-	cur, err := dbService.collectionParticipants().Find(ctx, filter, opts)
-	if err != nil {
-		return nil, paginationInfo, err
-	}
-	defer cur.Close(ctx)
-
-	if err := cur.All(ctx, &participants); err != nil {
-		return nil, paginationInfo, err
-	}
-	return participants, paginationInfo, nil
+	return append(sortBy, bson.E{Key: "_id", Value: 1})
 }
@@ -67,6 +67,19 @@ func (dbService *RecruitmentListDBService) UpdateRecruitmentListStudyActions(lis
 	return err
 }
 
+func (dbService *RecruitmentListDBService) UpdateRecruitmentListSyncPaused(listID string, paused bool) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+	_id, err := primitive.ObjectIDFromHex(listID)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"_id": _id}
+	update := bson.M{"$set": bson.M{"syncConfig.schedule.paused": paused}}
+	_, err = dbService.collectionRecruitmentLists().UpdateOne(ctx, filter, update)
+	return err
+}
+
 func (dbService *RecruitmentListDBService) GetRecruitmentListsInfos() ([]RecruitmentList, error) {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
@@ -78,6 +91,8 @@ func (dbService *RecruitmentListDBService) GetRecruitmentListsInfos() ([]Recruit
 		"description": 1,
 		"tags":        1,
 		"createdAt":   1,
+		// to show paused syncs
+		"syncConfig.schedule.paused": 1,
 	}
 	opts := options.Find()
 	opts.SetProjection(projection)
@@ -119,6 +134,17 @@ func (dbService *RecruitmentListDBService) FindAndExecuteOnRecruitmentLists(
 	return nil
 }
 
+// RemoveFromExcludeIfInLists removes the list from the excluding lists of all other lists
+func (dbService *RecruitmentListDBService) RemoveFromExcludeIfInLists(listID string) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{"participantInclusion.excludeIfInLists": listID}
+	update := bson.M{"$pull": bson.M{"participantInclusion.excludeIfInLists": listID}}
+	_, err := dbService.collectionRecruitmentLists().UpdateMany(ctx, filter, update)
+	return err
+}
+
 func (dbService *RecruitmentListDBService) DeleteRecruitmentListByID(listID string) error {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
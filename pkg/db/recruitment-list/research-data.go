@@ -18,6 +18,8 @@ type ResponseData struct {
 	SurveyKey         string                 `json:"surveyKey,omitempty" bson:"surveyKey,omitempty"`
 	ArrivedAt         int64                  `json:"arrivedAt,omitempty" bson:"arrivedAt,omitempty"`
 	Response          map[string]interface{} `json:"response,omitempty" bson:"response,omitempty"`
+	// hash of the response in the study DB, to detect changes
+	SourceHash string `json:"sourceHash,omitempty" bson:"sourceHash,omitempty"`
 }
 
 func (dbService *RecruitmentListDBService) collectionResearchData() *mongo.Collection {
@@ -42,24 +44,126 @@ func (dbService *RecruitmentListDBService) createIndexesForResearchData() error
 	if err != nil {
 		slog.Error("Error creating index for research data: ", slog.String("error", err.Error()))
 	}
+
+	// used by participant queries on responses
+	_, err = dbService.collectionResearchData().Indexes().CreateOne(
+		ctx,
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "recruitmentListId", Value: 1},
+				{Key: "participantId", Value: 1},
+				{Key: "surveyKey", Value: 1},
+			},
+		},
+	)
+	if err != nil {
+		slog.Error("Error creating index for research data: ", slog.String("error", err.Error()))
+	}
+
+	// used by exports reading the responses of a list grouped by participant
+	_, err = dbService.collectionResearchData().Indexes().CreateOne(
+		ctx,
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "recruitmentListId", Value: 1},
+				{Key: "participantId", Value: 1},
+				{Key: "arrivedAt", Value: 1},
+			},
+		},
+	)
+	if err != nil {
+		slog.Error("Error creating index for research data: ", slog.String("error", err.Error()))
+	}
 	return nil
 }
 
+// SaveResearchData upserts the entries by participantId, responseId and recruitmentListId,
+// so syncing the same responses again does not create duplicates. Returns the number of new entries.
 func (dbService *RecruitmentListDBService) SaveResearchData(
 	recruitmentListID string,
 	participantID string,
 	researchData []ResponseData,
-) error {
+) (int64, error) {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
-	generic := make([]interface{}, len(researchData))
+	if len(researchData) == 0 {
+		return 0, nil
+	}
+
+	models := make([]mongo.WriteModel, len(researchData))
 	for i, rd := range researchData {
-		generic[i] = rd
+		rd.ID = primitive.NilObjectID
+		filter := bson.M{
+			"participantId":     rd.ParticipantID,
+			"responseId":        rd.ResponseID,
+			"recruitmentListId": rd.RecruitmentListID,
+		}
+		models[i] = mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(rd).SetUpsert(true)
 	}
 
-	_, err := dbService.collectionResearchData().InsertMany(ctx, generic)
-	return err
+	opts := options.BulkWrite().SetOrdered(false)
+	res, err := dbService.collectionResearchData().BulkWrite(ctx, models, opts)
+	if err != nil {
+		return 0, err
+	}
+	return res.UpsertedCount, nil
+}
+
+// GetResearchDataSourceHashes returns the source hash by response ID of the participant's research data for a survey,
+// with arrivedAt between from and until
+func (dbService *RecruitmentListDBService) GetResearchDataSourceHashes(
+	recruitmentListID string,
+	participantID string,
+	surveyKey string,
+	from int64,
+	until int64,
+) (map[string]string, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{
+		"recruitmentListId": recruitmentListID,
+		"participantId":     participantID,
+		"surveyKey":         surveyKey,
+		"arrivedAt":         bson.M{"$gte": from, "$lte": until},
+	}
+	opts := options.Find().SetProjection(bson.M{"responseId": 1, "sourceHash": 1})
+	cur, err := dbService.collectionResearchData().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	hashes := make(map[string]string)
+	for cur.Next(ctx) {
+		var rd ResponseData
+		if err := cur.Decode(&rd); err != nil {
+			return nil, err
+		}
+		hashes[rd.ResponseID] = rd.SourceHash
+	}
+	return hashes, cur.Err()
+}
+
+func (dbService *RecruitmentListDBService) DeleteResearchDataByResponseIDs(
+	recruitmentListID string,
+	participantID string,
+	responseIDs []string,
+) (int64, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{
+		"recruitmentListId": recruitmentListID,
+		"participantId":     participantID,
+		"responseId":        bson.M{"$in": responseIDs},
+	}
+	res, err := dbService.collectionResearchData().DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
 }
 
 func (dbService *RecruitmentListDBService) DeleteResearchDataByRecruitmentListID(recruitmentListID string) error {
@@ -75,6 +179,8 @@ type ResponseDataInfo struct {
 	Count          int64  `json:"count,omitempty" bson:"count,omitempty"`
 	FirstArrivedAt int64  `json:"firstArrivedAt,omitempty" bson:"firstArrivedAt,omitempty"`
 	LastArrivedAt  int64  `json:"lastArrivedAt,omitempty" bson:"lastArrivedAt,omitempty"`
+	// only filled for stats, responses per period
+	Periods []PeriodCount `json:"periods,omitempty" bson:"-"`
 }
 
 func (dbService *RecruitmentListDBService) GetAvailableResponseDataInfos(
@@ -141,5 +247,76 @@ func (dbService *RecruitmentListDBService) IterateOnResponseData(
 			return err
 		}
 	}
-	return nil
+	return cur.Err()
+}
+
+// IterateParticipantsWithResponses iterates the participants of the list matching the query in the order of their participant IDs,
+// each with its research data matching responseFilter, oldest first. Both are read with one cursor each and merged.
+func (dbService *RecruitmentListDBService) IterateParticipantsWithResponses(
+	rlID string,
+	query bson.M,
+	responseFilter bson.M,
+	callback func(participant *Participant, responses []ResponseData) error,
+) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{"recruitmentListId": rlID}
+	if query != nil {
+		filter["$and"] = bson.A{query}
+	}
+	participantsCur, err := dbService.findParticipants(ctx, rlID, filter, options.Find().SetSort(bson.D{{Key: "participantId", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer participantsCur.Close(ctx)
+
+	responseFilter = bson.M{"$and": bson.A{responseFilter, bson.M{"recruitmentListId": rlID}}}
+	opts := options.Find().SetSort(bson.D{{Key: "participantId", Value: 1}, {Key: "arrivedAt", Value: 1}, {Key: "_id", Value: 1}})
+	responsesCur, err := dbService.collectionResearchData().Find(ctx, responseFilter, opts)
+	if err != nil {
+		return err
+	}
+	defer responsesCur.Close(ctx)
+
+	// the next response not yet passed to the callback
+	var next *ResponseData
+	nextResponse := func() error {
+		next = nil
+		for next == nil && responsesCur.Next(ctx) {
+			var responseData ResponseData
+			if err := responsesCur.Decode(&responseData); err != nil {
+				slog.Error("could not decode response data", slog.String("error", err.Error()))
+				continue
+			}
+			next = &responseData
+		}
+		return responsesCur.Err()
+	}
+	if err := nextResponse(); err != nil {
+		return err
+	}
+
+	for participantsCur.Next(ctx) {
+		var participant Participant
+		if err := participantsCur.Decode(&participant); err != nil {
+			return err
+		}
+
+		// both cursors are sorted by participant ID, so responses of participants not matching the query are skipped
+		responses := []ResponseData{}
+		for next != nil && next.ParticipantID <= participant.ParticipantID {
+			if next.ParticipantID == participant.ParticipantID {
+				responses = append(responses, *next)
+			}
+			if err := nextResponse(); err != nil {
+				return err
+			}
+		}
+
+		if err := callback(&participant, responses); err != nil {
+			return err
+		}
+	}
+	return participantsCur.Err()
 }
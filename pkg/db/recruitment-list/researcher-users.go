@@ -74,6 +74,24 @@ func (dbService *RecruitmentListDBService) UpdateResearcherUserIsAdmin(userID st
 	return err
 }
 
+// UpdateResearcherUserEncryptionPublicKey sets the public key of the user, an empty key removes it
+func (dbService *RecruitmentListDBService) UpdateResearcherUserEncryptionPublicKey(userID string, publicKey string) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	_id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"_id": _id}
+	update := bson.M{"$set": bson.M{"encryptionPublicKey": publicKey}}
+	if publicKey == "" {
+		update = bson.M{"$unset": bson.M{"encryptionPublicKey": ""}}
+	}
+	_, err = dbService.collectionResearcherUsers().UpdateOne(ctx, filter, update)
+	return err
+}
+
 func (dbService *RecruitmentListDBService) GetResearcherUserBySub(sub string) (*ResearcherUser, error) {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
@@ -0,0 +1,270 @@
+package recruitmentlist
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	STATS_INTERVAL_DAY  = "day"
+	STATS_INTERVAL_WEEK = "week"
+)
+
+type StatsOptions struct {
+	// day or week, weeks start on monday
+	Interval string
+	Since    time.Time
+	// IANA time zone the periods start in, UTC if empty
+	TimeZone string
+	// status values in funnel order, usually the customized recruitment status values of the list
+	StatusValues []string
+}
+
+type RecruitmentListStats struct {
+	Total int64 `json:"total"`
+	// not deleted
+	Active int64 `json:"active"`
+	// deleted for any reason, including exclusions
+	Deleted  int64 `json:"deleted"`
+	Excluded int64 `json:"excluded"`
+	// active participants per recruitment status, "" for no status
+	ByStatus        []StatusCount       `json:"byStatus"`
+	ByInclusionType InclusionTypeCounts `json:"byInclusionType"`
+	Inclusions      []PeriodCount       `json:"inclusions"`
+	// per survey, with the responses per period since the start of the stats
+	Responses []ResponseDataInfo `json:"responses"`
+	Funnel    []FunnelStep       `json:"funnel"`
+}
+
+type StatusCount struct {
+	Status string `json:"status" bson:"_id"`
+	Count  int64  `json:"count" bson:"count"`
+}
+
+// InclusionTypeCounts counts all participants by how they were included, auto by the sync or manual by a user
+type InclusionTypeCounts struct {
+	Auto   int64 `json:"auto"`
+	Manual int64 `json:"manual"`
+}
+
+type PeriodCount struct {
+	Start time.Time `json:"start" bson:"_id"`
+	Count int64     `json:"count" bson:"count"`
+}
+
+// FunnelStep counts the active participants that reached the status, assuming the status values are in the order
+// participants go through them. Conversion is the share of the previous step that reached this one.
+type FunnelStep struct {
+	Status     string  `json:"status"`
+	Count      int64   `json:"count"`
+	Conversion float64 `json:"conversion"`
+}
+
+// GetRecruitmentListStats aggregates the participants and responses of the list
+func (dbService *RecruitmentListDBService) GetRecruitmentListStats(rlID string, opts StatsOptions) (*RecruitmentListStats, error) {
+	stats := &RecruitmentListStats{}
+	if err := dbService.aggregateParticipantStats(rlID, opts, stats); err != nil {
+		return nil, err
+	}
+
+	responses, err := dbService.GetAvailableResponseDataInfos(rlID, "", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	periods, err := dbService.getResponseCountsPerPeriod(rlID, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range responses {
+		responses[i].Periods = periods[responses[i].SurveyKey]
+		if responses[i].Periods == nil {
+			responses[i].Periods = []PeriodCount{}
+		}
+	}
+	stats.Responses = responses
+	if stats.Responses == nil {
+		stats.Responses = []ResponseDataInfo{}
+	}
+
+	stats.Funnel = statusFunnel(opts.StatusValues, stats.ByStatus)
+	return stats, nil
+}
+
+func (opts StatsOptions) dateTrunc(date any) bson.M {
+	trunc := bson.M{
+		"date": date,
+		"unit": opts.Interval,
+	}
+	if opts.TimeZone != "" {
+		trunc["timezone"] = opts.TimeZone
+	}
+	if opts.Interval == STATS_INTERVAL_WEEK {
+		trunc["startOfWeek"] = "monday"
+	}
+	return bson.M{"$dateTrunc": trunc}
+}
+
+func (dbService *RecruitmentListDBService) aggregateParticipantStats(rlID string, opts StatsOptions, stats *RecruitmentListStats) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	isDeleted := bson.M{"$cond": bson.A{bson.M{"$ifNull": bson.A{"$deletedAt", false}}, 1, 0}}
+	pipeline := []bson.M{
+		{"$match": bson.M{"recruitmentListId": rlID}},
+		{"$facet": bson.M{
+			"counts": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":     nil,
+					"total":   bson.M{"$sum": 1},
+					"deleted": bson.M{"$sum": isDeleted},
+					"excluded": bson.M{"$sum": bson.M{"$cond": bson.A{
+						bson.M{"$eq": bson.A{"$deletionReason", DELETION_REASON_EXCLUDED}}, 1, 0,
+					}}},
+				}},
+			},
+			"byStatus": bson.A{
+				bson.M{"$match": bson.M{"deletedAt": nil}},
+				bson.M{"$group": bson.M{
+					"_id":   bson.M{"$ifNull": bson.A{"$recruitmentStatus", ""}},
+					"count": bson.M{"$sum": 1},
+				}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+			"byInclusionType": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":   bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$includedBy", "auto"}}, "auto", "manual"}},
+					"count": bson.M{"$sum": 1},
+				}},
+			},
+			"inclusions": bson.A{
+				bson.M{"$match": bson.M{"includedAt": bson.M{"$gte": opts.Since}}},
+				bson.M{"$group": bson.M{
+					"_id":   opts.dateTrunc("$includedAt"),
+					"count": bson.M{"$sum": 1},
+				}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+		}},
+	}
+
+	cursor, err := dbService.collectionParticipants().Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Counts []struct {
+			Total    int64 `bson:"total"`
+			Deleted  int64 `bson:"deleted"`
+			Excluded int64 `bson:"excluded"`
+		} `bson:"counts"`
+		ByStatus        []StatusCount `bson:"byStatus"`
+		ByInclusionType []struct {
+			Type  string `bson:"_id"`
+			Count int64  `bson:"count"`
+		} `bson:"byInclusionType"`
+		Inclusions []PeriodCount `bson:"inclusions"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return err
+	}
+
+	stats.ByStatus = []StatusCount{}
+	stats.Inclusions = []PeriodCount{}
+	if len(results) == 0 {
+		return nil
+	}
+	result := results[0]
+	if len(result.Counts) > 0 {
+		stats.Total = result.Counts[0].Total
+		stats.Deleted = result.Counts[0].Deleted
+		stats.Excluded = result.Counts[0].Excluded
+		stats.Active = stats.Total - stats.Deleted
+	}
+	if result.ByStatus != nil {
+		stats.ByStatus = result.ByStatus
+	}
+	for _, t := range result.ByInclusionType {
+		if t.Type == "auto" {
+			stats.ByInclusionType.Auto = t.Count
+		} else {
+			stats.ByInclusionType.Manual = t.Count
+		}
+	}
+	if result.Inclusions != nil {
+		stats.Inclusions = result.Inclusions
+	}
+	return nil
+}
+
+// getResponseCountsPerPeriod counts the responses per survey key and period since the start of the stats
+func (dbService *RecruitmentListDBService) getResponseCountsPerPeriod(rlID string, opts StatsOptions) (map[string][]PeriodCount, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"recruitmentListId": rlID,
+			"arrivedAt":         bson.M{"$gte": opts.Since.Unix()},
+		}},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"surveyKey": "$surveyKey",
+				"period":    opts.dateTrunc(bson.M{"$toDate": bson.M{"$multiply": bson.A{"$arrivedAt", 1000}}}),
+			},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$sort": bson.M{"_id.period": 1}},
+	}
+
+	cursor, err := dbService.collectionResearchData().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		ID struct {
+			SurveyKey string    `bson:"surveyKey"`
+			Period    time.Time `bson:"period"`
+		} `bson:"_id"`
+		Count int64 `bson:"count"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	periods := map[string][]PeriodCount{}
+	for _, r := range results {
+		periods[r.ID.SurveyKey] = append(periods[r.ID.SurveyKey], PeriodCount{Start: r.ID.Period, Count: r.Count})
+	}
+	return periods, nil
+}
+
+func statusFunnel(statusValues []string, byStatus []StatusCount) []FunnelStep {
+	counts := map[string]int64{}
+	for _, s := range byStatus {
+		counts[s.Status] = s.Count
+	}
+
+	funnel := make([]FunnelStep, len(statusValues))
+	var reached int64
+	for i := len(statusValues) - 1; i >= 0; i-- {
+		reached += counts[statusValues[i]]
+		funnel[i] = FunnelStep{Status: statusValues[i], Count: reached}
+	}
+	for i := range funnel {
+		if i == 0 {
+			if funnel[i].Count > 0 {
+				funnel[i].Conversion = 1
+			}
+			continue
+		}
+		if funnel[i-1].Count > 0 {
+			funnel[i].Conversion = float64(funnel[i].Count) / float64(funnel[i-1].Count)
+		}
+	}
+	return funnel
+}
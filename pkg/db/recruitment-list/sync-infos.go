@@ -1,6 +1,7 @@
 package recruitmentlist
 
 import (
+	"errors"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -17,16 +18,77 @@ type SyncInfo struct {
 	RecruitmentListID        string     `json:"recruitmentListId,omitempty" bson:"recruitmentListId,omitempty"`
 	ParticipantSyncStatus    string     `json:"participantSyncStatus,omitempty" bson:"participantSyncStatus,omitempty"`
 	ParticipantSyncStartedAt *time.Time `json:"participantSyncStartedAt,omitempty" bson:"participantSyncStartedAt,omitempty"`
+	// updated regularly while the participant sync is running, to detect syncs of killed processes
+	ParticipantSyncHeartbeatAt *time.Time `json:"participantSyncHeartbeatAt,omitempty" bson:"participantSyncHeartbeatAt,omitempty"`
 
-	DataSyncStatus    string     `json:"dataSyncStatus,omitempty" bson:"dataSyncStatus,omitempty"`
-	DataSyncStartedAt *time.Time `json:"dataSyncStartedAt,omitempty" bson:"dataSyncStartedAt,omitempty"`
+	DataSyncStatus      string              `json:"dataSyncStatus,omitempty" bson:"dataSyncStatus,omitempty"`
+	DataSyncStartedAt   *time.Time          `json:"dataSyncStartedAt,omitempty" bson:"dataSyncStartedAt,omitempty"`
+	DataSyncHeartbeatAt *time.Time          `json:"dataSyncHeartbeatAt,omitempty" bson:"dataSyncHeartbeatAt,omitempty"`
+	DataSyncCheckpoint  *DataSyncCheckpoint `json:"dataSyncCheckpoint,omitempty" bson:"dataSyncCheckpoint,omitempty"`
+	// stats of the current or last data sync run
+	DataSyncStats *DataSyncStats `json:"dataSyncStats,omitempty" bson:"dataSyncStats,omitempty"`
+
+	// set by the sync job's scheduler
+	NextRunAt *time.Time `json:"nextRunAt,omitempty" bson:"nextRunAt,omitempty"`
+}
+
+// DataSyncCheckpoint is kept while a data sync is running or interrupted, so an interrupted sync can resume
+type DataSyncCheckpoint struct {
+	// all participants up to this participant document ID (in ID order) have been synced
+	LastParticipantID string `json:"lastParticipantId,omitempty" bson:"lastParticipantId,omitempty"`
+	// start of the previous data sync, the remaining participants are synced from here
+	Since     *time.Time `json:"since,omitempty" bson:"since,omitempty"`
+	UpdatedAt time.Time  `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
 }
 
+type DataSyncStats struct {
+	ParticipantsSynced int `json:"participantsSynced" bson:"participantsSynced"`
+	// number of imported responses per survey key
+	ImportedResponses map[string]int64 `json:"importedResponses,omitempty" bson:"importedResponses,omitempty"`
+	// number of responses removed or updated because they were deleted or changed in the study DB, per survey key
+	DeletedResponses map[string]int64 `json:"deletedResponses,omitempty" bson:"deletedResponses,omitempty"`
+	UpdatedResponses map[string]int64 `json:"updatedResponses,omitempty" bson:"updatedResponses,omitempty"`
+	// number of participants whose sync failed and the last error of the run
+	FailedParticipants int        `json:"failedParticipants,omitempty" bson:"failedParticipants,omitempty"`
+	LastError          string     `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	FinishedAt         *time.Time `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"`
+}
+
+// HasErrors reports whether errors occurred during the data sync
+func (stats *DataSyncStats) HasErrors() bool {
+	return stats != nil && (stats.FailedParticipants > 0 || stats.LastError != "")
+}
+
+// ErrSyncNotReset is returned by the resets if the list has no sync info or the sync is running
+var ErrSyncNotReset = errors.New("sync info not found or sync is running")
+
 const (
-	SYNC_STATUS_IDLE    = "idle"
-	SYNC_STATUS_RUNNING = "running"
+	SYNC_STATUS_IDLE        = "idle"
+	SYNC_STATUS_RUNNING     = "running"
+	SYNC_STATUS_INTERRUPTED = "interrupted"
 )
 
+// IsParticipantSyncActive reports whether the participant sync is running and its last heartbeat is after staleBefore
+func (syncInfo *SyncInfo) IsParticipantSyncActive(staleBefore time.Time) bool {
+	return isSyncActive(syncInfo.ParticipantSyncStatus, syncInfo.ParticipantSyncStartedAt, syncInfo.ParticipantSyncHeartbeatAt, staleBefore)
+}
+
+// IsDataSyncActive reports whether the data sync is running and its last heartbeat is after staleBefore
+func (syncInfo *SyncInfo) IsDataSyncActive(staleBefore time.Time) bool {
+	return isSyncActive(syncInfo.DataSyncStatus, syncInfo.DataSyncStartedAt, syncInfo.DataSyncHeartbeatAt, staleBefore)
+}
+
+func isSyncActive(status string, startedAt *time.Time, heartbeatAt *time.Time, staleBefore time.Time) bool {
+	if status != SYNC_STATUS_RUNNING {
+		return false
+	}
+	lastSign := heartbeatAt
+	if lastSign == nil {
+		lastSign = startedAt
+	}
+	return lastSign == nil || !lastSign.Before(staleBefore)
+}
+
 func (dbService *RecruitmentListDBService) GetSyncInfoByRLID(recruitmentListID string) (*SyncInfo, error) {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
@@ -41,9 +103,11 @@ func (dbService *RecruitmentListDBService) StartParticipantSync(recruitmentListI
 	defer cancel()
 
 	filter := bson.M{"recruitmentListId": recruitmentListID}
+	now := time.Now()
 	update := bson.M{"$set": bson.M{
-		"participantSyncStatus":    SYNC_STATUS_RUNNING,
-		"participantSyncStartedAt": time.Now(),
+		"participantSyncStatus":      SYNC_STATUS_RUNNING,
+		"participantSyncStartedAt":   now,
+		"participantSyncHeartbeatAt": now,
 	}}
 	opts := options.Update()
 	opts.SetUpsert(true)
@@ -63,56 +127,208 @@ func (dbService *RecruitmentListDBService) FinishParticipantSync(recruitmentList
 	return err
 }
 
-func (dbService *RecruitmentListDBService) ResetParticipantSyncTime(recruitmentListID string) error {
+func (dbService *RecruitmentListDBService) UpdateParticipantSyncHeartbeat(recruitmentListID string) error {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
-	filter := bson.M{"recruitmentListId": recruitmentListID, "participantSyncStatus": SYNC_STATUS_IDLE}
+	filter := bson.M{"recruitmentListId": recruitmentListID}
 	update := bson.M{"$set": bson.M{
-		"participantSyncStartedAt": nil,
+		"participantSyncHeartbeatAt": time.Now(),
 	}}
 	_, err := dbService.collectionSyncInfos().UpdateOne(ctx, filter, update)
 	return err
 }
 
-func (dbService *RecruitmentListDBService) StartDataSync(recruitmentListID string) error {
+func (dbService *RecruitmentListDBService) InterruptParticipantSync(recruitmentListID string) error {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
 	filter := bson.M{"recruitmentListId": recruitmentListID}
 	update := bson.M{"$set": bson.M{
-		"dataSyncStatus":    SYNC_STATUS_RUNNING,
-		"dataSyncStartedAt": time.Now(),
+		"participantSyncStatus": SYNC_STATUS_INTERRUPTED,
+	}}
+	_, err := dbService.collectionSyncInfos().UpdateOne(ctx, filter, update)
+	return err
+}
+
+// ResetParticipantSyncTime works for every sync status except running, ErrSyncNotReset otherwise
+func (dbService *RecruitmentListDBService) ResetParticipantSyncTime(recruitmentListID string) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{"recruitmentListId": recruitmentListID, "participantSyncStatus": bson.M{"$ne": SYNC_STATUS_RUNNING}}
+	update := bson.M{"$set": bson.M{
+		"participantSyncStatus":    SYNC_STATUS_IDLE,
+		"participantSyncStartedAt": nil,
+	}}
+	res, err := dbService.collectionSyncInfos().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrSyncNotReset
+	}
+	return nil
+}
+
+// StartDataSync marks the data sync as running, since is the start of the previous data sync
+func (dbService *RecruitmentListDBService) StartDataSync(recruitmentListID string, since *time.Time) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{"recruitmentListId": recruitmentListID}
+	update := bson.M{"$set": bson.M{
+		"dataSyncStatus":      SYNC_STATUS_RUNNING,
+		"dataSyncStartedAt":   now,
+		"dataSyncHeartbeatAt": now,
+		"dataSyncCheckpoint": DataSyncCheckpoint{
+			Since:     since,
+			UpdatedAt: now,
+		},
+		"dataSyncStats": DataSyncStats{},
 	}}
 	opts := options.Update().SetUpsert(true)
 	_, err := dbService.collectionSyncInfos().UpdateOne(ctx, filter, update, opts)
 	return err
 }
 
-func (dbService *RecruitmentListDBService) FinishDataSync(recruitmentListID string) error {
+// ResumeDataSync marks an interrupted data sync as running again, keeping its start time and checkpoint
+func (dbService *RecruitmentListDBService) ResumeDataSync(recruitmentListID string) error {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
 	filter := bson.M{"recruitmentListId": recruitmentListID}
 	update := bson.M{"$set": bson.M{
-		"dataSyncStatus": SYNC_STATUS_IDLE,
+		"dataSyncStatus":      SYNC_STATUS_RUNNING,
+		"dataSyncHeartbeatAt": time.Now(),
 	}}
 	_, err := dbService.collectionSyncInfos().UpdateOne(ctx, filter, update)
 	return err
 }
 
-func (dbService *RecruitmentListDBService) ResetDataSyncTime(recruitmentListID string) error {
+// SaveDataSyncCheckpoint stores the last participant up to which all participants have been synced
+func (dbService *RecruitmentListDBService) SaveDataSyncCheckpoint(recruitmentListID string, lastParticipantID string, stats DataSyncStats) error {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
-	filter := bson.M{"recruitmentListId": recruitmentListID, "dataSyncStatus": SYNC_STATUS_IDLE}
+	now := time.Now()
+	filter := bson.M{"recruitmentListId": recruitmentListID}
 	update := bson.M{"$set": bson.M{
-		"dataSyncStartedAt": nil,
+		"dataSyncHeartbeatAt":                  now,
+		"dataSyncCheckpoint.lastParticipantId": lastParticipantID,
+		"dataSyncCheckpoint.updatedAt":         now,
+		"dataSyncStats":                        stats,
 	}}
 	_, err := dbService.collectionSyncInfos().UpdateOne(ctx, filter, update)
 	return err
 }
 
+func (dbService *RecruitmentListDBService) InterruptDataSync(recruitmentListID string) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{"recruitmentListId": recruitmentListID}
+	update := bson.M{"$set": bson.M{
+		"dataSyncStatus": SYNC_STATUS_INTERRUPTED,
+	}}
+	_, err := dbService.collectionSyncInfos().UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (dbService *RecruitmentListDBService) FinishDataSync(recruitmentListID string, stats DataSyncStats) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	now := time.Now()
+	stats.FinishedAt = &now
+	filter := bson.M{"recruitmentListId": recruitmentListID}
+	update := bson.M{
+		"$set": bson.M{
+			"dataSyncStatus": SYNC_STATUS_IDLE,
+			"dataSyncStats":  stats,
+		},
+		"$unset": bson.M{"dataSyncCheckpoint": 1},
+	}
+	_, err := dbService.collectionSyncInfos().UpdateOne(ctx, filter, update)
+	return err
+}
+
+// ResetDataSyncTime works for every sync status except running, ErrSyncNotReset otherwise
+func (dbService *RecruitmentListDBService) ResetDataSyncTime(recruitmentListID string) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{"recruitmentListId": recruitmentListID, "dataSyncStatus": bson.M{"$ne": SYNC_STATUS_RUNNING}}
+	update := bson.M{
+		"$set": bson.M{
+			"dataSyncStatus":    SYNC_STATUS_IDLE,
+			"dataSyncStartedAt": nil,
+		},
+		"$unset": bson.M{"dataSyncCheckpoint": 1},
+	}
+	res, err := dbService.collectionSyncInfos().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrSyncNotReset
+	}
+	return nil
+}
+
+func (dbService *RecruitmentListDBService) UpdateSyncNextRunAt(recruitmentListID string, nextRunAt *time.Time) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{"recruitmentListId": recruitmentListID}
+	update := bson.M{"$set": bson.M{"nextRunAt": nextRunAt}}
+	if nextRunAt == nil {
+		update = bson.M{"$unset": bson.M{"nextRunAt": 1}}
+	}
+	opts := options.Update().SetUpsert(true)
+	_, err := dbService.collectionSyncInfos().UpdateOne(ctx, filter, update, opts)
+	return err
+}
+
+// MarkStaleSyncsInterrupted marks running syncs without a heartbeat since staleBefore as interrupted,
+// returns the number of updated participant and data syncs
+func (dbService *RecruitmentListDBService) MarkStaleSyncsInterrupted(staleBefore time.Time) (int64, error) {
+	return dbService.markStaleSyncsInterrupted(bson.M{}, staleBefore)
+}
+
+// MarkStaleSyncsOfListInterrupted marks the running syncs of the list without a heartbeat since staleBefore as interrupted
+func (dbService *RecruitmentListDBService) MarkStaleSyncsOfListInterrupted(recruitmentListID string, staleBefore time.Time) error {
+	_, err := dbService.markStaleSyncsInterrupted(bson.M{"recruitmentListId": recruitmentListID}, staleBefore)
+	return err
+}
+
+func (dbService *RecruitmentListDBService) markStaleSyncsInterrupted(baseFilter bson.M, staleBefore time.Time) (int64, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	var updated int64
+	for _, prefix := range []string{"participantSync", "dataSync"} {
+		filter := bson.M{
+			prefix + "Status": SYNC_STATUS_RUNNING,
+			"$or": bson.A{
+				bson.M{prefix + "HeartbeatAt": bson.M{"$lt": staleBefore}},
+				bson.M{prefix + "HeartbeatAt": nil, prefix + "StartedAt": bson.M{"$lt": staleBefore}},
+			},
+		}
+		for key, value := range baseFilter {
+			filter[key] = value
+		}
+		update := bson.M{"$set": bson.M{prefix + "Status": SYNC_STATUS_INTERRUPTED}}
+		res, err := dbService.collectionSyncInfos().UpdateMany(ctx, filter, update)
+		if err != nil {
+			return updated, err
+		}
+		updated += res.ModifiedCount
+	}
+	return updated, nil
+}
+
 func (dbService *RecruitmentListDBService) DeleteSyncInfosByRecruitmentListID(recruitmentListID string) error {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
@@ -20,6 +20,8 @@ type ResearcherUser struct {
 	IsAdmin     bool               `json:"isAdmin,omitempty" bson:"isAdmin,omitempty"`
 	LastLoginAt time.Time          `json:"lastLoginAt,omitempty" bson:"lastLoginAt,omitempty"`
 	CreatedAt   time.Time          `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	// age public key, downloads can be encrypted for it
+	EncryptionPublicKey string `json:"encryptionPublicKey,omitempty" bson:"encryptionPublicKey,omitempty"`
 }
 
 type Session struct {
@@ -52,6 +54,8 @@ type ParticipantInclusion struct {
 	Type               string               `json:"type,omitempty" bson:"type,omitempty"`
 	AutoConfig         *InclusionAutoConfig `json:"autoConfig,omitempty" bson:"autoConfig,omitempty"`
 	NotificationEmails []string             `json:"notificationEmails,omitempty" bson:"notificationEmails,omitempty"`
+	// IDs of recruitment lists of the same study, participants in one of them (not deleted) are not included
+	ExcludeIfInLists []string `json:"excludeIfInLists,omitempty" bson:"excludeIfInLists,omitempty"`
 }
 
 // if any of the Participant info fields with the given key equals the given value, the participant will be excluded
@@ -63,10 +67,64 @@ type ExclusionCondition struct {
 type MappingType string
 
 const (
-	MappingTypeDefault   MappingType = "default"   // Use value as is
-	MappingTypeJSON      MappingType = "json"      // Parse as JSON
-	MappingTypeKey2Value MappingType = "key2value" // Use key-value mapping
-	MappingTypeTs2Date   MappingType = "ts2date"   // Parse as date
+	MappingTypeDefault        MappingType = "default"        // Use value as is
+	MappingTypeJSON           MappingType = "json"           // Parse as JSON
+	MappingTypeKey2Value      MappingType = "key2value"      // Use key-value mapping
+	MappingTypeTs2Date        MappingType = "ts2date"        // Parse as date, optionally with dateFormat and timeZone
+	MappingTypeMultiKey2Value MappingType = "multiKey2value" // Key-value mapping for each of the separated values
+	MappingTypeDate2Age       MappingType = "date2age"       // Age in years from a timestamp or date
+	MappingTypeBucket         MappingType = "bucket"         // Label of the numeric range the value is in
+	MappingTypeRegexExtract   MappingType = "regexExtract"   // First capture group (or match) of pattern
+	MappingTypeRegexReplace   MappingType = "regexReplace"   // Replace matches of pattern with replacement
+	MappingTypeMask           MappingType = "mask"           // Mask all but the last keepLast characters
+)
+
+// MappingOptions configure the mapping types beyond key2value
+type MappingOptions struct {
+	// Go layout for ts2date (default "2006-Jan-02"), also used to parse dates for date2age
+	DateFormat string `json:"dateFormat,omitempty" bson:"dateFormat,omitempty"`
+	// IANA time zone for ts2date, e.g. "Europe/Berlin" (default: time zone of the server)
+	TimeZone string `json:"timeZone,omitempty" bson:"timeZone,omitempty"`
+	// separator of multiKey2value (default ",")
+	Separator   string          `json:"separator,omitempty" bson:"separator,omitempty"`
+	Buckets     []MappingBucket `json:"buckets,omitempty" bson:"buckets,omitempty"`
+	Pattern     string          `json:"pattern,omitempty" bson:"pattern,omitempty"`
+	Replacement string          `json:"replacement,omitempty" bson:"replacement,omitempty"`
+	KeepLast    int             `json:"keepLast,omitempty" bson:"keepLast,omitempty"`
+	// character used by mask (default "*")
+	MaskChar string `json:"maskChar,omitempty" bson:"maskChar,omitempty"`
+}
+
+// MappingBucket is a numeric range with inclusive Min and exclusive Max, an empty bound is open
+type MappingBucket struct {
+	Min   *float64 `json:"min,omitempty" bson:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty" bson:"max,omitempty"`
+	Label string   `json:"label,omitempty" bson:"label,omitempty"`
+}
+
+type InfoValueType string
+
+const (
+	InfoValueTypeString  InfoValueType = "string"  // Default
+	InfoValueTypeNumber  InfoValueType = "number"  // Stored as double
+	InfoValueTypeDate    InfoValueType = "date"    // Stored as date, from timestamps or formatted dates
+	InfoValueTypeBoolean InfoValueType = "boolean" // Stored as bool
+	InfoValueTypeList    InfoValueType = "list"    // Stored as array of strings, split by the mapping separator (default ",")
+)
+
+type SourceType string
+
+const (
+	SourceTypeFlagValue           SourceType = "flagValue"           // Participant flag, sourceKey is the flag key
+	SourceTypeConfidentialData    SourceType = "confidentialData"    // Confidential response, sourceKey is <itemKey>-<slotKey>
+	SourceTypeResponseData        SourceType = "responseData"        // Latest response, sourceKey is the response column
+	SourceTypeStudyStatus         SourceType = "studyStatus"         // Study status of the participant
+	SourceTypeEnteredAt           SourceType = "enteredAt"           // Timestamp the participant entered the study
+	SourceTypeLastSubmission      SourceType = "lastSubmission"      // Timestamp of the last submission, sourceKey is the survey key
+	SourceTypeResponseCount       SourceType = "responseCount"       // Number of responses, sourceKey is the survey key
+	SourceTypeReportData          SourceType = "reportData"          // Latest report, sourceKey is <reportKey>.<dataKey>
+	SourceTypeParticipantMessages SourceType = "participantMessages" // Number of scheduled messages, sourceKey is the message type (all if empty)
+	SourceTypeComputed            SourceType = "computed"            // Expression over other participant infos, sourceKey is the expression
 )
 
 type Mapping struct {
@@ -75,13 +133,18 @@ type Mapping struct {
 }
 
 type ParticipantInfo struct {
-	ID            string      `json:"id,omitempty" bson:"id,omitempty"`
-	Label         string      `json:"label,omitempty" bson:"label,omitempty"`
-	SourceType    string      `json:"sourceType,omitempty" bson:"sourceType,omitempty"`
-	SourceKey     string      `json:"sourceKey,omitempty" bson:"sourceKey,omitempty"`
-	ShowInPreview bool        `json:"showInPreview,omitempty" bson:"showInPreview,omitempty"`
-	MappingType   MappingType `json:"mappingType,omitempty" bson:"mappingType,omitempty"`
-	Mapping       []Mapping   `json:"mapping,omitempty" bson:"mapping,omitempty"`
+	ID             string          `json:"id,omitempty" bson:"id,omitempty"`
+	Label          string          `json:"label,omitempty" bson:"label,omitempty"`
+	SourceType     SourceType      `json:"sourceType,omitempty" bson:"sourceType,omitempty"`
+	SourceKey      string          `json:"sourceKey,omitempty" bson:"sourceKey,omitempty"`
+	ShowInPreview  bool            `json:"showInPreview,omitempty" bson:"showInPreview,omitempty"`
+	MappingType    MappingType     `json:"mappingType,omitempty" bson:"mappingType,omitempty"`
+	Mapping        []Mapping       `json:"mapping,omitempty" bson:"mapping,omitempty"`
+	MappingOptions *MappingOptions `json:"mappingOptions,omitempty" bson:"mappingOptions,omitempty"`
+	// type the value is stored as after mapping, string if empty
+	ValueType InfoValueType `json:"valueType,omitempty" bson:"valueType,omitempty"`
+	// notify the list's notification emails when the value of a participant changes
+	NotifyOnChange bool `json:"notifyOnChange,omitempty" bson:"notifyOnChange,omitempty"`
 }
 
 type ResearchData struct {
@@ -108,6 +171,30 @@ type StudyAction struct {
 	Description   string `json:"description,omitempty" bson:"description,omitempty"`
 }
 
+// SyncSchedule defines when the sync job's scheduler runs the sync for a list.
+// Either Cron (standard 5 field cron expression) or Interval (duration string, e.g. "6h") should be set.
+// If both are empty, the scheduler's default schedule is used.
+type SyncSchedule struct {
+	Cron     string `json:"cron,omitempty" bson:"cron,omitempty"`
+	Interval string `json:"interval,omitempty" bson:"interval,omitempty"`
+	Paused   bool   `json:"paused,omitempty" bson:"paused,omitempty"`
+}
+
+type SyncConfig struct {
+	// upper limit for participants synced in parallel for this list, 0 means use the sync job's default
+	MaxParallelParticipants int           `json:"maxParallelParticipants,omitempty" bson:"maxParallelParticipants,omitempty"`
+	Schedule                *SyncSchedule `json:"schedule,omitempty" bson:"schedule,omitempty"`
+	// remove synced responses that were deleted in the study DB
+	DetectDeletedResponses bool `json:"detectDeletedResponses,omitempty" bson:"detectDeletedResponses,omitempty"`
+	// also update synced responses that were changed in the study DB (reads all responses on every check)
+	DetectEditedResponses bool `json:"detectEditedResponses,omitempty" bson:"detectEditedResponses,omitempty"`
+	// minimum time between two checks for deleted or changed responses of a participant (duration string, e.g. "24h"),
+	// responses are checked on every sync if empty
+	ResponseCheckInterval string `json:"responseCheckInterval,omitempty" bson:"responseCheckInterval,omitempty"`
+	// add a note to the participant when synced responses were removed or updated
+	NoteOnResponseChanges bool `json:"noteOnResponseChanges,omitempty" bson:"noteOnResponseChanges,omitempty"`
+}
+
 type RecruitmentList struct {
 	ID                   primitive.ObjectID    `json:"id,omitempty" bson:"_id,omitempty"`
 	Name                 string                `json:"name,omitempty" bson:"name,omitempty"`
@@ -120,4 +207,5 @@ type RecruitmentList struct {
 	ParticipantData      ParticipantDataConfig `json:"participantData,omitempty" bson:"participantData,omitempty"`
 	Customization        Customization         `json:"customization,omitempty" bson:"customization,omitempty"`
 	StudyActions         []StudyAction         `json:"studyActions,omitempty" bson:"studyActions,omitempty"`
+	SyncConfig           SyncConfig            `json:"syncConfig,omitempty" bson:"syncConfig,omitempty"`
 }
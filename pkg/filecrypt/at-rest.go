@@ -0,0 +1,219 @@
+// Package filecrypt encrypts stored files with a server key and creates password-protected ZIP files.
+package filecrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encrypted files start with the header (magic, version and nonce prefix), followed by chunks of
+// at most chunkSize bytes, each sealed with AES-256-GCM. The nonce of a chunk is the prefix, the chunk
+// counter and a flag for the last chunk, so chunks can neither be reordered nor cut off unnoticed.
+const (
+	KeySize = 32
+
+	magic           = "RLFS"
+	version         = 1
+	noncePrefixSize = 7
+	headerSize      = len(magic) + 1 + noncePrefixSize
+	chunkSize       = 64 * 1024
+	tagSize         = 16
+)
+
+var ErrInvalidFile = errors.New("invalid or corrupted encrypted file")
+
+// ParseKey decodes a base64 encoded key of KeySize bytes
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// PlaintextSize returns the size of the content of an encrypted file with the given size
+func PlaintextSize(encryptedSize int64) int64 {
+	data := encryptedSize - int64(headerSize)
+	chunks := (data + chunkSize + tagSize - 1) / (chunkSize + tagSize)
+	if chunks == 0 {
+		chunks = 1
+	}
+	return max(data-chunks*tagSize, 0)
+}
+
+type writer struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	closed  bool
+}
+
+// NewWriter encrypts everything written to it, Close must be called to write the last chunk
+func NewWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	header := append([]byte(magic), version)
+	if _, err := w.Write(append(header, prefix...)); err != nil {
+		return nil, err
+	}
+
+	return &writer{
+		w:      w,
+		aead:   aead,
+		prefix: prefix,
+		buf:    make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (ew *writer) Write(p []byte) (int, error) {
+	if ew.closed {
+		return 0, errors.New("write to closed writer")
+	}
+	n := 0
+	for len(p) > 0 {
+		// a full chunk is only sealed once more data follows, the last chunk is sealed by Close
+		if len(ew.buf) == chunkSize {
+			if err := ew.seal(false); err != nil {
+				return n, err
+			}
+		}
+		c := copy(ew.buf[len(ew.buf):chunkSize], p)
+		ew.buf = ew.buf[:len(ew.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (ew *writer) Close() error {
+	if ew.closed {
+		return nil
+	}
+	ew.closed = true
+	return ew.seal(true)
+}
+
+func (ew *writer) seal(last bool) error {
+	out := ew.aead.Seal(nil, nonce(ew.prefix, ew.counter, last), ew.buf, nil)
+	ew.counter++
+	ew.buf = ew.buf[:0]
+	_, err := ew.w.Write(out)
+	return err
+}
+
+type reader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	chunk   []byte
+	done    bool
+}
+
+// NewReader decrypts a file written by a writer of the same key
+func NewReader(r io.Reader, key []byte) (io.Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrInvalidFile
+	}
+	if !bytes.Equal(header[:len(magic)], []byte(magic)) || header[len(magic)] != version {
+		return nil, ErrInvalidFile
+	}
+
+	return &reader{
+		r:      bufio.NewReaderSize(r, chunkSize+tagSize),
+		aead:   aead,
+		prefix: header[len(magic)+1:],
+		chunk:  make([]byte, chunkSize+tagSize),
+	}, nil
+}
+
+func (dr *reader) Read(p []byte) (int, error) {
+	for len(dr.buf) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.buf)
+	dr.buf = dr.buf[n:]
+	return n, nil
+}
+
+func (dr *reader) open() error {
+	n, err := io.ReadFull(dr.r, dr.chunk)
+	last := false
+	switch err {
+	case nil:
+		if _, err := dr.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF:
+		last = true
+	case io.EOF:
+		// the last chunk was not marked as such, the file is truncated
+		return ErrInvalidFile
+	default:
+		return err
+	}
+
+	plain, err := dr.aead.Open(dr.chunk[:0], nonce(dr.prefix, dr.counter, last), dr.chunk[:n], nil)
+	if err != nil {
+		return ErrInvalidFile
+	}
+	dr.counter++
+	dr.buf = plain
+	dr.done = last
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func nonce(prefix []byte, counter uint32, last bool) []byte {
+	n := make([]byte, 0, noncePrefixSize+5)
+	n = append(n, prefix...)
+	n = binary.BigEndian.AppendUint32(n, counter)
+	if last {
+		return append(n, 1)
+	}
+	return append(n, 0)
+}
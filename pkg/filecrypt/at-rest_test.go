@@ -0,0 +1,128 @@
+package filecrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func encrypt(t *testing.T, key []byte, plain []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, key)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	// written in uneven pieces, so chunks are filled across writes
+	for len(plain) > 0 {
+		n := min(len(plain), 10000)
+		if _, err := w.Write(plain[:n]); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		plain = plain[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(key []byte, encrypted []byte) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(encrypted), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := testKey(t)
+
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "empty", size: 0},
+		{name: "small", size: 100},
+		{name: "one chunk", size: chunkSize},
+		{name: "two chunks", size: 2 * chunkSize},
+		{name: "partial last chunk", size: 2*chunkSize + 1},
+		{name: "one byte short of a chunk", size: chunkSize - 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := make([]byte, tt.size)
+			rand.Read(plain)
+
+			encrypted := encrypt(t, key, plain)
+			if got := PlaintextSize(int64(len(encrypted))); got != int64(tt.size) {
+				t.Errorf("PlaintextSize = %d, want %d", got, tt.size)
+			}
+
+			decrypted, err := decrypt(key, encrypted)
+			if err != nil {
+				t.Fatalf("decrypt: %v", err)
+			}
+			if !bytes.Equal(decrypted, plain) {
+				t.Errorf("decrypted content differs")
+			}
+		})
+	}
+}
+
+func TestTamperedFiles(t *testing.T) {
+	key := testKey(t)
+	plain := make([]byte, 3*chunkSize)
+	rand.Read(plain)
+	encrypted := encrypt(t, key, plain)
+	sealedChunk := chunkSize + tagSize
+
+	chunk := func(i int) []byte {
+		return encrypted[headerSize+i*sealedChunk : headerSize+(i+1)*sealedChunk]
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{name: "header only", content: encrypted[:headerSize]},
+		{name: "truncated in header", content: encrypted[:headerSize-1]},
+		{name: "last chunk missing", content: encrypted[:headerSize+2*sealedChunk]},
+		{name: "truncated in last chunk", content: encrypted[:len(encrypted)-1]},
+		{name: "truncated in first chunk", content: encrypted[:headerSize+100]},
+		{name: "reordered chunks", content: bytes.Join([][]byte{encrypted[:headerSize], chunk(1), chunk(0), chunk(2)}, nil)},
+		{name: "chunk repeated", content: bytes.Join([][]byte{encrypted[:headerSize], chunk(0), chunk(0), chunk(2)}, nil)},
+		{name: "appended data", content: append(bytes.Clone(encrypted), 0)},
+		{name: "flipped bit", content: func() []byte {
+			c := bytes.Clone(encrypted)
+			c[headerSize+sealedChunk+10] ^= 1
+			return c
+		}()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decrypt(key, tt.content); !errors.Is(err, ErrInvalidFile) {
+				t.Errorf("expected ErrInvalidFile, got %v", err)
+			}
+		})
+	}
+
+	t.Run("other key", func(t *testing.T) {
+		if _, err := decrypt(testKey(t), encrypted); !errors.Is(err, ErrInvalidFile) {
+			t.Errorf("expected ErrInvalidFile, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,168 @@
+package filecrypt
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// WinZip AES encryption (AE-1) with 256 bit keys, supported by 7-Zip, WinZip and most archive tools
+// (but not by the built-in ZIP support of Windows).
+const (
+	MinPasswordLength = 8
+
+	methodWinZipAES  = 99
+	aesExtraID       = 0x9901
+	aesVendorVersion = 1
+	aesStrength256   = 3
+	aesSaltSize      = 16
+	aesKeySize       = 32
+	aesVerifierSize  = 2
+	aesAuthCodeSize  = 10
+	aesKeyIterations = 1000
+	flagEncrypted    = 0x1
+)
+
+type passwordZipWriter struct {
+	zw    *zip.Writer
+	entry io.Writer
+}
+
+// NewPasswordZipWriter writes everything written to it as the only file of a ZIP encrypted with the password.
+// Close must be called to complete the ZIP.
+func NewPasswordZipWriter(w io.Writer, fileName string, password string) (io.WriteCloser, error) {
+	if len(password) < MinPasswordLength {
+		return nil, errors.New("password is too short")
+	}
+
+	zw := zip.NewWriter(w)
+	zw.RegisterCompressor(methodWinZipAES, func(out io.Writer) (io.WriteCloser, error) {
+		return newAESEntryWriter(out, password)
+	})
+
+	extra := make([]byte, 0, 11)
+	extra = binary.LittleEndian.AppendUint16(extra, aesExtraID)
+	extra = binary.LittleEndian.AppendUint16(extra, 7)
+	extra = binary.LittleEndian.AppendUint16(extra, aesVendorVersion)
+	extra = append(extra, 'A', 'E', aesStrength256)
+	extra = binary.LittleEndian.AppendUint16(extra, zip.Deflate)
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     fileName,
+		Method:   methodWinZipAES,
+		Flags:    flagEncrypted,
+		Extra:    extra,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &passwordZipWriter{zw: zw, entry: entry}, nil
+}
+
+func (pw *passwordZipWriter) Write(p []byte) (int, error) {
+	return pw.entry.Write(p)
+}
+
+func (pw *passwordZipWriter) Close() error {
+	return pw.zw.Close()
+}
+
+// aesEntryWriter compresses the file content and writes salt, password verifier, the encrypted data and the authentication code
+type aesEntryWriter struct {
+	flate *flate.Writer
+	enc   *aesCTRWriter
+}
+
+func newAESEntryWriter(out io.Writer, password string) (io.WriteCloser, error) {
+	salt := make([]byte, aesSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	keys := pbkdf2.Key([]byte(password), salt, aesKeyIterations, 2*aesKeySize+aesVerifierSize, sha1.New)
+	block, err := aes.NewCipher(keys[:aesKeySize])
+	if err != nil {
+		return nil, err
+	}
+
+	// the zip writer creates the compressor before writing the file header, so salt and verifier are written with the first data
+	enc := &aesCTRWriter{
+		w:      out,
+		header: append(salt, keys[2*aesKeySize:]...),
+		block:  block,
+		mac:    hmac.New(sha1.New, keys[aesKeySize:2*aesKeySize]),
+	}
+	fw, err := flate.NewWriter(enc, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	return &aesEntryWriter{flate: fw, enc: enc}, nil
+}
+
+func (ew *aesEntryWriter) Write(p []byte) (int, error) {
+	return ew.flate.Write(p)
+}
+
+func (ew *aesEntryWriter) Close() error {
+	if err := ew.flate.Close(); err != nil {
+		return err
+	}
+	if err := ew.enc.writeHeader(); err != nil {
+		return err
+	}
+	_, err := ew.enc.w.Write(ew.enc.mac.Sum(nil)[:aesAuthCodeSize])
+	return err
+}
+
+// aesCTRWriter encrypts in counter mode with a little endian counter starting at 1, as WinZip does,
+// and authenticates the encrypted data
+type aesCTRWriter struct {
+	w io.Writer
+	// salt and password verifier, nil once written
+	header  []byte
+	block   cipher.Block
+	mac     hash.Hash
+	counter uint64
+	stream  [aes.BlockSize]byte
+	used    int
+}
+
+func (cw *aesCTRWriter) writeHeader() error {
+	if cw.header == nil {
+		return nil
+	}
+	_, err := cw.w.Write(cw.header)
+	cw.header = nil
+	return err
+}
+
+func (cw *aesCTRWriter) Write(p []byte) (int, error) {
+	if err := cw.writeHeader(); err != nil {
+		return 0, err
+	}
+	out := make([]byte, len(p))
+	for i := range p {
+		if cw.counter == 0 || cw.used == aes.BlockSize {
+			cw.counter++
+			var counterBlock [aes.BlockSize]byte
+			binary.LittleEndian.PutUint64(counterBlock[:], cw.counter)
+			cw.block.Encrypt(cw.stream[:], counterBlock[:])
+			cw.used = 0
+		}
+		out[i] = p[i] ^ cw.stream[cw.used]
+		cw.used++
+	}
+	cw.mac.Write(out)
+	return cw.w.Write(out)
+}
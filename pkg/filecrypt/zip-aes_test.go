@@ -0,0 +1,99 @@
+package filecrypt
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func writePasswordZip(t *testing.T, fileName string, password string, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewPasswordZipWriter(&buf, fileName, password)
+	if err != nil {
+		t.Fatalf("NewPasswordZipWriter: %v", err)
+	}
+	if _, err := w.Write(content); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestPasswordZipStructure(t *testing.T) {
+	if _, err := NewPasswordZipWriter(&bytes.Buffer{}, "export.csv", "short"); err == nil {
+		t.Error("expected error for short password")
+	}
+
+	content := []byte("a,b\n1,2\n")
+	archive := writePasswordZip(t, "export.csv", "correct horse", content)
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("zip.NewReader: %v", err)
+	}
+	if len(zr.File) != 1 {
+		t.Fatalf("got %d files, want 1", len(zr.File))
+	}
+	f := zr.File[0]
+	if f.Name != "export.csv" || f.Method != methodWinZipAES || f.Flags&flagEncrypted == 0 {
+		t.Errorf("unexpected header: name %q, method %d, flags %x", f.Name, f.Method, f.Flags)
+	}
+	if f.UncompressedSize64 != uint64(len(content)) {
+		t.Errorf("uncompressed size = %d, want %d", f.UncompressedSize64, len(content))
+	}
+	// salt, verifier, at least one byte of compressed data and the authentication code
+	if f.CompressedSize64 < aesSaltSize+aesVerifierSize+1+aesAuthCodeSize {
+		t.Errorf("compressed size %d is too small", f.CompressedSize64)
+	}
+	if !bytes.Contains(f.Extra, []byte{0x01, 0x99, 7, 0, aesVendorVersion, 0, 'A', 'E', aesStrength256}) {
+		t.Errorf("AES extra field missing: %x", f.Extra)
+	}
+}
+
+// TestPasswordZipBsdtar reads the ZIP with libarchive, which supports WinZip AES. Skipped without bsdtar.
+func TestPasswordZipBsdtar(t *testing.T) {
+	bsdtar, err := exec.LookPath("bsdtar")
+	if err != nil {
+		t.Skip("bsdtar not available")
+	}
+
+	random := make([]byte, 100000)
+	rand.Read(random)
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{name: "empty", content: []byte{}},
+		{name: "text", content: bytes.Repeat([]byte("participant,status\n"), 1000)},
+		{name: "random", content: []byte(base64.StdEncoding.EncodeToString(random))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "export.zip")
+			if err := os.WriteFile(path, writePasswordZip(t, "export.csv", "correct horse", tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := exec.Command(bsdtar, "-xOf", path, "--passphrase", "correct horse").Output()
+			if err != nil {
+				t.Fatalf("bsdtar: %v", err)
+			}
+			if !bytes.Equal(out, tt.content) {
+				t.Errorf("extracted %d bytes differ from the %d written", len(out), len(tt.content))
+			}
+
+			if err := exec.Command(bsdtar, "-xOf", path, "--passphrase", "wrong password").Run(); err == nil {
+				t.Error("expected bsdtar to fail with the wrong password")
+			}
+		})
+	}
+}
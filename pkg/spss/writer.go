@@ -0,0 +1,318 @@
+// Package spss writes uncompressed SPSS system files (.sav) with variable and value labels.
+package spss
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Format int32
+
+const (
+	FORMAT_NUMBER   Format = 5
+	FORMAT_DATETIME Format = 22
+
+	formatString Format = 1
+)
+
+const (
+	MEASURE_NOMINAL = 1
+	MEASURE_ORDINAL = 2
+	MEASURE_SCALE   = 3
+)
+
+const (
+	// longest string variable without very long string records
+	MaxStringWidth = 255
+
+	maxVariableLabelLength = 255
+	maxValueLabelLength    = 120
+	maxNameLength          = 64
+
+	// seconds between the start of the gregorian calendar (SPSS dates) and the unix epoch
+	gregorianToUnixSeconds = 12219379200
+)
+
+var reservedNames = []string{"ALL", "AND", "BY", "EQ", "GE", "GT", "LE", "LT", "NE", "NOT", "OR", "TO", "WITH"}
+
+type Variable struct {
+	// turned into a valid, unique SPSS name
+	Name  string
+	Label string
+	// 0 for numeric variables, the width in bytes (up to MaxStringWidth) for string variables
+	Width int
+	// display format of numeric variables, FORMAT_NUMBER if not set
+	Format   Format
+	Decimals int
+	Measure  int
+	// only for numeric variables
+	ValueLabels []ValueLabel
+}
+
+type ValueLabel struct {
+	Value float64
+	Label string
+}
+
+// Writer writes the dictionary when created and then one case per call of WriteCase
+type Writer struct {
+	w    *bufio.Writer
+	vars []Variable
+}
+
+func NewWriter(w io.Writer, vars []Variable, fileLabel string, createdAt time.Time) (*Writer, error) {
+	if len(vars) == 0 {
+		return nil, errors.New("no variables")
+	}
+	for i := range vars {
+		if vars[i].Width < 0 || vars[i].Width > MaxStringWidth {
+			return nil, fmt.Errorf("invalid width of variable %s: %d", vars[i].Name, vars[i].Width)
+		}
+		if vars[i].Width > 0 && len(vars[i].ValueLabels) > 0 {
+			return nil, fmt.Errorf("value labels of string variable %s are not supported", vars[i].Name)
+		}
+	}
+
+	sw := &Writer{w: bufio.NewWriter(w), vars: vars}
+	if err := sw.writeDictionary(fileLabel, createdAt); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+// WriteCase writes one value per variable: nil for missing, numbers or time.Time for numeric and strings for string variables
+func (sw *Writer) WriteCase(values []any) error {
+	if len(values) != len(sw.vars) {
+		return fmt.Errorf("expected %d values, got %d", len(sw.vars), len(values))
+	}
+	for i, v := range sw.vars {
+		if v.Width > 0 {
+			s := ""
+			switch typedValue := values[i].(type) {
+			case nil:
+			case string:
+				s = typedValue
+			default:
+				return fmt.Errorf("unexpected value for string variable %s: %T", v.Name, values[i])
+			}
+			if _, err := sw.w.WriteString(padded(truncate(s, v.Width), segments(v.Width)*8)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var f float64
+		switch typedValue := values[i].(type) {
+		case nil:
+			f = -math.MaxFloat64
+		case float64:
+			f = typedValue
+		case int64:
+			f = float64(typedValue)
+		case int:
+			f = float64(typedValue)
+		case time.Time:
+			f = float64(typedValue.Unix()+gregorianToUnixSeconds) + float64(typedValue.Nanosecond())/1e9
+		default:
+			return fmt.Errorf("unexpected value for numeric variable %s: %T", v.Name, values[i])
+		}
+		if err := binary.Write(sw.w, binary.LittleEndian, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sw *Writer) Flush() error {
+	return sw.w.Flush()
+}
+
+func (sw *Writer) writeDictionary(fileLabel string, createdAt time.Time) error {
+	caseSize := 0
+	for _, v := range sw.vars {
+		caseSize += segments(v.Width)
+	}
+
+	// header
+	sw.w.WriteString("$FL2")
+	sw.w.WriteString(padded("@(#) SPSS DATA FILE recruitment-list-backend", 60))
+	sw.writeInt32(2, int32(caseSize), 0, 0, -1)
+	binary.Write(sw.w, binary.LittleEndian, float64(100))
+	sw.w.WriteString(createdAt.Format("02 Jan 06"))
+	sw.w.WriteString(createdAt.Format("15:04:05"))
+	sw.w.WriteString(padded(truncate(fileLabel, 64), 64))
+	sw.w.Write([]byte{0, 0, 0})
+
+	// variables
+	names := uniqueNames(sw.vars)
+	longNames := make([]string, len(sw.vars))
+	for i, v := range sw.vars {
+		shortName := "V" + strconv.Itoa(i+1)
+		longNames[i] = shortName + "=" + names[i]
+
+		format := int32(formatString)<<16 | int32(v.Width)<<8
+		if v.Width == 0 {
+			f := v.Format
+			if f == 0 {
+				f = FORMAT_NUMBER
+			}
+			// SPSS requires fewer decimals than the width
+			width, decimals := max(12, v.Decimals+2), v.Decimals
+			if f == FORMAT_DATETIME {
+				width, decimals = 20, 0
+			}
+			format = int32(f)<<16 | int32(width)<<8 | int32(decimals)
+		}
+
+		label := truncate(v.Label, maxVariableLabelLength)
+		hasLabel := int32(0)
+		if label != "" {
+			hasLabel = 1
+		}
+		sw.writeInt32(2, int32(v.Width), hasLabel, 0, format, format)
+		sw.w.WriteString(padded(shortName, 8))
+		if label != "" {
+			sw.writeInt32(int32(len(label)))
+			sw.w.WriteString(padded(label, (len(label)+3)/4*4))
+		}
+		for s := 1; s < segments(v.Width); s++ {
+			sw.writeInt32(2, -1, 0, 0, 0, 0)
+			sw.w.WriteString(padded("", 8))
+		}
+	}
+
+	// value labels
+	index := 1
+	for _, v := range sw.vars {
+		if len(v.ValueLabels) > 0 {
+			sw.writeInt32(3, int32(len(v.ValueLabels)))
+			for _, valueLabel := range v.ValueLabels {
+				label := truncate(valueLabel.Label, maxValueLabelLength)
+				binary.Write(sw.w, binary.LittleEndian, valueLabel.Value)
+				sw.w.WriteByte(byte(len(label)))
+				sw.w.WriteString(padded(label, (len(label)+1+7)/8*8-1))
+			}
+			sw.writeInt32(4, 1, int32(index))
+		}
+		index += segments(v.Width)
+	}
+
+	// machine integer info, with UTF-8 as character code
+	sw.writeInt32(7, 3, 4, 8, 1, 0, 0, -1, 1, 1, 2, 65001)
+	// machine floating point info: system missing, highest and lowest value
+	sw.writeInt32(7, 4, 8, 3)
+	binary.Write(sw.w, binary.LittleEndian, []uint64{0xffefffffffffffff, 0x7fefffffffffffff, 0xffeffffffffffffe})
+
+	// variable display parameters: measure, width and alignment
+	sw.writeInt32(7, 11, 4, int32(3*len(sw.vars)))
+	for _, v := range sw.vars {
+		measure := v.Measure
+		alignment := int32(1)
+		if measure == 0 {
+			measure = MEASURE_SCALE
+			if v.Width > 0 || len(v.ValueLabels) > 0 {
+				measure = MEASURE_NOMINAL
+			}
+		}
+		if v.Width > 0 {
+			alignment = 0
+		}
+		sw.writeInt32(int32(measure), int32(min(max(v.Width, 8), 40)), alignment)
+	}
+
+	longNamesRecord := strings.Join(longNames, "\t")
+	sw.writeInt32(7, 13, 1, int32(len(longNamesRecord)))
+	sw.w.WriteString(longNamesRecord)
+
+	sw.writeInt32(7, 20, 1, int32(len("UTF-8")))
+	sw.w.WriteString("UTF-8")
+
+	// end of dictionary
+	sw.writeInt32(999, 0)
+
+	// bufio keeps the first write error
+	return sw.w.Flush()
+}
+
+func (sw *Writer) writeInt32(values ...int32) {
+	binary.Write(sw.w, binary.LittleEndian, values)
+}
+
+// uniqueNames turns the variable names into valid SPSS names that are unique regardless of case
+func uniqueNames(vars []Variable) []string {
+	names := make([]string, len(vars))
+	used := map[string]bool{}
+	for i, v := range vars {
+		name := validName(v.Name)
+		candidate := name
+		for n := 2; used[strings.ToUpper(candidate)]; n++ {
+			suffix := "_" + strconv.Itoa(n)
+			candidate = truncate(name, maxNameLength-len(suffix)) + suffix
+		}
+		used[strings.ToUpper(candidate)] = true
+		names[i] = candidate
+	}
+	return names
+}
+
+func validName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r):
+			b.WriteRune(r)
+		case unicode.IsDigit(r) || r == '.' || r == '_' || r == '$' || r == '#' || r == '@':
+			if i == 0 {
+				b.WriteRune('v')
+			}
+			b.WriteRune(r)
+		default:
+			if i == 0 {
+				b.WriteRune('v')
+			}
+			b.WriteRune('_')
+		}
+	}
+	valid := strings.TrimRight(truncate(b.String(), maxNameLength), "._")
+	if valid == "" {
+		return "v"
+	}
+	for _, reserved := range reservedNames {
+		if strings.EqualFold(valid, reserved) {
+			return "v" + valid
+		}
+	}
+	return valid
+}
+
+func segments(width int) int {
+	if width == 0 {
+		return 1
+	}
+	return (width + 7) / 8
+}
+
+// truncate cuts s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func padded(s string, n int) string {
+	s = truncate(s, n)
+	return s + strings.Repeat(" ", n-len(s))
+}
@@ -0,0 +1,282 @@
+package spss
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+type savVariable struct {
+	width  int32
+	name   string
+	label  string
+	format int32
+}
+
+type savValueLabels struct {
+	labels   map[float64]string
+	varIndex []int32
+}
+
+type savFile struct {
+	product    string
+	caseSize   int32
+	bias       float64
+	date       string
+	time       string
+	fileLabel  string
+	variables  []savVariable
+	valueLabel []savValueLabels
+	extensions map[int32][]byte
+	data       []byte
+}
+
+// readSav decodes the header and dictionary records of an uncompressed system file, the rest is returned as data
+func readSav(t *testing.T, content []byte) savFile {
+	t.Helper()
+	r := bytes.NewReader(content)
+
+	readInt32 := func() int32 {
+		var v int32
+		if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
+			t.Fatalf("reading int32: %v", err)
+		}
+		return v
+	}
+	readString := func(n int) string {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatalf("reading %d bytes: %v", n, err)
+		}
+		return string(b)
+	}
+
+	if magic := readString(4); magic != "$FL2" {
+		t.Fatalf("unexpected magic %q", magic)
+	}
+	f := savFile{extensions: map[int32][]byte{}}
+	f.product = readString(60)
+	if layout := readInt32(); layout != 2 {
+		t.Fatalf("unexpected layout code %d", layout)
+	}
+	f.caseSize = readInt32()
+	if compression := readInt32(); compression != 0 {
+		t.Fatalf("unexpected compression %d", compression)
+	}
+	readInt32() // weight index
+	if cases := readInt32(); cases != -1 {
+		t.Fatalf("unexpected number of cases %d", cases)
+	}
+	binary.Read(r, binary.LittleEndian, &f.bias)
+	f.date = readString(9)
+	f.time = readString(8)
+	f.fileLabel = readString(64)
+	readString(3)
+
+	for {
+		switch recordType := readInt32(); recordType {
+		case 2:
+			v := savVariable{width: readInt32()}
+			hasLabel := readInt32()
+			if missing := readInt32(); missing != 0 {
+				t.Fatalf("unexpected missing values %d", missing)
+			}
+			v.format = readInt32()
+			if write := readInt32(); write != v.format {
+				t.Fatalf("print and write format differ: %d, %d", v.format, write)
+			}
+			v.name = readString(8)
+			if hasLabel == 1 {
+				length := int(readInt32())
+				v.label = readString((length + 3) / 4 * 4)[:length]
+			}
+			f.variables = append(f.variables, v)
+		case 3:
+			labels := savValueLabels{labels: map[float64]string{}}
+			count := readInt32()
+			for range count {
+				var value float64
+				binary.Read(r, binary.LittleEndian, &value)
+				length, _ := r.ReadByte()
+				labels.labels[value] = readString((int(length)+1+7)/8*8 - 1)[:length]
+			}
+			if next := readInt32(); next != 4 {
+				t.Fatalf("value labels not followed by variable index record: %d", next)
+			}
+			for range readInt32() {
+				labels.varIndex = append(labels.varIndex, readInt32())
+			}
+			f.valueLabel = append(f.valueLabel, labels)
+		case 7:
+			subtype := readInt32()
+			size := readInt32()
+			count := readInt32()
+			f.extensions[subtype] = []byte(readString(int(size * count)))
+		case 999:
+			readInt32()
+			f.data, _ = io.ReadAll(r)
+			return f
+		default:
+			t.Fatalf("unexpected record type %d", recordType)
+		}
+	}
+}
+
+func TestWriterDictionary(t *testing.T) {
+	createdAt := time.Date(2024, 3, 9, 14, 5, 30, 0, time.UTC)
+	vars := []Variable{
+		{Name: "pid", Label: "Participant", Width: 20},
+		{Name: "gender", Label: "Gender", ValueLabels: []ValueLabel{{Value: 1, Label: "female"}, {Value: 2, Label: "male"}}},
+		{Name: "arrivedAt", Format: FORMAT_DATETIME},
+		{Name: "code", Width: 3},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, vars, "Test export", createdAt)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	arrivedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := w.WriteCase([]any{"a participant id longer than the width", 1, arrivedAt, "é1"}); err != nil {
+		t.Fatalf("WriteCase: %v", err)
+	}
+	if err := w.WriteCase([]any{nil, nil, nil, nil}); err != nil {
+		t.Fatalf("WriteCase: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	f := readSav(t, buf.Bytes())
+
+	if !strings.HasPrefix(f.product, "@(#) SPSS DATA FILE") {
+		t.Errorf("unexpected product %q", f.product)
+	}
+	// pid takes three segments, the other variables one each
+	if f.caseSize != 6 {
+		t.Errorf("case size = %d, want 6", f.caseSize)
+	}
+	if f.bias != 100 {
+		t.Errorf("bias = %v, want 100", f.bias)
+	}
+	if f.date != "09 Mar 24" || f.time != "14:05:30" {
+		t.Errorf("creation date = %q %q", f.date, f.time)
+	}
+	if strings.TrimRight(f.fileLabel, " ") != "Test export" {
+		t.Errorf("file label = %q", f.fileLabel)
+	}
+
+	wantVariables := []savVariable{
+		{width: 20, name: "V1      ", label: "Participant", format: 1<<16 | 20<<8},
+		{width: -1, name: "        ", format: 0},
+		{width: -1, name: "        ", format: 0},
+		{width: 0, name: "V2      ", label: "Gender", format: 5<<16 | 12<<8},
+		{width: 0, name: "V3      ", format: 22<<16 | 20<<8},
+		{width: 3, name: "V4      ", format: 1<<16 | 3<<8},
+	}
+	if len(f.variables) != len(wantVariables) {
+		t.Fatalf("got %d variable records, want %d", len(f.variables), len(wantVariables))
+	}
+	for i, want := range wantVariables {
+		if f.variables[i] != want {
+			t.Errorf("variable record %d = %+v, want %+v", i, f.variables[i], want)
+		}
+	}
+
+	if len(f.valueLabel) != 1 {
+		t.Fatalf("got %d value label records, want 1", len(f.valueLabel))
+	}
+	// the dictionary index of gender follows the three segments of pid
+	if got := f.valueLabel[0].varIndex; len(got) != 1 || got[0] != 4 {
+		t.Errorf("value label variable index = %v, want [4]", got)
+	}
+	if got := f.valueLabel[0].labels; len(got) != 2 || got[1] != "female" || got[2] != "male" {
+		t.Errorf("value labels = %v", got)
+	}
+
+	if got := string(f.extensions[13]); got != "V1=pid\tV2=gender\tV3=arrivedAt\tV4=code" {
+		t.Errorf("long variable names = %q", got)
+	}
+	if got := string(f.extensions[20]); got != "UTF-8" {
+		t.Errorf("character encoding = %q", got)
+	}
+
+	if len(f.data) != 2*int(f.caseSize)*8 {
+		t.Fatalf("got %d bytes of case data, want %d", len(f.data), 2*f.caseSize*8)
+	}
+	readFloat := func(b []byte) float64 {
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+
+	first := f.data[:48]
+	if got := string(first[:24]); got != "a participant id lon    " {
+		t.Errorf("pid = %q", got)
+	}
+	if got := readFloat(first[24:32]); got != 1 {
+		t.Errorf("gender = %v", got)
+	}
+	// SPSS counts seconds since 14 Oct 1582
+	if got := readFloat(first[32:40]); got != 13923543845 {
+		t.Errorf("arrivedAt = %v, want 13923543845", got)
+	}
+	if got := string(first[40:48]); got != "é1     " {
+		t.Errorf("code = %q", got)
+	}
+
+	second := f.data[48:]
+	if got := string(second[:24]); got != strings.Repeat(" ", 24) {
+		t.Errorf("missing pid = %q", got)
+	}
+	if got := readFloat(second[24:32]); got != -math.MaxFloat64 {
+		t.Errorf("missing gender = %v", got)
+	}
+	if got := readFloat(second[32:40]); got != -math.MaxFloat64 {
+		t.Errorf("missing arrivedAt = %v", got)
+	}
+}
+
+func TestWriteCaseTruncatesStrings(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, []Variable{{Name: "s", Width: 4}}, "", time.Now())
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	headerLength := buf.Len()
+	// does not split the two byte character at the width
+	if err := w.WriteCase([]any{"abcé"}); err != nil {
+		t.Fatalf("WriteCase: %v", err)
+	}
+	w.Flush()
+
+	if got := buf.String()[headerLength:]; got != "abc     " {
+		t.Errorf("case = %q, want %q", got, "abc     ")
+	}
+}
+
+func TestNumericFormatWidth(t *testing.T) {
+	tests := []struct {
+		decimals  int
+		wantWidth int32
+	}{
+		{decimals: 0, wantWidth: 12},
+		{decimals: 10, wantWidth: 12},
+		{decimals: 11, wantWidth: 13},
+		{decimals: 16, wantWidth: 18},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if _, err := NewWriter(&buf, []Variable{{Name: "n", Decimals: tt.decimals}}, "", time.Now()); err != nil {
+			t.Fatalf("NewWriter: %v", err)
+		}
+		f := readSav(t, buf.Bytes())
+		want := 5<<16 | tt.wantWidth<<8 | int32(tt.decimals)
+		if got := f.variables[0].format; got != want {
+			t.Errorf("decimals %d: format = %x, want %x", tt.decimals, got, want)
+		}
+	}
+}
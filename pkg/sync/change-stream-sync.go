@@ -0,0 +1,391 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	gosync "sync"
+	"time"
+
+	sDB "github.com/case-framework/case-backend/pkg/db/study"
+	studyTypes "github.com/case-framework/case-backend/pkg/study/types"
+	rDB "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// same naming as used by the study DB service
+	studyDBNameSuffix                 = "_studyDB"
+	studyParticipantsCollectionSuffix = "_" + sDB.COLLECTION_NAME_SUFFIX_PARTICIPANTS
+	studyResponsesCollectionSuffix    = "_" + sDB.COLLECTION_NAME_SUFFIX_RESPONSES
+
+	changeStreamRetryInterval = 30 * time.Second
+	changeStreamSessionMaxAge = 30 * time.Minute
+
+	// server error codes signaling that the stream cannot be resumed from the stored token
+	errCodeChangeStreamFatal       = 280
+	errCodeChangeStreamHistoryLost = 286
+)
+
+type changeStreamEvent struct {
+	OperationType string `bson:"operationType"`
+	NS            struct {
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	FullDocument bson.Raw `bson:"fullDocument"`
+}
+
+type changeStreamSyncer struct {
+	rdb               *rDB.RecruitmentListDBService
+	studyDB           *sDB.StudyDBService
+	instanceID        string
+	globalStudySecret string
+}
+
+// RunChangeStreamSync watches the participant and response collections of every study used by a recruitment list
+// and applies changes to the affected lists as they happen. The set of watched studies is refreshed periodically.
+// If a stream cannot be resumed (e.g., the resume token expired), the batch sync is run for the study's lists first.
+// Blocks until ctx is cancelled.
+func RunChangeStreamSync(
+	ctx context.Context,
+	rdb *rDB.RecruitmentListDBService,
+	studyDB *sDB.StudyDBService,
+	instanceID string,
+	globalStudySecret string,
+	refreshInterval time.Duration,
+) {
+	syncer := &changeStreamSyncer{
+		rdb:               rdb,
+		studyDB:           studyDB,
+		instanceID:        instanceID,
+		globalStudySecret: globalStudySecret,
+	}
+
+	var wg gosync.WaitGroup
+	watchers := make(map[string]context.CancelFunc)
+
+	refreshWatchers := func() {
+		studyKeys, err := syncer.getStudyKeysInUse()
+		if err != nil {
+			slog.Error("could not get study keys of recruitment lists", slog.String("error", err.Error()))
+			return
+		}
+
+		for studyKey, cancel := range watchers {
+			if _, ok := studyKeys[studyKey]; !ok {
+				slog.Info("stop watching study", slog.String("studyKey", studyKey))
+				cancel()
+				delete(watchers, studyKey)
+			}
+		}
+
+		for studyKey := range studyKeys {
+			if _, ok := watchers[studyKey]; ok {
+				continue
+			}
+			slog.Info("start watching study", slog.String("studyKey", studyKey))
+			watchCtx, cancel := context.WithCancel(ctx)
+			watchers[studyKey] = cancel
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				syncer.watchStudy(watchCtx, studyKey)
+			}()
+		}
+	}
+
+	refreshWatchers()
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			for _, cancel := range watchers {
+				cancel()
+			}
+			wg.Wait()
+			return
+		case <-ticker.C:
+			refreshWatchers()
+		}
+	}
+}
+
+func (s *changeStreamSyncer) getStudyKeysInUse() (map[string]struct{}, error) {
+	studyKeys := make(map[string]struct{})
+	err := s.rdb.FindAndExecuteOnRecruitmentLists(bson.M{}, func(list *rDB.RecruitmentList) error {
+		if list.ParticipantInclusion.StudyKey != "" {
+			studyKeys[list.ParticipantInclusion.StudyKey] = struct{}{}
+		}
+		return nil
+	})
+	return studyKeys, err
+}
+
+func (s *changeStreamSyncer) getRecruitmentListsForStudy(studyKey string) ([]*rDB.RecruitmentList, error) {
+	var lists []*rDB.RecruitmentList
+	err := s.rdb.FindAndExecuteOnRecruitmentLists(bson.M{"participantInclusion.studyKey": studyKey}, func(list *rDB.RecruitmentList) error {
+		lists = append(lists, list)
+		return nil
+	})
+	return lists, err
+}
+
+func (s *changeStreamSyncer) watchStudy(ctx context.Context, studyKey string) {
+	streamID := s.instanceID + "/" + studyKey
+	db := s.studyDB.DBClient.Database(s.studyDB.DBNamePrefix + s.instanceID + studyDBNameSuffix)
+	participantsColl := studyKey + studyParticipantsCollectionSuffix
+	responsesColl := studyKey + studyResponsesCollectionSuffix
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"ns.coll":       bson.M{"$in": []string{participantsColl, responsesColl}},
+			"operationType": bson.M{"$in": []string{"insert", "update", "replace"}},
+		}}},
+	}
+
+	batchSyncDone := false
+	for ctx.Err() == nil {
+		opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+
+		storedToken, err := s.rdb.GetChangeStreamToken(streamID)
+		if err == nil && len(storedToken.ResumeToken) > 0 {
+			opts.SetResumeAfter(storedToken.ResumeToken)
+		} else if !batchSyncDone {
+			// store the current stream position before the batch sync, so changes made while it runs
+			// are applied from the stream afterwards and everything before is covered by the batch sync
+			if err := s.saveStreamStart(ctx, db, pipeline, streamID); err != nil {
+				s.handleStreamError(ctx, streamID, err)
+				continue
+			}
+			s.runBatchSync(ctx, studyKey)
+			batchSyncDone = true
+			continue
+		}
+
+		stream, err := db.Watch(ctx, pipeline, opts)
+		if err != nil {
+			if s.handleStreamError(ctx, streamID, err) {
+				batchSyncDone = false
+			}
+			continue
+		}
+
+		if token := stream.ResumeToken(); token != nil {
+			if err := s.rdb.SaveChangeStreamToken(streamID, token); err != nil {
+				slog.Error("could not save change stream token", slog.String("streamID", streamID), slog.String("error", err.Error()))
+			}
+		}
+
+		session := newChangeStreamSession()
+		sessionCreatedAt := time.Now()
+
+		for stream.Next(ctx) {
+			if time.Since(sessionCreatedAt) > changeStreamSessionMaxAge {
+				// pick up changed survey definitions
+				session = newChangeStreamSession()
+				sessionCreatedAt = time.Now()
+			}
+
+			var event changeStreamEvent
+			if err := stream.Decode(&event); err != nil {
+				slog.Error("could not decode change event", slog.String("studyKey", studyKey), slog.String("error", err.Error()))
+				continue
+			}
+
+			switch event.NS.Coll {
+			case participantsColl:
+				s.onParticipantChanged(session, studyKey, event)
+			case responsesColl:
+				s.onResponseChanged(session, studyKey, event)
+			}
+
+			if err := s.rdb.SaveChangeStreamToken(streamID, stream.ResumeToken()); err != nil {
+				slog.Error("could not save change stream token", slog.String("streamID", streamID), slog.String("error", err.Error()))
+			}
+		}
+
+		err = stream.Err()
+		if closeErr := stream.Close(context.Background()); closeErr != nil {
+			slog.Debug("could not close change stream", slog.String("error", closeErr.Error()))
+		}
+		if err != nil && s.handleStreamError(ctx, streamID, err) {
+			batchSyncDone = false
+		}
+	}
+}
+
+// saveStreamStart opens the stream at the current time and stores its resume token
+func (s *changeStreamSyncer) saveStreamStart(ctx context.Context, db *mongo.Database, pipeline mongo.Pipeline, streamID string) error {
+	stream, err := db.Watch(ctx, pipeline, options.ChangeStream())
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	token := stream.ResumeToken()
+	if token == nil {
+		return errors.New("change stream returned no resume token")
+	}
+	return s.rdb.SaveChangeStreamToken(streamID, token)
+}
+
+func newChangeStreamSession() *SyncSession {
+	session := NewSyncSession()
+	session.Source = rDB.INFO_CHANGE_SOURCE_CHANGE_STREAM
+	return session
+}
+
+// handleStreamError logs the error and waits before the next attempt. Returns true if the stream cannot
+// be resumed from the stored token and a batch sync is needed.
+func (s *changeStreamSyncer) handleStreamError(ctx context.Context, streamID string, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && (serverErr.HasErrorCode(errCodeChangeStreamHistoryLost) || serverErr.HasErrorCode(errCodeChangeStreamFatal)) {
+		slog.Warn("change stream cannot be resumed, falling back to batch sync", slog.String("streamID", streamID), slog.String("error", err.Error()))
+		if err := s.rdb.DeleteChangeStreamToken(streamID); err != nil {
+			slog.Error("could not delete change stream token", slog.String("streamID", streamID), slog.String("error", err.Error()))
+		}
+		return true
+	}
+
+	slog.Error("change stream failed, retrying", slog.String("streamID", streamID), slog.String("error", err.Error()))
+	select {
+	case <-ctx.Done():
+	case <-time.After(changeStreamRetryInterval):
+	}
+	return false
+}
+
+func (s *changeStreamSyncer) runBatchSync(ctx context.Context, studyKey string) {
+	lists, err := s.getRecruitmentListsForStudy(studyKey)
+	if err != nil {
+		slog.Error("could not get recruitment lists for study", slog.String("studyKey", studyKey), slog.String("error", err.Error()))
+		return
+	}
+
+	for _, rl := range lists {
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Info("run batch sync for recruitment list", slog.String("id", rl.ID.Hex()), slog.String("studyKey", studyKey))
+		syncRecruitmentList(ctx, s.rdb, s.studyDB, rl.ID.Hex(), s.instanceID, s.globalStudySecret)
+	}
+}
+
+func (s *changeStreamSyncer) onParticipantChanged(session *SyncSession, studyKey string, event changeStreamEvent) {
+	if len(event.FullDocument) == 0 {
+		return
+	}
+
+	var studyParticipant studyTypes.Participant
+	if err := bson.Unmarshal(event.FullDocument, &studyParticipant); err != nil {
+		slog.Error("could not decode participant", slog.String("error", err.Error()))
+		return
+	}
+
+	lists, err := s.getRecruitmentListsForStudy(studyKey)
+	if err != nil {
+		slog.Error("could not get recruitment lists for study", slog.String("studyKey", studyKey), slog.String("error", err.Error()))
+		return
+	}
+
+	for _, rl := range lists {
+		rlID := rl.ID.Hex()
+
+		if !s.rdb.ParticipantExists(studyParticipant.ParticipantID, rlID) {
+			include, err := participantMatchesAutoInclusion(rl, studyParticipant)
+			if err != nil {
+				slog.Error("could not check inclusion", slog.String("recruitmentListID", rlID), slog.String("error", err.Error()))
+				continue
+			}
+			if !include {
+				continue
+			}
+			if excluded, err := IsExcludedByOtherLists(s.rdb, rl, studyParticipant.ParticipantID); err != nil {
+				slog.Error("could not check excluding lists", slog.String("recruitmentListID", rlID), slog.String("error", err.Error()))
+				continue
+			} else if excluded {
+				continue
+			}
+			if _, err := s.rdb.CreateParticipant(studyParticipant.ParticipantID, rlID, "auto"); err != nil {
+				slog.Error("could not create participant", slog.String("recruitmentListID", rlID), slog.String("error", err.Error()))
+				continue
+			}
+			slog.Info("participant included", slog.String("pid", studyParticipant.ParticipantID), slog.String("recruitmentListID", rlID))
+		}
+
+		participant, err := s.rdb.GetParticipantByParticipantID(studyParticipant.ParticipantID, rlID)
+		if err != nil {
+			slog.Error("could not get participant", slog.String("recruitmentListID", rlID), slog.String("error", err.Error()))
+			continue
+		}
+
+		// empty sync info: participant infos are always computed from the latest responses,
+		// new responses are handled by their own change events
+		if err := SyncDataForParticipant(session, s.rdb, s.studyDB, rl, participant, s.instanceID, studyKey, &rDB.SyncInfo{}, s.globalStudySecret, true); err != nil {
+			slog.Error("could not sync data for participant", slog.String("recruitmentListID", rlID), slog.String("error", err.Error()))
+		}
+		SendInfoChangeNotifications(session, rl)
+	}
+}
+
+func (s *changeStreamSyncer) onResponseChanged(session *SyncSession, studyKey string, event changeStreamEvent) {
+	// responses are only ever added by the study system
+	if event.OperationType != "insert" || len(event.FullDocument) == 0 {
+		return
+	}
+
+	var response studyTypes.SurveyResponse
+	if err := bson.Unmarshal(event.FullDocument, &response); err != nil {
+		slog.Error("could not decode response", slog.String("error", err.Error()))
+		return
+	}
+
+	lists, err := s.getRecruitmentListsForStudy(studyKey)
+	if err != nil {
+		slog.Error("could not get recruitment lists for study", slog.String("studyKey", studyKey), slog.String("error", err.Error()))
+		return
+	}
+
+	for _, rl := range lists {
+		rlID := rl.ID.Hex()
+
+		for _, respDef := range rl.ParticipantData.ResearchData {
+			if respDef.SurveyKey != response.Key {
+				continue
+			}
+			if respDef.StartDate != nil && response.ArrivedAt < respDef.StartDate.Unix() {
+				continue
+			}
+			if respDef.EndDate != nil && response.ArrivedAt > respDef.EndDate.Unix() {
+				continue
+			}
+
+			participant, err := s.rdb.GetParticipantByParticipantID(response.ParticipantID, rlID)
+			if err != nil {
+				// participant not in this list
+				break
+			}
+			if participant.DeletedAt != nil && !participant.DeletedAt.IsZero() {
+				break
+			}
+
+			researchData, err := responsesToResearchData(session, []studyTypes.SurveyResponse{response}, s.studyDB, s.instanceID, rl, respDef, participant.ParticipantID)
+			if err != nil {
+				slog.Error("failed to convert response to research data entry", slog.String("error", err.Error()))
+				continue
+			}
+			if _, err := s.rdb.SaveResearchData(rlID, participant.ParticipantID, researchData); err != nil {
+				slog.Error("could not save research data", slog.String("recruitmentListID", rlID), slog.String("error", err.Error()))
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package sync
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	gosync "sync"
+	"time"
+
+	rDB "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+)
+
+// recordParticipantInfoChanges stores which participant infos of the list definition changed with the update.
+// Nothing is recorded when the infos of a participant are populated for the first time.
+func recordParticipantInfoChanges(
+	session *SyncSession,
+	rdb *rDB.RecruitmentListDBService,
+	recruitmentList *rDB.RecruitmentList,
+	participant *rDB.Participant,
+	updatedInfos map[string]any,
+) {
+	if participant.Infos == nil {
+		return
+	}
+
+	changedAt := time.Now()
+	changes := []rDB.ParticipantInfoChange{}
+	notifyLabels := []string{}
+	for _, pInfoDef := range recruitmentList.ParticipantData.ParticipantInfos {
+		oldValue, hadValue := participant.Infos[pInfoDef.Label]
+		newValue, hasValue := updatedInfos[pInfoDef.Label]
+		if hadValue == hasValue && infoValuesEqual(oldValue, newValue) {
+			continue
+		}
+		changes = append(changes, rDB.ParticipantInfoChange{
+			ParticipantID:     participant.ParticipantID,
+			RecruitmentListID: recruitmentList.ID.Hex(),
+			Label:             pInfoDef.Label,
+			OldValue:          oldValue,
+			NewValue:          newValue,
+			ChangedAt:         changedAt,
+			Source:            session.Source,
+		})
+		if pInfoDef.NotifyOnChange {
+			notifyLabels = append(notifyLabels, pInfoDef.Label)
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	if err := rdb.SaveParticipantInfoChanges(changes); err != nil {
+		slog.Error("could not save participant info changes", slog.String("participantID", participant.ParticipantID), slog.String("error", err.Error()))
+		return
+	}
+	session.infoChanges.add(recruitmentList.ID.Hex(), notifyLabels)
+}
+
+// infoChangeNotifications counts the changed participants per list and label to notify about,
+// and is safe for concurrent use
+type infoChangeNotifications struct {
+	mu     gosync.Mutex
+	counts map[string]map[string]int
+}
+
+func newInfoChangeNotifications() *infoChangeNotifications {
+	return &infoChangeNotifications{
+		counts: make(map[string]map[string]int),
+	}
+}
+
+func (n *infoChangeNotifications) add(rlID string, labels []string) {
+	if len(labels) == 0 {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.counts[rlID] == nil {
+		n.counts[rlID] = make(map[string]int)
+	}
+	for _, label := range labels {
+		n.counts[rlID][label]++
+	}
+}
+
+func (n *infoChangeNotifications) take(rlID string) map[string]int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	counts := n.counts[rlID]
+	delete(n.counts, rlID)
+	return counts
+}
+
+// SendInfoChangeNotifications emails the list's notification addresses about the changes of participant infos
+// marked with notifyOnChange since the last call. Values are not included in the email.
+func SendInfoChangeNotifications(session *SyncSession, recruitmentList *rDB.RecruitmentList) {
+	counts := session.infoChanges.take(recruitmentList.ID.Hex())
+	if len(counts) == 0 || len(recruitmentList.ParticipantInclusion.NotificationEmails) == 0 {
+		return
+	}
+
+	lines := []string{}
+	for _, label := range slices.Sorted(maps.Keys(counts)) {
+		lines = append(lines, fmt.Sprintf("- %s: %d participant(s)", label, counts[label]))
+	}
+	subject := fmt.Sprintf("[%s] - Participant info changes", recruitmentList.Name)
+	message := fmt.Sprintf("Participant infos have changed in recruitment list '%s':\n%s", recruitmentList.Name, strings.Join(lines, "\n"))
+
+	if err := sendEmail(recruitmentList.ParticipantInclusion.NotificationEmails, subject, message); err != nil {
+		slog.Error("could not send email", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,202 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+
+	rDB "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+)
+
+const (
+	defaultMappingDateFormat = "2006-Jan-02"
+	defaultMappingSeparator  = ","
+	defaultMappingMaskChar   = "*"
+)
+
+// compiled patterns of regex mappings, shared by all syncs
+var mappingPatterns gosync.Map
+
+func applyMapping(pInfoDef rDB.ParticipantInfo, value string) string {
+	opts := rDB.MappingOptions{}
+	if pInfoDef.MappingOptions != nil {
+		opts = *pInfoDef.MappingOptions
+	}
+
+	switch pInfoDef.MappingType {
+	case rDB.MappingTypeTs2Date:
+		value = strings.Split(value, ".")[0]
+		ts, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			slog.Error("failed to parse date", slog.String("error", err.Error()))
+			return value
+		}
+		t := time.Unix(ts, 0)
+		if opts.TimeZone != "" {
+			loc, err := time.LoadLocation(opts.TimeZone)
+			if err != nil {
+				slog.Error("failed to load time zone", slog.String("error", err.Error()))
+				return value
+			}
+			t = t.In(loc)
+		}
+		return t.Format(orDefault(opts.DateFormat, defaultMappingDateFormat))
+	case rDB.MappingTypeKey2Value:
+		if mapped, ok := mapKey(pInfoDef.Mapping, value); ok {
+			return mapped
+		}
+	case rDB.MappingTypeMultiKey2Value:
+		separator := orDefault(opts.Separator, defaultMappingSeparator)
+		parts := strings.Split(value, separator)
+		for i, part := range parts {
+			if mapped, ok := mapKey(pInfoDef.Mapping, strings.TrimSpace(part)); ok {
+				parts[i] = mapped
+			}
+		}
+		return strings.Join(parts, separator)
+	case rDB.MappingTypeDate2Age:
+		birthDate, err := parseMappingDate(value, opts.DateFormat)
+		if err != nil {
+			slog.Debug("failed to parse date", slog.String("error", err.Error()))
+			return value
+		}
+		return strconv.Itoa(yearsSince(birthDate, time.Now()))
+	case rDB.MappingTypeBucket:
+		num, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			slog.Debug("failed to parse number", slog.String("error", err.Error()))
+			return value
+		}
+		for _, bucket := range opts.Buckets {
+			if (bucket.Min == nil || num >= *bucket.Min) && (bucket.Max == nil || num < *bucket.Max) {
+				return bucket.Label
+			}
+		}
+	case rDB.MappingTypeRegexExtract:
+		re, err := compileMappingPattern(opts.Pattern)
+		if err != nil {
+			slog.Error("invalid mapping pattern", slog.String("error", err.Error()))
+			return value
+		}
+		match := re.FindStringSubmatch(value)
+		if match == nil {
+			return ""
+		}
+		if len(match) > 1 {
+			return match[1]
+		}
+		return match[0]
+	case rDB.MappingTypeRegexReplace:
+		re, err := compileMappingPattern(opts.Pattern)
+		if err != nil {
+			slog.Error("invalid mapping pattern", slog.String("error", err.Error()))
+			return value
+		}
+		return re.ReplaceAllString(value, opts.Replacement)
+	case rDB.MappingTypeMask:
+		runes := []rune(value)
+		keep := min(max(opts.KeepLast, 0), len(runes))
+		return strings.Repeat(orDefault(opts.MaskChar, defaultMappingMaskChar), len(runes)-keep) + string(runes[len(runes)-keep:])
+	}
+	// if no mapping found, return original value
+	return value
+}
+
+func mapKey(mapping []rDB.Mapping, key string) (string, bool) {
+	for _, m := range mapping {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return "", false
+}
+
+func orDefault(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// parseMappingDate parses the value with the configured layout, or as timestamp or common date format
+func parseMappingDate(value string, layout string) (time.Time, error) {
+	if layout != "" {
+		return time.Parse(layout, strings.TrimSpace(value))
+	}
+	return parseInfoDate(value)
+}
+
+// yearsSince returns the number of full years between date and now
+func yearsSince(date time.Time, now time.Time) int {
+	years := now.Year() - date.Year()
+	if now.Month() < date.Month() || (now.Month() == date.Month() && now.Day() < date.Day()) {
+		years--
+	}
+	return years
+}
+
+func compileMappingPattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := mappingPatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	mappingPatterns.Store(pattern, re)
+	return re, nil
+}
+
+// validateMapping checks the mapping type and options of a participant info definition
+func validateMapping(pInfoDef rDB.ParticipantInfo) error {
+	opts := rDB.MappingOptions{}
+	if pInfoDef.MappingOptions != nil {
+		opts = *pInfoDef.MappingOptions
+	}
+
+	switch pInfoDef.MappingType {
+	case "", rDB.MappingTypeDefault, rDB.MappingTypeJSON:
+	case rDB.MappingTypeKey2Value, rDB.MappingTypeMultiKey2Value:
+		if len(pInfoDef.Mapping) == 0 {
+			return errors.New("mapping is required")
+		}
+	case rDB.MappingTypeTs2Date:
+		if opts.TimeZone != "" {
+			if _, err := time.LoadLocation(opts.TimeZone); err != nil {
+				return fmt.Errorf("invalid time zone: %w", err)
+			}
+		}
+	case rDB.MappingTypeDate2Age:
+	case rDB.MappingTypeBucket:
+		if len(opts.Buckets) == 0 {
+			return errors.New("buckets are required")
+		}
+		for _, bucket := range opts.Buckets {
+			if bucket.Label == "" {
+				return errors.New("bucket without label")
+			}
+			if bucket.Min != nil && bucket.Max != nil && *bucket.Min >= *bucket.Max {
+				return fmt.Errorf("bucket %s: min must be less than max", bucket.Label)
+			}
+		}
+	case rDB.MappingTypeRegexExtract, rDB.MappingTypeRegexReplace:
+		if opts.Pattern == "" {
+			return errors.New("pattern is required")
+		}
+		if _, err := regexp.Compile(opts.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	case rDB.MappingTypeMask:
+		if opts.KeepLast < 0 {
+			return errors.New("keepLast must not be negative")
+		}
+	default:
+		return fmt.Errorf("unknown mapping type: %s", pInfoDef.MappingType)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package sync
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	rDB "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+)
+
+func TestApplyMapping(t *testing.T) {
+	floatPtr := func(v float64) *float64 { return &v }
+
+	now := time.Now()
+	turned30Yesterday := now.AddDate(-30, 0, -1)
+	turns30Tomorrow := now.AddDate(-30, 0, 1)
+
+	ageBuckets := &rDB.MappingOptions{Buckets: []rDB.MappingBucket{
+		{Max: floatPtr(18), Label: "minor"},
+		{Min: floatPtr(18), Max: floatPtr(65), Label: "adult"},
+		{Min: floatPtr(65), Label: "senior"},
+	}}
+	colors := []rDB.Mapping{{Key: "r", Value: "red"}, {Key: "g", Value: "green"}}
+
+	tests := []struct {
+		name  string
+		def   rDB.ParticipantInfo
+		value string
+		want  string
+	}{
+		{name: "default", def: rDB.ParticipantInfo{}, value: "abc", want: "abc"},
+
+		{name: "key2value", def: rDB.ParticipantInfo{MappingType: rDB.MappingTypeKey2Value, Mapping: colors}, value: "g", want: "green"},
+		{name: "key2value without match", def: rDB.ParticipantInfo{MappingType: rDB.MappingTypeKey2Value, Mapping: colors}, value: "b", want: "b"},
+
+		{name: "multiKey2value", def: rDB.ParticipantInfo{MappingType: rDB.MappingTypeMultiKey2Value, Mapping: colors}, value: "r,g", want: "red,green"},
+		{name: "multiKey2value trims parts for lookup and keeps unknown keys", def: rDB.ParticipantInfo{MappingType: rDB.MappingTypeMultiKey2Value, Mapping: colors}, value: " r, b", want: "red, b"},
+		{
+			name:  "multiKey2value with separator",
+			def:   rDB.ParticipantInfo{MappingType: rDB.MappingTypeMultiKey2Value, Mapping: colors, MappingOptions: &rDB.MappingOptions{Separator: ";"}},
+			value: "g;r",
+			want:  "green;red",
+		},
+
+		{name: "ts2date", def: rDB.ParticipantInfo{MappingType: rDB.MappingTypeTs2Date, MappingOptions: &rDB.MappingOptions{TimeZone: "UTC"}}, value: "1700000000", want: "2023-Nov-14"},
+		{
+			name:  "ts2date with format, time zone and fraction",
+			def:   rDB.ParticipantInfo{MappingType: rDB.MappingTypeTs2Date, MappingOptions: &rDB.MappingOptions{TimeZone: "Asia/Tokyo", DateFormat: "2006-01-02 15:04"}},
+			value: "1700000000.5",
+			want:  "2023-11-15 07:13",
+		},
+
+		{name: "date2age from timestamp", def: rDB.ParticipantInfo{MappingType: rDB.MappingTypeDate2Age}, value: strconv.FormatInt(turned30Yesterday.Unix(), 10), want: "30"},
+		{name: "date2age before birthday", def: rDB.ParticipantInfo{MappingType: rDB.MappingTypeDate2Age}, value: turns30Tomorrow.Format("2006-01-02"), want: "29"},
+		{
+			name:  "date2age with format",
+			def:   rDB.ParticipantInfo{MappingType: rDB.MappingTypeDate2Age, MappingOptions: &rDB.MappingOptions{DateFormat: "02.01.2006"}},
+			value: turned30Yesterday.Format("02.01.2006"),
+			want:  "30",
+		},
+		{name: "date2age with invalid date", def: rDB.ParticipantInfo{MappingType: rDB.MappingTypeDate2Age}, value: "unknown", want: "unknown"},
+
+		{name: "bucket open lower bound", def: rDB.ParticipantInfo{MappingType: rDB.MappingTypeBucket, MappingOptions: ageBuckets}, value: "17.9", want: "minor"},
+		{name: "bucket min is inclusive", def: rDB.ParticipantInfo{MappingType: rDB.MappingTypeBucket, MappingOptions: ageBuckets}, value: "18", want: "adult"},
+		{name: "bucket max is exclusive", def: rDB.ParticipantInfo{MappingType: rDB.MappingTypeBucket, MappingOptions: ageBuckets}, value: " 65 ", want: "senior"},
+		{
+			name:  "bucket without match",
+			def:   rDB.ParticipantInfo{MappingType: rDB.MappingTypeBucket, MappingOptions: &rDB.MappingOptions{Buckets: []rDB.MappingBucket{{Min: floatPtr(0), Max: floatPtr(10), Label: "low"}}}},
+			value: "10",
+			want:  "10",
+		},
+		{name: "bucket with invalid number", def: rDB.ParticipantInfo{MappingType: rDB.MappingTypeBucket, MappingOptions: ageBuckets}, value: "n/a", want: "n/a"},
+
+		{
+			name:  "regexExtract capture group",
+			def:   rDB.ParticipantInfo{MappingType: rDB.MappingTypeRegexExtract, MappingOptions: &rDB.MappingOptions{Pattern: `^(\d{4})\s?[A-Z]{2}$`}},
+			value: "1234 AB",
+			want:  "1234",
+		},
+		{
+			name:  "regexExtract whole match",
+			def:   rDB.ParticipantInfo{MappingType: rDB.MappingTypeRegexExtract, MappingOptions: &rDB.MappingOptions{Pattern: `\d+`}},
+			value: "id-42-x",
+			want:  "42",
+		},
+		{
+			name:  "regexExtract without match",
+			def:   rDB.ParticipantInfo{MappingType: rDB.MappingTypeRegexExtract, MappingOptions: &rDB.MappingOptions{Pattern: `\d+`}},
+			value: "none",
+			want:  "",
+		},
+		{
+			name:  "regexExtract with invalid pattern",
+			def:   rDB.ParticipantInfo{MappingType: rDB.MappingTypeRegexExtract, MappingOptions: &rDB.MappingOptions{Pattern: `(`}},
+			value: "abc",
+			want:  "abc",
+		},
+		{
+			name:  "regexReplace",
+			def:   rDB.ParticipantInfo{MappingType: rDB.MappingTypeRegexReplace, MappingOptions: &rDB.MappingOptions{Pattern: `\s+`, Replacement: "-"}},
+			value: "a  b c",
+			want:  "a-b-c",
+		},
+		{
+			name:  "regexReplace with group reference",
+			def:   rDB.ParticipantInfo{MappingType: rDB.MappingTypeRegexReplace, MappingOptions: &rDB.MappingOptions{Pattern: `(\w+)@(\w+)`, Replacement: "$2:$1"}},
+			value: "user@host",
+			want:  "host:user",
+		},
+
+		{name: "mask all", def: rDB.ParticipantInfo{MappingType: rDB.MappingTypeMask}, value: "secret", want: "******"},
+		{name: "mask keep last", def: rDB.ParticipantInfo{MappingType: rDB.MappingTypeMask, MappingOptions: &rDB.MappingOptions{KeepLast: 4}}, value: "0612345678", want: "******5678"},
+		{name: "mask keep more than length", def: rDB.ParticipantInfo{MappingType: rDB.MappingTypeMask, MappingOptions: &rDB.MappingOptions{KeepLast: 10}}, value: "abc", want: "abc"},
+		{name: "mask multibyte with mask char", def: rDB.ParticipantInfo{MappingType: rDB.MappingTypeMask, MappingOptions: &rDB.MappingOptions{KeepLast: 1, MaskChar: "#"}}, value: "äöü", want: "##ü"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applyMapping(tt.def, tt.value); got != tt.want {
+				t.Errorf("applyMapping(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestYearsSince(t *testing.T) {
+	now := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		date time.Time
+		want int
+	}{
+		{time.Date(2000, 3, 10, 0, 0, 0, 0, time.UTC), 24},
+		{time.Date(2000, 3, 11, 0, 0, 0, 0, time.UTC), 23},
+		{time.Date(2000, 2, 29, 0, 0, 0, 0, time.UTC), 24},
+		{time.Date(2000, 12, 31, 0, 0, 0, 0, time.UTC), 23},
+	}
+	for _, tt := range tests {
+		if got := yearsSince(tt.date, now); got != tt.want {
+			t.Errorf("yearsSince(%s) = %d, want %d", tt.date.Format(time.DateOnly), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	sDB "github.com/case-framework/case-backend/pkg/db/study"
+	studyTypes "github.com/case-framework/case-backend/pkg/study/types"
+	rDB "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// sourceTypeRequiresKey returns false for source types that don't need a sourceKey
+func sourceTypeRequiresKey(sourceType rDB.SourceType) bool {
+	switch sourceType {
+	case rDB.SourceTypeStudyStatus, rDB.SourceTypeEnteredAt, rDB.SourceTypeParticipantMessages:
+		return false
+	default:
+		return true
+	}
+}
+
+// getStudyParticipantInfoValue reads the value of the source types that are based on the study participant
+// and the study's reports. Returns false if there is no value.
+func getStudyParticipantInfoValue(
+	studyDB *sDB.StudyDBService,
+	instanceID string,
+	studyKey string,
+	studyParticipant studyTypes.Participant,
+	pInfoDef rDB.ParticipantInfo,
+) (string, bool, error) {
+	switch pInfoDef.SourceType {
+	case rDB.SourceTypeStudyStatus:
+		return studyParticipant.StudyStatus, studyParticipant.StudyStatus != "", nil
+	case rDB.SourceTypeEnteredAt:
+		return strconv.FormatInt(studyParticipant.EnteredAt, 10), studyParticipant.EnteredAt > 0, nil
+	case rDB.SourceTypeLastSubmission:
+		ts, ok := studyParticipant.LastSubmissions[pInfoDef.SourceKey]
+		return strconv.FormatInt(ts, 10), ok, nil
+	case rDB.SourceTypeResponseCount:
+		count, err := studyDB.GetResponsesCount(instanceID, studyKey, bson.M{
+			"participantID": studyParticipant.ParticipantID,
+			"key":           pInfoDef.SourceKey,
+		})
+		if err != nil {
+			return "", false, err
+		}
+		return strconv.FormatInt(count, 10), true, nil
+	case rDB.SourceTypeReportData:
+		reportKey, dataKey, ok := strings.Cut(pInfoDef.SourceKey, ".")
+		if !ok {
+			return "", false, fmt.Errorf("invalid source key: %s", pInfoDef.SourceKey)
+		}
+		reports, _, err := studyDB.GetReports(instanceID, studyKey, bson.M{
+			"participantID": studyParticipant.ParticipantID,
+			"key":           reportKey,
+		}, 1, 1)
+		if err != nil {
+			return "", false, err
+		}
+		if len(reports) == 0 {
+			return "", false, nil
+		}
+		for _, data := range reports[0].Data {
+			if data.Key == dataKey {
+				return data.Value, true, nil
+			}
+		}
+		return "", false, nil
+	case rDB.SourceTypeParticipantMessages:
+		count := 0
+		for _, message := range studyParticipant.Messages {
+			if pInfoDef.SourceKey == "" || message.Type == pInfoDef.SourceKey {
+				count++
+			}
+		}
+		return strconv.Itoa(count), true, nil
+	default:
+		return "", false, fmt.Errorf("unknown source type: %s", pInfoDef.SourceType)
+	}
+}
+
+// evaluateComputedInfos sets the participant infos of source type computed, in the order of the list definition,
+// so computed infos can use the ones defined before them
+func evaluateComputedInfos(session *SyncSession, recruitmentList *rDB.RecruitmentList, participantInfos map[string]any) {
+	for _, pInfoDef := range recruitmentList.ParticipantData.ParticipantInfos {
+		if pInfoDef.SourceType != rDB.SourceTypeComputed || pInfoDef.Label == "" {
+			continue
+		}
+
+		program, err := session.computedInfos.getOrCompile(pInfoDef.SourceKey)
+		if err != nil {
+			slog.Error("could not compile computed participant info", slog.String("label", pInfoDef.Label), slog.String("error", err.Error()))
+			continue
+		}
+		result, err := expr.Run(program, computedInfoEnv(participantInfos))
+		if err != nil {
+			slog.Debug("could not evaluate computed participant info", slog.String("label", pInfoDef.Label), slog.String("error", err.Error()))
+			continue
+		}
+		if result == nil {
+			continue
+		}
+		val, err := formatInfoValue(result)
+		if err != nil {
+			slog.Error("could not format computed participant info", slog.String("label", pInfoDef.Label), slog.String("error", err.Error()))
+			continue
+		}
+		participantInfos[pInfoDef.Label] = applyMapping(pInfoDef, val)
+	}
+}
+
+// computedInfoHelpers are the functions available to computed participant info expressions.
+// Participant info labels must not use these names.
+var computedInfoHelpers = map[string]any{
+	"toDate": parseInfoDate,
+	"age": func(value any) (int, error) {
+		birthDate, err := parseInfoDate(value)
+		if err != nil {
+			return 0, err
+		}
+		return yearsSince(birthDate, time.Now()), nil
+	},
+	"num": func(value any) (float64, error) {
+		return strconv.ParseFloat(fmt.Sprint(value), 64)
+	},
+}
+
+// compileComputedInfo compiles the expression of a computed participant info
+func compileComputedInfo(expression string) (*vm.Program, error) {
+	return expr.Compile(expression, expr.Env(computedInfoEnv(map[string]any{})), expr.AllowUndefinedVariables())
+}
+
+// computedInfoEnv makes the participant infos available to expressions by their label
+// (use $env["label with spaces"] for labels that are no identifiers) together with helper functions
+func computedInfoEnv(participantInfos map[string]any) map[string]any {
+	env := make(map[string]any, len(participantInfos)+len(computedInfoHelpers))
+	for label, value := range participantInfos {
+		env[label] = value
+	}
+	for name, fn := range computedInfoHelpers {
+		env[name] = fn
+	}
+	return env
+}
+
+// parseInfoDate reads dates from unix timestamps and the date formats used for participant infos
+func parseInfoDate(value any) (time.Time, error) {
+	value = normalizeInfoValue(value)
+	if t, ok := value.(time.Time); ok {
+		return t, nil
+	}
+	s := strings.TrimSpace(fmt.Sprint(value))
+	if ts, err := strconv.ParseInt(strings.Split(s, ".")[0], 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-Jan-02", time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown date format: %s", s)
+}
+
+// formatInfoValue converts values read from responses or expressions to the string stored as participant info
+func formatInfoValue(value any) (string, error) {
+	switch typedValue := value.(type) {
+	case string:
+		return typedValue, nil
+	case float64:
+		return strconv.FormatFloat(typedValue, 'f', -1, 64), nil
+	case int64:
+		return strconv.FormatInt(typedValue, 10), nil
+	case int:
+		return strconv.Itoa(typedValue), nil
+	case bool:
+		return strconv.FormatBool(typedValue), nil
+	case time.Time:
+		return typedValue.Format("2006-01-02"), nil
+	default:
+		jsonStr, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return string(jsonStr), nil
+	}
+}
+
+// ValidateParticipantInfos checks the participant info definitions of a recruitment list before it is saved
+func ValidateParticipantInfos(pInfoDefs []rDB.ParticipantInfo) error {
+	labels := map[string]bool{}
+	for _, pInfoDef := range pInfoDefs {
+		if pInfoDef.Label == "" {
+			return errors.New("participant info without label")
+		}
+		if labels[pInfoDef.Label] {
+			return fmt.Errorf("duplicate participant info label: %s", pInfoDef.Label)
+		}
+		if _, ok := computedInfoHelpers[pInfoDef.Label]; ok {
+			return fmt.Errorf("participant info label is reserved for computed infos: %s", pInfoDef.Label)
+		}
+		labels[pInfoDef.Label] = true
+
+		switch pInfoDef.SourceType {
+		case rDB.SourceTypeFlagValue, rDB.SourceTypeConfidentialData, rDB.SourceTypeResponseData,
+			rDB.SourceTypeStudyStatus, rDB.SourceTypeEnteredAt, rDB.SourceTypeLastSubmission,
+			rDB.SourceTypeResponseCount, rDB.SourceTypeParticipantMessages:
+		case rDB.SourceTypeReportData:
+			if !strings.Contains(pInfoDef.SourceKey, ".") {
+				return fmt.Errorf("%s: source key must be <reportKey>.<dataKey>", pInfoDef.Label)
+			}
+		case rDB.SourceTypeComputed:
+			if _, err := compileComputedInfo(pInfoDef.SourceKey); err != nil {
+				return fmt.Errorf("%s: invalid expression: %w", pInfoDef.Label, err)
+			}
+		default:
+			return fmt.Errorf("%s: unknown source type: %s", pInfoDef.Label, pInfoDef.SourceType)
+		}
+		if pInfoDef.SourceKey == "" && sourceTypeRequiresKey(pInfoDef.SourceType) {
+			return fmt.Errorf("%s: source key is required", pInfoDef.Label)
+		}
+		if err := validateMapping(pInfoDef); err != nil {
+			return fmt.Errorf("%s: %w", pInfoDef.Label, err)
+		}
+		if err := validateValueType(pInfoDef); err != nil {
+			return fmt.Errorf("%s: %w", pInfoDef.Label, err)
+		}
+	}
+	return nil
+}
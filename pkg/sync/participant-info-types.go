@@ -0,0 +1,128 @@
+package sync
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	rDB "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ConvertInfoValue converts a participant info value (usually the mapped string) to the value type of the definition
+func ConvertInfoValue(pInfoDef rDB.ParticipantInfo, value any) (any, error) {
+	value = normalizeInfoValue(value)
+
+	switch pInfoDef.ValueType {
+	case "", rDB.InfoValueTypeString:
+		return formatInfoValue(value)
+	case rDB.InfoValueTypeNumber:
+		if num, ok := value.(float64); ok {
+			return num, nil
+		}
+		return strconv.ParseFloat(strings.TrimSpace(fmt.Sprint(value)), 64)
+	case rDB.InfoValueTypeDate:
+		if t, ok := value.(time.Time); ok {
+			return t, nil
+		}
+		dateFormat := ""
+		if pInfoDef.MappingOptions != nil {
+			dateFormat = pInfoDef.MappingOptions.DateFormat
+		}
+		return parseMappingDate(fmt.Sprint(value), dateFormat)
+	case rDB.InfoValueTypeBoolean:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		return strconv.ParseBool(strings.TrimSpace(fmt.Sprint(value)))
+	case rDB.InfoValueTypeList:
+		if list, ok := value.([]any); ok {
+			return list, nil
+		}
+		str, err := formatInfoValue(value)
+		if err != nil {
+			return nil, err
+		}
+		separator := defaultMappingSeparator
+		if pInfoDef.MappingOptions != nil && pInfoDef.MappingOptions.Separator != "" {
+			separator = pInfoDef.MappingOptions.Separator
+		}
+		list := []any{}
+		for _, item := range strings.Split(str, separator) {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("unknown value type: %s", pInfoDef.ValueType)
+	}
+}
+
+// convertParticipantInfoTypes stores the infos with the value type of their definition.
+// Values that cannot be converted are kept as they are.
+func convertParticipantInfoTypes(recruitmentList *rDB.RecruitmentList, participantInfos map[string]any) {
+	for _, pInfoDef := range recruitmentList.ParticipantData.ParticipantInfos {
+		value, ok := participantInfos[pInfoDef.Label]
+		if !ok {
+			continue
+		}
+		converted, err := ConvertInfoValue(pInfoDef, value)
+		if err != nil {
+			slog.Debug("could not convert participant info", slog.String("label", pInfoDef.Label), slog.String("valueType", string(pInfoDef.ValueType)), slog.String("error", err.Error()))
+			continue
+		}
+		participantInfos[pInfoDef.Label] = converted
+	}
+}
+
+// normalizeInfoValue converts values decoded from the DB to the types used by the sync
+func normalizeInfoValue(value any) any {
+	switch typedValue := value.(type) {
+	case primitive.DateTime:
+		return typedValue.Time().UTC()
+	case time.Time:
+		// precision stored in the DB
+		return typedValue.UTC().Truncate(time.Millisecond)
+	case primitive.A:
+		return []any(typedValue)
+	case []string:
+		list := make([]any, len(typedValue))
+		for i, item := range typedValue {
+			list[i] = item
+		}
+		return list
+	case int32:
+		return float64(typedValue)
+	case int64:
+		return float64(typedValue)
+	case int:
+		return float64(typedValue)
+	default:
+		return value
+	}
+}
+
+// infoValuesEqual compares participant info values independent of how they are stored,
+// so changing the value type of an info is not recorded as a change
+func infoValuesEqual(a any, b any) bool {
+	a, b = normalizeInfoValue(a), normalizeInfoValue(b)
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	aStr, errA := formatInfoValue(a)
+	bStr, errB := formatInfoValue(b)
+	return errA == nil && errB == nil && aStr == bStr
+}
+
+func validateValueType(pInfoDef rDB.ParticipantInfo) error {
+	switch pInfoDef.ValueType {
+	case "", rDB.InfoValueTypeString, rDB.InfoValueTypeNumber, rDB.InfoValueTypeDate, rDB.InfoValueTypeBoolean, rDB.InfoValueTypeList:
+		return nil
+	default:
+		return fmt.Errorf("unknown value type: %s", pInfoDef.ValueType)
+	}
+}
@@ -0,0 +1,24 @@
+package sync
+
+import (
+	"log/slog"
+
+	rDB "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+)
+
+// IsExcludedByOtherLists returns true if the participant must not be included in the list,
+// because it is already in one of the lists configured in excludeIfInLists
+func IsExcludedByOtherLists(rdb *rDB.RecruitmentListDBService, recruitmentList *rDB.RecruitmentList, pid string) (bool, error) {
+	excludeIfInLists := recruitmentList.ParticipantInclusion.ExcludeIfInLists
+	if len(excludeIfInLists) == 0 {
+		return false, nil
+	}
+	excluded, err := rdb.IsParticipantInAnyList(pid, excludeIfInLists)
+	if err != nil {
+		return false, err
+	}
+	if excluded {
+		slog.Debug("participant is in an excluding list", slog.String("pid", pid), slog.String("recruitmentListID", recruitmentList.ID.Hex()))
+	}
+	return excluded, nil
+}
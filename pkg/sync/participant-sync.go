@@ -18,7 +18,10 @@ var (
 	HttpClient *httpclient.ClientConfig
 )
 
+// SyncParticipantsForRL includes new participants of the study into a list with automatic inclusion.
+// If ctx is cancelled, the sync is marked as interrupted and ErrSyncInterrupted is returned.
 func SyncParticipantsForRL(
+	ctx context.Context,
 	rdb *rDB.RecruitmentListDBService,
 	studyDB *sDB.StudyDBService,
 	recruitmentListID string,
@@ -39,7 +42,8 @@ func SyncParticipantsForRL(
 		}
 	}
 
-	if lastDataSyncInfo.ParticipantSyncStartedAt != nil && time.Now().Add(-5*time.Minute).Before(*lastDataSyncInfo.ParticipantSyncStartedAt) {
+	if lastDataSyncInfo.ParticipantSyncStatus != rDB.SYNC_STATUS_INTERRUPTED &&
+		lastDataSyncInfo.ParticipantSyncStartedAt != nil && time.Now().Add(-5*time.Minute).Before(*lastDataSyncInfo.ParticipantSyncStartedAt) {
 		slog.Warn("last sync started less than 5 minutes ago, skipping sync")
 		return errors.New("last sync started less than 5 minutes ago, skipping sync")
 	}
@@ -90,14 +94,23 @@ func SyncParticipantsForRL(
 
 	newParticipantCounter := 0
 
+	stopHeartbeat := startHeartbeat(syncHeartbeatInterval, func() {
+		if err := rdb.UpdateParticipantSyncHeartbeat(recruitmentListID); err != nil {
+			slog.Error("could not update participant sync heartbeat", slog.String("recruitmentListID", recruitmentListID), slog.String("error", err.Error()))
+		}
+	})
+
 	if err := studyDB.FindAndExecuteOnParticipantsStates(
-		context.Background(),
+		ctx,
 		instanceID,
 		studyKey,
 		filter,
 		sort,
 		false,
 		func(dbService *sDB.StudyDBService, p studyTypes.Participant, instanceID string, studyKey string, args ...interface{}) error {
+			if ctx.Err() != nil {
+				return ErrSyncInterrupted
+			}
 			if rdb.ParticipantExists(p.ParticipantID, recruitmentListID) {
 				slog.Debug("participant already included", slog.String("pid", p.ParticipantID), slog.String("recruitmentListID", recruitmentListID))
 				return nil
@@ -107,6 +120,12 @@ func SyncParticipantsForRL(
 					return nil
 				}
 			}
+			if excluded, err := IsExcludedByOtherLists(rdb, recruitmentList, p.ParticipantID); err != nil {
+				slog.Error("could not check excluding lists", slog.String("error", err.Error()))
+				return nil
+			} else if excluded {
+				return nil
+			}
 			_, err = rdb.CreateParticipant(p.ParticipantID, recruitmentListID, "auto")
 			if err != nil {
 				slog.Error("could not create participant", slog.String("error", err.Error()))
@@ -115,9 +134,10 @@ func SyncParticipantsForRL(
 			newParticipantCounter++
 			return nil
 		},
-	); err != nil {
+	); err != nil && ctx.Err() == nil {
 		slog.Error("unexpected error", slog.String("error", err.Error()))
 	}
+	stopHeartbeat()
 
 	if newParticipantCounter > 0 && len(recruitmentList.ParticipantInclusion.NotificationEmails) > 0 {
 		subject := fmt.Sprintf("[%s] - New participants", recruitmentList.Name)
@@ -131,6 +151,16 @@ func SyncParticipantsForRL(
 		}
 	}
 
+	if ctx.Err() != nil {
+		// participants are included idempotently, so the next sync simply runs again
+		if err := rdb.InterruptParticipantSync(recruitmentListID); err != nil {
+			slog.Error("could not mark participant sync as interrupted", slog.String("error", err.Error()))
+			return err
+		}
+		slog.Warn("participant sync interrupted", slog.String("recruitmentListID", recruitmentListID))
+		return ErrSyncInterrupted
+	}
+
 	if err := rdb.FinishParticipantSync(recruitmentListID); err != nil {
 		slog.Error("could not finish participant sync", slog.String("error", err.Error()))
 		return err
@@ -139,6 +169,36 @@ func SyncParticipantsForRL(
 	return nil
 }
 
+// participantMatchesAutoInclusion checks if a single study participant should be included into a list with automatic inclusion
+func participantMatchesAutoInclusion(recruitmentList *rDB.RecruitmentList, participant studyTypes.Participant) (bool, error) {
+	if recruitmentList.ParticipantInclusion.Type != rDB.PARTICIPANT_INCLUSION_TYPE_AUTO {
+		return false, nil
+	}
+	if participant.StudyStatus == studyTypes.PARTICIPANT_STUDY_STATUS_ACCOUNT_DELETED {
+		return false, nil
+	}
+
+	autoConfig := recruitmentList.ParticipantInclusion.AutoConfig
+	if autoConfig == nil {
+		return true, nil
+	}
+
+	if autoConfig.StartDate != nil && autoConfig.EndDate != nil {
+		if participant.EnteredAt > autoConfig.EndDate.Unix() || participant.EnteredAt < autoConfig.StartDate.Unix() {
+			return false, nil
+		}
+	}
+
+	if autoConfig.Criteria != "" {
+		inclusionCriteria, err := NewCriteriaGroupFromJSON(autoConfig.Criteria)
+		if err != nil {
+			return false, err
+		}
+		return checkCriteria(inclusionCriteria, participant), nil
+	}
+	return true, nil
+}
+
 func checkCriteria(criteria *CriteriaGroup, participant studyTypes.Participant) bool {
 	val := criteria.Operator == AND
 
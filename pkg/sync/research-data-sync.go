@@ -1,11 +1,13 @@
 package sync
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"sort"
-	"strconv"
 	"strings"
+	gosync "sync"
 	"time"
 
 	"maps"
@@ -19,12 +21,22 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 )
 
+const (
+	// number of responses converted and saved at once during the data sync
+	responseSyncBatchSize = 250
+)
+
 var (
-	responseExporterCache          = make(map[string]*surveyresponses.ResponseParser)
-	responseExporterCacheForPInfos = make(map[string]*surveyresponses.ResponseParser)
+	// DataSyncWorkers is the number of participants whose data is synced in parallel for one recruitment list
+	DataSyncWorkers = 1
 )
 
+// SyncResearchDataForRL syncs participant infos and responses of all participants of the list.
+// If ctx is cancelled, participants being synced are finished, the progress is stored and ErrSyncInterrupted is returned.
+// If a participant fails, the sync stops the same way and returns the error.
+// An interrupted sync continues with the remaining participants on the next call.
 func SyncResearchDataForRL(
+	ctx context.Context,
 	rdb *rDB.RecruitmentListDBService,
 	studyDB *sDB.StudyDBService,
 	recruitmentListID string,
@@ -46,30 +58,118 @@ func SyncResearchDataForRL(
 		}
 	}
 
-	if err := rdb.StartDataSync(recruitmentListID); err != nil {
+	session := NewSyncSession()
+
+	resumeAfter := ""
+	if lastDataSyncInfo.DataSyncStatus == rDB.SYNC_STATUS_INTERRUPTED && lastDataSyncInfo.DataSyncCheckpoint != nil {
+		checkpoint := lastDataSyncInfo.DataSyncCheckpoint
+		slog.Info("resume interrupted data sync", slog.String("recruitmentListID", recruitmentListID), slog.String("lastParticipantID", checkpoint.LastParticipantID))
+		resumeAfter = checkpoint.LastParticipantID
+		session.stats.continueFrom(lastDataSyncInfo.DataSyncStats)
+		// the remaining participants were not synced by the interrupted run
+		lastDataSyncInfo = &rDB.SyncInfo{
+			DataSyncStartedAt: checkpoint.Since,
+		}
+		if err := rdb.ResumeDataSync(recruitmentListID); err != nil {
+			slog.Error("could not resume data sync", slog.String("error", err.Error()))
+			return err
+		}
+	} else if err := rdb.StartDataSync(recruitmentListID, lastDataSyncInfo.DataSyncStartedAt); err != nil {
 		slog.Error("could not start data sync", slog.String("error", err.Error()))
 		return err
 	}
 
 	studyKey := recruitmentList.ParticipantInclusion.StudyKey
 
-	resetResponseParserCache()
+	checkpoints := newCheckpointTracker(resumeAfter)
+	saveCheckpoint := func() {
+		if err := rdb.SaveDataSyncCheckpoint(recruitmentListID, checkpoints.last(), session.stats.toDataSyncStats()); err != nil {
+			slog.Error("could not save data sync checkpoint", slog.String("recruitmentListID", recruitmentListID), slog.String("error", err.Error()))
+		}
+	}
+	stopHeartbeat := startHeartbeat(syncHeartbeatInterval, saveCheckpoint)
+
+	workerCount := getDataSyncWorkerCount(recruitmentList)
+	slog.Debug("starting data sync workers", slog.String("recruitmentListID", recruitmentListID), slog.Int("workers", workerCount))
+
+	participantQueue := make(chan *rDB.Participant)
+	failed := make(chan struct{})
+	var (
+		wg       gosync.WaitGroup
+		failOnce gosync.Once
+		firstErr error
+	)
 
-	if err := rdb.IterateParticipantsByRecruitmentListID(recruitmentListID, func(participant *rDB.Participant) error {
-		return SyncDataForParticipant(rdb, studyDB, recruitmentList, participant, instanceID, studyKey, lastDataSyncInfo, globalStudySecret, false)
-	}); err != nil {
-		slog.Error("could not iterate participants", slog.String("error", err.Error()))
+	for range workerCount {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for participant := range participantQueue {
+				if err := SyncDataForParticipant(session, rdb, studyDB, recruitmentList, participant, instanceID, studyKey, lastDataSyncInfo, globalStudySecret, false); err != nil {
+					session.stats.addParticipantFailed(err)
+					failOnce.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+					continue
+				}
+				session.stats.addParticipantSynced()
+				checkpoints.markDone(participant.ID.Hex())
+			}
+		}()
+	}
+
+	iterErr := rdb.IterateParticipantsByRecruitmentListIDAfter(recruitmentListID, resumeAfter, func(participant *rDB.Participant) error {
+		checkpoints.add(participant.ID.Hex())
+		select {
+		case participantQueue <- participant:
+			return nil
+		case <-failed:
+			return firstErr
+		case <-ctx.Done():
+			return ErrSyncInterrupted
+		}
+	})
+	close(participantQueue)
+	wg.Wait()
+	if iterErr != nil && !errors.Is(iterErr, ErrSyncInterrupted) {
+		slog.Error("could not iterate participants", slog.String("error", iterErr.Error()))
+		if iterErr != firstErr {
+			session.stats.setLastError(iterErr)
+		}
+	}
+	stopHeartbeat()
+	SendInfoChangeNotifications(session, recruitmentList)
+
+	// participants after the checkpoint may not have been synced, so the next run resumes from it with the previous start time
+	if ctx.Err() != nil || firstErr != nil || iterErr != nil {
+		saveCheckpoint()
+		if err := rdb.InterruptDataSync(recruitmentListID); err != nil {
+			slog.Error("could not mark data sync as interrupted", slog.String("error", err.Error()))
+			return err
+		}
+		slog.Warn("data sync interrupted", slog.String("recruitmentListID", recruitmentListID), slog.String("lastParticipantID", checkpoints.last()))
+		if firstErr != nil {
+			return firstErr
+		}
+		if iterErr != nil && !errors.Is(iterErr, ErrSyncInterrupted) {
+			return iterErr
+		}
+		return ErrSyncInterrupted
 	}
 
-	if err := rdb.FinishDataSync(recruitmentListID); err != nil {
+	stats := session.stats.toDataSyncStats()
+	if err := rdb.FinishDataSync(recruitmentListID, stats); err != nil {
 		slog.Error("could not finish data sync", slog.String("error", err.Error()))
 		return err
 	}
+	slog.Info("data sync stats", slog.String("recruitmentListID", recruitmentListID), slog.Int("participants", stats.ParticipantsSynced), slog.Any("importedResponses", stats.ImportedResponses))
 
 	return nil
 }
 
 func SyncDataForParticipant(
+	session *SyncSession,
 	rdb *rDB.RecruitmentListDBService,
 	studyDB *sDB.StudyDBService,
 	recruitmentList *rDB.RecruitmentList,
@@ -85,6 +185,8 @@ func SyncDataForParticipant(
 		return nil
 	}
 
+	infosSyncStartedAt := time.Now()
+
 	// fetch participant info from study DB:
 	studyParticipant, err := studyDB.GetParticipantByID(instanceID, studyKey, participant.ParticipantID)
 	if err != nil {
@@ -94,7 +196,7 @@ func SyncDataForParticipant(
 
 	// check if participant is deleted in study DB:
 	if studyParticipant.StudyStatus == studyTypes.PARTICIPANT_STUDY_STATUS_ACCOUNT_DELETED {
-		if err := rdb.OnParticipantDeleted(participant, recruitmentList.ID.Hex(), "deleted in study DB"); err != nil {
+		if err := rdb.OnParticipantDeleted(participant, recruitmentList.ID.Hex(), rDB.DELETION_REASON_DELETED_IN_STUDY); err != nil {
 			slog.Error("could not delete participant", slog.String("error", err.Error()))
 			return err
 		}
@@ -102,15 +204,22 @@ func SyncDataForParticipant(
 	}
 
 	// update participant infos:
-	updatedParticipantInfos, err := updateAndSaveParticipantInfos(rdb, studyDB, recruitmentList, instanceID, participant, studyParticipant, lastDataSyncInfo.DataSyncStartedAt, globalStudySecret)
+	infosSince := lastDataSyncInfo.DataSyncStartedAt
+	if participant.DataSync != nil && participant.DataSync.InfosSyncedAt != nil {
+		infosSince = participant.DataSync.InfosSyncedAt
+	}
+	updatedParticipantInfos, err := updateAndSaveParticipantInfos(session, rdb, studyDB, recruitmentList, instanceID, participant, studyParticipant, infosSince, globalStudySecret)
 	if err != nil {
 		slog.Error("could not update participant infos", slog.String("error", err.Error()))
 		return err
 	}
+	if err := rdb.UpdateParticipantInfosSyncedAt(participant.ParticipantID, recruitmentList.ID.Hex(), infosSyncStartedAt); err != nil {
+		slog.Error("could not update participant infos sync time", slog.String("error", err.Error()))
+	}
 
 	// check and if needed apply exclusion conditions
 	if toExclude := CheckExclusionConditions(recruitmentList, updatedParticipantInfos); toExclude {
-		if err := rdb.OnParticipantDeleted(participant, recruitmentList.ID.Hex(), "excluded by exclusion conditions"); err != nil {
+		if err := rdb.OnParticipantDeleted(participant, recruitmentList.ID.Hex(), rDB.DELETION_REASON_EXCLUDED); err != nil {
 			slog.Error("could not exclude participant", slog.String("error", err.Error()))
 			return err
 		}
@@ -120,13 +229,14 @@ func SyncDataForParticipant(
 
 	// update participant responses:
 	if !skipResponseSync {
-		syncNewResponses(rdb, studyDB, recruitmentList, instanceID, participant, lastDataSyncInfo)
+		syncNewResponses(session, rdb, studyDB, recruitmentList, instanceID, participant, lastDataSyncInfo)
 	}
 
 	return nil
 }
 
 func updateAndSaveParticipantInfos(
+	session *SyncSession,
 	rdb *rDB.RecruitmentListDBService,
 	studyDB *sDB.StudyDBService,
 	recruitmentList *rDB.RecruitmentList,
@@ -166,7 +276,7 @@ func updateAndSaveParticipantInfos(
 	}
 
 	for _, pInfoDef := range recruitmentList.ParticipantData.ParticipantInfos {
-		if pInfoDef.SourceKey == "" {
+		if pInfoDef.SourceKey == "" && sourceTypeRequiresKey(pInfoDef.SourceType) {
 			slog.Error("sourceKey is empty", slog.String("recruitmentListID", recruitmentList.ID.Hex()), slog.String("label", pInfoDef.Label))
 			continue
 		}
@@ -178,10 +288,10 @@ func updateAndSaveParticipantInfos(
 		surveyKey := getSurveyKeyFromSourceKey(pInfoDef.SourceKey)
 
 		switch pInfoDef.SourceType {
-		case "flagValue":
+		case rDB.SourceTypeFlagValue:
 			val := applyMapping(pInfoDef, studyParticipant.Flags[pInfoDef.SourceKey])
 			updatedParticipantInfo[pInfoDef.Label] = val
-		case "confidentialData":
+		case rDB.SourceTypeConfidentialData:
 			keyParts := strings.Split(pInfoDef.SourceKey, "-")
 			if len(keyParts) < 2 {
 				slog.Error("invalid source key", slog.String("sourceKey", pInfoDef.SourceKey))
@@ -245,7 +355,7 @@ func updateAndSaveParticipantInfos(
 			}
 
 			updatedParticipantInfo[pInfoDef.Label] = val
-		case "responseData":
+		case rDB.SourceTypeResponseData:
 			if lastSubmissionForSurveyLaterThan(studyParticipant.LastSubmissions, surveyKey, lastDataSync) {
 				responsesFromFilter := int64(0)
 				if lastDataSync != nil {
@@ -283,11 +393,15 @@ func updateAndSaveParticipantInfos(
 						ExcludedColumns: []string{},
 					}
 
-					parsedResponses, err := responsesToResearchData(responses, studyDB, instanceID, recruitmentList, respDef, participant.ParticipantID, responseExporterCacheForPInfos)
+					parsedResponses, err := responsesToResearchData(session, responses, studyDB, instanceID, recruitmentList, respDef, participant.ParticipantID)
 					if err != nil {
 						slog.Error("failed to convert responses to research data entries", slog.String("error", err.Error()))
 						continue
 					}
+					if len(parsedResponses) == 0 {
+						slog.Debug("could not parse latest response", slog.String("participantID", participant.ParticipantID), slog.String("surveyKey", surveyKey))
+						continue
+					}
 					lastResponse = parsedResponses[0].Response
 
 					lastResponseCache[surveyKey] = lastResponse
@@ -299,36 +413,46 @@ func updateAndSaveParticipantInfos(
 					continue
 				}
 
-				switch typedValue := findResponseEntry.(type) {
-				case string:
-					updatedParticipantInfo[pInfoDef.Label] = typedValue
-				case float64:
-					updatedParticipantInfo[pInfoDef.Label] = strconv.FormatFloat(typedValue, 'f', -1, 64)
-				case int64:
-					updatedParticipantInfo[pInfoDef.Label] = strconv.FormatInt(typedValue, 10)
-				case bool:
-					updatedParticipantInfo[pInfoDef.Label] = strconv.FormatBool(typedValue)
-				default:
-					jsonStr, err := json.Marshal(findResponseEntry)
-					if err != nil {
-						slog.Error("failed to marshal response", slog.String("error", err.Error()))
-						continue
-					}
-					updatedParticipantInfo[pInfoDef.Label] = string(jsonStr)
+				val, err := formatInfoValue(findResponseEntry)
+				if err != nil {
+					slog.Error("failed to marshal response", slog.String("error", err.Error()))
+					continue
 				}
-				if pInfoDef.Mapping != nil {
-					updatedParticipantInfo[pInfoDef.Label] = applyMapping(pInfoDef, updatedParticipantInfo[pInfoDef.Label].(string))
+				updatedParticipantInfo[pInfoDef.Label] = applyMapping(pInfoDef, val)
+			}
+		case rDB.SourceTypeResponseCount:
+			if !lastSubmissionForSurveyLaterThan(studyParticipant.LastSubmissions, pInfoDef.SourceKey, lastDataSync) {
+				// unchanged since the last sync
+				if _, ok := updatedParticipantInfo[pInfoDef.Label]; ok {
+					continue
 				}
 			}
+			fallthrough
+		case rDB.SourceTypeStudyStatus, rDB.SourceTypeEnteredAt, rDB.SourceTypeLastSubmission, rDB.SourceTypeReportData, rDB.SourceTypeParticipantMessages:
+			val, ok, err := getStudyParticipantInfoValue(studyDB, instanceID, studyKey, studyParticipant, pInfoDef)
+			if err != nil {
+				slog.Error("could not get participant info", slog.String("label", pInfoDef.Label), slog.String("error", err.Error()))
+				continue
+			}
+			if !ok {
+				continue
+			}
+			updatedParticipantInfo[pInfoDef.Label] = applyMapping(pInfoDef, val)
+		case rDB.SourceTypeComputed:
+			// evaluated after all other participant infos are available
 		default:
-			slog.Error("unknown source type", slog.String("sourceType", pInfoDef.SourceType))
+			slog.Error("unknown source type", slog.String("sourceType", string(pInfoDef.SourceType)))
 		}
 	}
+	convertParticipantInfoTypes(recruitmentList, updatedParticipantInfo)
+	evaluateComputedInfos(session, recruitmentList, updatedParticipantInfo)
+	convertParticipantInfoTypes(recruitmentList, updatedParticipantInfo)
 
 	if err := rdb.UpdateParticipantInfos(participant.ParticipantID, recruitmentList.ID.Hex(), updatedParticipantInfo); err != nil {
 		slog.Error("could not update participant infos", slog.String("error", err.Error()))
 		return nil, err
 	}
+	recordParticipantInfoChanges(session, rdb, recruitmentList, participant, updatedParticipantInfo)
 	return updatedParticipantInfo, nil
 }
 
@@ -338,7 +462,16 @@ func CheckExclusionConditions(recruitmentList *rDB.RecruitmentList, updatedParti
 		if !ok {
 			continue
 		}
-		if val == cond.Value {
+		// typed values are compared in their string form, lists match if one of the items matches
+		if list, ok := normalizeInfoValue(val).([]any); ok {
+			for _, item := range list {
+				if infoValuesEqual(item, cond.Value) {
+					return true
+				}
+			}
+			continue
+		}
+		if infoValuesEqual(val, cond.Value) {
 			return true
 		}
 	}
@@ -413,6 +546,7 @@ func getSurveyKeyFromSourceKey(sourceKey string) string {
 }
 
 func syncNewResponses(
+	session *SyncSession,
 	rdb *rDB.RecruitmentListDBService,
 	studyDB *sDB.StudyDBService,
 	recruitmentList *rDB.RecruitmentList,
@@ -424,6 +558,23 @@ func syncNewResponses(
 		slog.Error("participant should not be nil")
 		return
 	}
+
+	syncConfig := recruitmentList.SyncConfig
+	checkStartedAt := time.Now()
+	checkResponses := responseCheckDue(syncConfig, participant, checkStartedAt)
+	checkFailed := false
+	changesBySurvey := make(map[string]responseChanges)
+	defer func() {
+		if syncConfig.NoteOnResponseChanges {
+			addResponseChangesNote(rdb, recruitmentList.ID.Hex(), participant, changesBySurvey)
+		}
+		if checkResponses && !checkFailed {
+			if err := rdb.UpdateParticipantResponsesCheckedAt(participant.ParticipantID, recruitmentList.ID.Hex(), checkStartedAt); err != nil {
+				slog.Error("could not update response check time", slog.String("participantID", participant.ParticipantID), slog.String("error", err.Error()))
+			}
+		}
+	}()
+
 	for _, respDef := range recruitmentList.ParticipantData.ResearchData {
 		checkResponsesSince := int64(0)
 		checkResponsesUntil := time.Now().Unix()
@@ -434,15 +585,22 @@ func syncNewResponses(
 		if respDef.EndDate != nil {
 			checkResponsesUntil = respDef.EndDate.Unix()
 		}
+		windowStart := checkResponsesSince
+
+		if lastArrivedAt, ok := getLastArrivedAt(participant, respDef.SurveyKey); ok {
+			// responses arrived in the same second are fetched again, saving them is idempotent
+			checkResponsesSince = max(checkResponsesSince, lastArrivedAt)
+		} else {
+			// participants synced before watermarks were stored per participant
+			lastDataSyncStarted := int64(0)
+			if lastDataSyncInfo != nil && lastDataSyncInfo.DataSyncStartedAt != nil {
+				lastDataSyncStarted = lastDataSyncInfo.DataSyncStartedAt.Unix()
+			}
 
-		lastDataSyncStarted := int64(0)
-		if lastDataSyncInfo != nil && lastDataSyncInfo.DataSyncStartedAt != nil {
-			lastDataSyncStarted = lastDataSyncInfo.DataSyncStartedAt.Unix()
-		}
-
-		applySince := !participant.IncludedAt.After(time.Unix(lastDataSyncStarted, 0))
-		if applySince {
-			checkResponsesSince = max(checkResponsesSince, lastDataSyncStarted)
+			applySince := !participant.IncludedAt.After(time.Unix(lastDataSyncStarted, 0))
+			if applySince {
+				checkResponsesSince = max(checkResponsesSince, lastDataSyncStarted)
+			}
 		}
 
 		filter := bson.M{
@@ -454,74 +612,114 @@ func syncNewResponses(
 			},
 		}
 
-		// get responses
-		responses, _, err := studyDB.GetResponses(
+		// stream the responses and save them in batches, so memory stays bounded for any number of responses
+		batch := make([]studyTypes.SurveyResponse, 0, responseSyncBatchSize)
+		saveBatch := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			defer func() {
+				batch = batch[:0]
+			}()
+
+			researchData, err := responsesToResearchData(
+				session,
+				batch,
+				studyDB,
+				instanceID,
+				recruitmentList,
+				respDef,
+				participant.ParticipantID,
+			)
+			if err != nil {
+				slog.Error("failed to convert responses to research data entries", slog.String("error", err.Error()))
+				return err
+			}
+
+			imported, err := rdb.SaveResearchData(recruitmentList.ID.Hex(), participant.ParticipantID, researchData)
+			if err != nil {
+				slog.Error("could not save research data", slog.String("error", err.Error()))
+				return err
+			}
+			session.stats.addImportedResponses(respDef.SurveyKey, imported)
+
+			// responses are sorted by arrivedAt
+			lastArrivedAt := batch[len(batch)-1].ArrivedAt
+			if err := rdb.UpdateParticipantLastArrivedAt(participant.ParticipantID, recruitmentList.ID.Hex(), respDef.SurveyKey, lastArrivedAt); err != nil {
+				slog.Error("could not update last synced response", slog.String("error", err.Error()))
+			}
+			return nil
+		}
+
+		if err := studyDB.FindAndExecuteOnResponses(
+			context.Background(),
 			instanceID,
 			recruitmentList.ParticipantInclusion.StudyKey,
 			filter,
-			bson.M{
-				"arrivedAt": 1,
+			bson.M{"arrivedAt": 1},
+			true,
+			func(dbService *sDB.StudyDBService, r studyTypes.SurveyResponse, instanceID string, studyKey string, args ...interface{}) error {
+				batch = append(batch, r)
+				if len(batch) < responseSyncBatchSize {
+					return nil
+				}
+				return saveBatch()
 			},
-			1,
-			1000,
-		)
-		if err != nil {
-			slog.Error("could not get responses", slog.String("error", err.Error()))
-			return
-		}
-
-		if len(responses) == 0 {
-			slog.Debug("no responses found", slog.String("participantID", participant.ParticipantID), slog.String("surveyKey", respDef.SurveyKey))
+		); err != nil {
+			slog.Error("could not sync responses", slog.String("participantID", participant.ParticipantID), slog.String("surveyKey", respDef.SurveyKey), slog.String("error", err.Error()))
 			continue
 		}
-
-		researchData, err := responsesToResearchData(
-			responses,
-			studyDB,
-			instanceID,
-			recruitmentList,
-			respDef,
-			participant.ParticipantID,
-			responseExporterCache,
-		)
-		if err != nil {
-			slog.Error("failed to convert responses to research data entries", slog.String("error", err.Error()))
+		if err := saveBatch(); err != nil {
 			continue
 		}
 
-		if err := rdb.SaveResearchData(recruitmentList.ID.Hex(), participant.ParticipantID, researchData); err != nil {
-			slog.Error("could not save research data", slog.String("error", err.Error()))
-			continue
+		if checkResponses {
+			changes, err := reconcileResponses(session, rdb, studyDB, recruitmentList, instanceID, participant, respDef, windowStart, checkResponsesUntil)
+			if err != nil {
+				checkFailed = true
+				slog.Error("could not check for deleted or changed responses", slog.String("participantID", participant.ParticipantID), slog.String("surveyKey", respDef.SurveyKey), slog.String("error", err.Error()))
+			}
+			session.stats.addDeletedResponses(respDef.SurveyKey, changes.deleted)
+			session.stats.addUpdatedResponses(respDef.SurveyKey, changes.updated)
+			changesBySurvey[respDef.SurveyKey] = changes
 		}
 	}
 }
 
+// getLastArrivedAt returns the arrivedAt of the participant's latest synced response for the survey
+func getLastArrivedAt(participant *rDB.Participant, surveyKey string) (int64, bool) {
+	if participant.DataSync == nil {
+		return 0, false
+	}
+	lastArrivedAt, ok := participant.DataSync.LastArrivedAt[surveyKey]
+	return lastArrivedAt, ok
+}
+
 func responsesToResearchData(
+	session *SyncSession,
 	responses []studyTypes.SurveyResponse,
 	studyDB *sDB.StudyDBService,
 	instanceID string,
 	recruitmentList *rDB.RecruitmentList,
 	respDef rDB.ResearchData,
 	participantID string,
-	exporterCache map[string]*surveyresponses.ResponseParser,
 ) (researchData []rDB.ResponseData, err error) {
 	studyKey := recruitmentList.ParticipantInclusion.StudyKey
 	surveyKey := respDef.SurveyKey
 
-	respParser, ok := exporterCache[respDef.SurveyKey]
-	if !ok {
-		respParser, err = initResponseParser(
+	cacheKey := responseParserCacheKey(studyKey, surveyKey, respDef.ExcludedColumns)
+	respParser, err := session.responseParsers.getOrInit(cacheKey, func() (*surveyresponses.ResponseParser, error) {
+		return initResponseParser(
 			studyDB,
 			instanceID,
 			studyKey,
 			surveyKey,
 			respDef.ExcludedColumns,
 		)
-		if err != nil {
-			slog.Error("failed to create response parser", slog.String("error", err.Error()))
-			return
-		}
-		exporterCache[respDef.SurveyKey] = respParser
+	})
+	if err != nil {
+		slog.Error("failed to create response parser", slog.String("error", err.Error()))
+		return
 	}
 
 	if respParser == nil {
@@ -529,9 +727,9 @@ func responsesToResearchData(
 		return
 	}
 
-	researchData = make([]rDB.ResponseData, len(responses))
+	researchData = make([]rDB.ResponseData, 0, len(responses))
 
-	for i, rawResp := range responses {
+	for _, rawResp := range responses {
 		resp, err := respParser.ParseResponse(&rawResp)
 		if err != nil {
 			slog.Error("failed to parse response", slog.String("error", err.Error()))
@@ -542,22 +740,27 @@ func responsesToResearchData(
 			slog.Error("failed to convert response to flat object", slog.String("error", err.Error()))
 			continue
 		}
-		researchData[i] = rDB.ResponseData{
+		researchData = append(researchData, rDB.ResponseData{
 			ResponseID:        rawResp.ID.Hex(),
 			ParticipantID:     participantID,
 			SurveyKey:         surveyKey,
 			ArrivedAt:         rawResp.ArrivedAt,
 			RecruitmentListID: recruitmentList.ID.Hex(),
 			Response:          output,
-		}
+			SourceHash:        responseSourceHash(rawResp),
+		})
 	}
 
 	return
 }
 
-func resetResponseParserCache() {
-	responseExporterCache = make(map[string]*surveyresponses.ResponseParser)
-	responseExporterCacheForPInfos = make(map[string]*surveyresponses.ResponseParser)
+// getDataSyncWorkerCount returns the number of parallel participant syncs, capped by the list's own limit
+func getDataSyncWorkerCount(recruitmentList *rDB.RecruitmentList) int {
+	workers := max(DataSyncWorkers, 1)
+	if limit := recruitmentList.SyncConfig.MaxParallelParticipants; limit > 0 {
+		workers = min(workers, limit)
+	}
+	return workers
 }
 
 func initResponseParser(
@@ -591,7 +794,7 @@ func initResponseParser(
 		surveyVersions,
 		useShortKeys,
 		nil,
-		"-",
+		questionOptionSep,
 		&extraCols,
 	)
 	if err != nil {
@@ -600,24 +803,3 @@ func initResponseParser(
 	}
 	return
 }
-
-func applyMapping(pInfoDef rDB.ParticipantInfo, value string) string {
-	switch pInfoDef.MappingType {
-	case rDB.MappingTypeTs2Date:
-		value = strings.Split(value, ".")[0]
-		ts, err := strconv.ParseInt(value, 10, 64)
-		if err != nil {
-			slog.Error("failed to parse date", slog.String("error", err.Error()))
-			return value
-		}
-		return time.Unix(ts, 0).Format("2006-Jan-02")
-	case rDB.MappingTypeKey2Value:
-		for _, m := range pInfoDef.Mapping {
-			if m.Key == value {
-				return m.Value
-			}
-		}
-	}
-	// if no mapping found, return original value
-	return value
-}
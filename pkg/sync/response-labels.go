@@ -0,0 +1,162 @@
+package sync
+
+import (
+	"sort"
+	"strings"
+
+	sDB "github.com/case-framework/case-backend/pkg/db/study"
+	surveydefinition "github.com/case-framework/case-backend/pkg/study/exporter/survey-definition"
+)
+
+// questionOptionSep separates question, slot and option keys in response column names
+const questionOptionSep = "-"
+
+// ResponseLabels are the variable and value labels of the response columns of a survey
+type ResponseLabels struct {
+	Columns map[string]ResponseColumnLabel
+	// question titles by question key, for columns of question types without own labels
+	Questions map[string]string
+}
+
+type ResponseColumnLabel struct {
+	Label string
+	// selectable values of the column in the order of the survey definition
+	ValueLabels []ResponseValueLabel
+}
+
+type ResponseValueLabel struct {
+	Value string
+	Label string
+}
+
+// GetResponseLabels derives labels in the given language for the columns the response parser creates for the survey.
+// Labels of newer survey versions replace older ones.
+func GetResponseLabels(
+	studyDB *sDB.StudyDBService,
+	instanceID string,
+	studyKey string,
+	surveyKey string,
+	excludedCols []string,
+	lang string,
+) (*ResponseLabels, error) {
+	surveyVersions, err := surveydefinition.PrepareSurveyInfosFromDB(
+		studyDB,
+		instanceID,
+		studyKey,
+		surveyKey,
+		&surveydefinition.ExtractOptions{
+			UseLabelLang: lang,
+			IncludeItems: nil,
+			ExcludeItems: excludedCols,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(surveyVersions, func(i, j int) bool {
+		return surveyVersions[i].Published < surveyVersions[j].Published
+	})
+
+	labels := &ResponseLabels{
+		Columns:   map[string]ResponseColumnLabel{},
+		Questions: map[string]string{},
+	}
+	for _, version := range surveyVersions {
+		for _, question := range version.Questions {
+			labels.addQuestion(question)
+		}
+	}
+	return labels, nil
+}
+
+// Column returns the labels of the column, or the question title for columns without own labels
+func (labels *ResponseLabels) Column(col string) ResponseColumnLabel {
+	if label, ok := labels.Columns[col]; ok {
+		return label
+	}
+	questionKey := ""
+	for key := range labels.Questions {
+		if (col == key || strings.HasPrefix(col, key+questionOptionSep)) && len(key) > len(questionKey) {
+			questionKey = key
+		}
+	}
+	if questionKey == "" {
+		return ResponseColumnLabel{}
+	}
+	return ResponseColumnLabel{Label: labels.Questions[questionKey]}
+}
+
+func (labels *ResponseLabels) addQuestion(question surveydefinition.SurveyQuestion) {
+	title := labelOrKey(question.Title, question.ID)
+	labels.Questions[question.ID] = title
+
+	single := len(question.Responses) == 1
+	for _, slot := range question.Responses {
+		slotCol := question.ID
+		slotTitle := title
+		if !single {
+			slotCol = question.ID + questionOptionSep + slot.ID
+			slotTitle = title + " - " + labelOrKey(slot.Label, slot.ID)
+		}
+
+		switch question.QuestionType {
+		case surveydefinition.QUESTION_TYPE_SINGLE_CHOICE,
+			surveydefinition.QUESTION_TYPE_DROPDOWN,
+			surveydefinition.QUESTION_TYPE_LIKERT,
+			surveydefinition.QUESTION_TYPE_LIKERT_GROUP,
+			surveydefinition.QUESTION_TYPE_RESPONSIVE_SINGLE_CHOICE_ARRAY,
+			surveydefinition.QUESTION_TYPE_RESPONSIVE_BIPOLAR_LIKERT_ARRAY:
+			valueLabels := []ResponseValueLabel{}
+			optionSep := "."
+			if single {
+				optionSep = questionOptionSep
+			}
+			for _, option := range slot.Options {
+				optionLabel := labelOrKey(option.Label, option.ID)
+				valueLabels = append(valueLabels, ResponseValueLabel{Value: option.ID, Label: optionLabel})
+				if option.OptionType != surveydefinition.OPTION_TYPE_RADIO &&
+					option.OptionType != surveydefinition.OPTION_TYPE_DROPDOWN_OPTION &&
+					option.OptionType != surveydefinition.OPTION_TYPE_CLOZE {
+					labels.Columns[slotCol+optionSep+option.ID] = ResponseColumnLabel{Label: slotTitle + ": " + optionLabel}
+				}
+			}
+			labels.Columns[slotCol] = ResponseColumnLabel{Label: slotTitle, ValueLabels: valueLabels}
+		case surveydefinition.QUESTION_TYPE_MULTIPLE_CHOICE:
+			optionPrefix := question.ID + questionOptionSep
+			if !single {
+				optionPrefix = slotCol + "."
+			}
+			for _, option := range slot.Options {
+				optionLabel := slotTitle + ": " + labelOrKey(option.Label, option.ID)
+				labels.Columns[optionPrefix+option.ID] = ResponseColumnLabel{Label: optionLabel, ValueLabels: selectionValueLabels()}
+				labels.Columns[optionPrefix+option.ID+questionOptionSep+surveydefinition.OPEN_FIELD_COL_SUFFIX] = ResponseColumnLabel{Label: optionLabel + " (open)"}
+			}
+		case surveydefinition.QUESTION_TYPE_CONSENT:
+			labels.Columns[slotCol] = ResponseColumnLabel{Label: slotTitle, ValueLabels: []ResponseValueLabel{
+				{Value: surveydefinition.TRUE_VALUE, Label: "consented"},
+				{Value: surveydefinition.FALSE_VALUE, Label: "not consented"},
+			}}
+		case surveydefinition.QUESTION_TYPE_TEXT_INPUT,
+			surveydefinition.QUESTION_TYPE_DATE_INPUT,
+			surveydefinition.QUESTION_TYPE_NUMBER_INPUT,
+			surveydefinition.QUESTION_TYPE_NUMERIC_SLIDER,
+			surveydefinition.QUESTION_TYPE_EQ5D_SLIDER:
+			labels.Columns[slotCol] = ResponseColumnLabel{Label: slotTitle}
+		}
+	}
+}
+
+func selectionValueLabels() []ResponseValueLabel {
+	return []ResponseValueLabel{
+		{Value: surveydefinition.TRUE_VALUE, Label: "selected"},
+		{Value: surveydefinition.FALSE_VALUE, Label: "not selected"},
+	}
+}
+
+func labelOrKey(label string, key string) string {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return key
+	}
+	return label
+}
@@ -0,0 +1,274 @@
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	sDB "github.com/case-framework/case-backend/pkg/db/study"
+	studyTypes "github.com/case-framework/case-backend/pkg/study/types"
+	rDB "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ParseResponseCheckInterval returns the minimum time between two checks for deleted or changed responses.
+// Returns 0 (check on every sync) if interval is empty.
+func ParseResponseCheckInterval(interval string) (time.Duration, error) {
+	if interval == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("interval must not be negative")
+	}
+	return d, nil
+}
+
+// responseCheckDue reports whether the participant's responses should be checked for deletions and changes
+func responseCheckDue(syncConfig rDB.SyncConfig, participant *rDB.Participant, now time.Time) bool {
+	if !syncConfig.DetectDeletedResponses && !syncConfig.DetectEditedResponses {
+		return false
+	}
+	interval, err := ParseResponseCheckInterval(syncConfig.ResponseCheckInterval)
+	if err != nil {
+		slog.Warn("invalid response check interval, checking on every sync", slog.String("interval", syncConfig.ResponseCheckInterval), slog.String("error", err.Error()))
+		return true
+	}
+	if interval == 0 || participant.DataSync == nil || participant.DataSync.ResponsesCheckedAt == nil {
+		return true
+	}
+	return !participant.DataSync.ResponsesCheckedAt.Add(interval).After(now)
+}
+
+type responseChanges struct {
+	deleted int64
+	updated int64
+}
+
+// reconcileResponses removes synced responses of the participant that don't exist in the study DB anymore,
+// and, if enabled for the list, updates synced responses whose content changed in the study DB.
+// Only responses with arrivedAt between from and until are compared.
+func reconcileResponses(
+	session *SyncSession,
+	rdb *rDB.RecruitmentListDBService,
+	studyDB *sDB.StudyDBService,
+	recruitmentList *rDB.RecruitmentList,
+	instanceID string,
+	participant *rDB.Participant,
+	respDef rDB.ResearchData,
+	from int64,
+	until int64,
+) (changes responseChanges, err error) {
+	rlID := recruitmentList.ID.Hex()
+	studyKey := recruitmentList.ParticipantInclusion.StudyKey
+
+	storedHashes, err := rdb.GetResearchDataSourceHashes(rlID, participant.ParticipantID, respDef.SurveyKey, from, until)
+	if err != nil {
+		return changes, err
+	}
+	if len(storedHashes) == 0 {
+		return changes, nil
+	}
+
+	filter := bson.M{
+		"participantID": participant.ParticipantID,
+		"key":           respDef.SurveyKey,
+		"$and": bson.A{
+			bson.M{"arrivedAt": bson.M{"$lte": until}},
+			bson.M{"arrivedAt": bson.M{"$gte": from}},
+		},
+	}
+
+	existing := make(map[string]bool, len(storedHashes))
+	if recruitmentList.SyncConfig.DetectEditedResponses {
+		changes.updated, err = updateChangedResponses(session, rdb, studyDB, recruitmentList, instanceID, participant, respDef, filter, storedHashes, existing)
+	} else {
+		err = collectStudyResponseIDs(studyDB, instanceID, studyKey, filter, existing)
+	}
+	if err != nil {
+		return changes, err
+	}
+
+	deletedIDs := []string{}
+	for responseID := range storedHashes {
+		if !existing[responseID] {
+			deletedIDs = append(deletedIDs, responseID)
+		}
+	}
+	if len(deletedIDs) > 0 {
+		changes.deleted, err = rdb.DeleteResearchDataByResponseIDs(rlID, participant.ParticipantID, deletedIDs)
+		if err != nil {
+			return changes, err
+		}
+		slog.Info("removed responses deleted in study DB", slog.String("participantID", participant.ParticipantID), slog.String("surveyKey", respDef.SurveyKey), slog.Int64("count", changes.deleted))
+	}
+	return changes, nil
+}
+
+// studyResponsesCollection returns the responses collection of the study
+func studyResponsesCollection(studyDB *sDB.StudyDBService, instanceID string, studyKey string) *mongo.Collection {
+	return studyDB.DBClient.Database(studyDB.DBNamePrefix + instanceID + studyDBNameSuffix).Collection(studyKey + studyResponsesCollectionSuffix)
+}
+
+// collectStudyResponseIDs marks the IDs of the study responses matching filter in ids
+func collectStudyResponseIDs(
+	studyDB *sDB.StudyDBService,
+	instanceID string,
+	studyKey string,
+	filter bson.M,
+	ids map[string]bool,
+) error {
+	ctx := context.Background()
+	cur, err := studyResponsesCollection(studyDB, instanceID, studyKey).Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cur.Decode(&doc); err != nil {
+			return err
+		}
+		ids[doc.ID.Hex()] = true
+	}
+	return cur.Err()
+}
+
+// updateChangedResponses saves the study responses matching filter whose hash differs from the stored one.
+// The IDs of all study responses are marked in existing, an error is returned if not all responses could be read.
+func updateChangedResponses(
+	session *SyncSession,
+	rdb *rDB.RecruitmentListDBService,
+	studyDB *sDB.StudyDBService,
+	recruitmentList *rDB.RecruitmentList,
+	instanceID string,
+	participant *rDB.Participant,
+	respDef rDB.ResearchData,
+	filter bson.M,
+	storedHashes map[string]string,
+	existing map[string]bool,
+) (int64, error) {
+	var (
+		updated      int64
+		batchUpdates int64
+		changedBatch = make([]studyTypes.SurveyResponse, 0, responseSyncBatchSize)
+	)
+
+	saveBatch := func() error {
+		if len(changedBatch) == 0 {
+			return nil
+		}
+		defer func() {
+			changedBatch = changedBatch[:0]
+			batchUpdates = 0
+		}()
+
+		researchData, err := responsesToResearchData(session, changedBatch, studyDB, instanceID, recruitmentList, respDef, participant.ParticipantID)
+		if err != nil {
+			return err
+		}
+		if _, err := rdb.SaveResearchData(recruitmentList.ID.Hex(), participant.ParticipantID, researchData); err != nil {
+			return err
+		}
+		updated += batchUpdates
+		return nil
+	}
+
+	// read with an own cursor instead of FindAndExecuteOnResponses, which skips responses it can't decode:
+	// responses missing in existing would be deleted
+	ctx := context.Background()
+	collection := studyResponsesCollection(studyDB, instanceID, recruitmentList.ParticipantInclusion.StudyKey)
+	cur, err := collection.Find(ctx, filter, options.Find().SetSort(bson.M{"arrivedAt": 1}))
+	if err != nil {
+		return updated, err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var r studyTypes.SurveyResponse
+		if err := cur.Decode(&r); err != nil {
+			return updated, err
+		}
+		responseID := r.ID.Hex()
+		existing[responseID] = true
+
+		storedHash, ok := storedHashes[responseID]
+		if !ok || storedHash == responseSourceHash(r) {
+			// new responses are imported by the incremental sync
+			continue
+		}
+		changedBatch = append(changedBatch, r)
+		if storedHash != "" {
+			// entries synced before hashes were stored are refreshed without counting them as changed
+			batchUpdates++
+		}
+		if len(changedBatch) < responseSyncBatchSize {
+			continue
+		}
+		if err := saveBatch(); err != nil {
+			return updated, err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return updated, err
+	}
+	if err := saveBatch(); err != nil {
+		return updated, err
+	}
+	if updated > 0 {
+		slog.Info("updated responses changed in study DB", slog.String("participantID", participant.ParticipantID), slog.String("surveyKey", respDef.SurveyKey), slog.Int64("count", updated))
+	}
+	return updated, nil
+}
+
+// responseSourceHash identifies the content of a study response, JSON encoding is used as map keys are sorted
+func responseSourceHash(response studyTypes.SurveyResponse) string {
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256(encoded)
+	return hex.EncodeToString(hash[:])
+}
+
+// addResponseChangesNote adds a system note to the participant listing responses removed or updated per survey
+func addResponseChangesNote(rdb *rDB.RecruitmentListDBService, rlID string, participant *rDB.Participant, changesBySurvey map[string]responseChanges) {
+	parts := []string{}
+	for _, surveyKey := range slices.Sorted(maps.Keys(changesBySurvey)) {
+		changes := changesBySurvey[surveyKey]
+		if changes.deleted == 0 && changes.updated == 0 {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s: %d deleted, %d updated", surveyKey, changes.deleted, changes.updated))
+	}
+	if len(parts) == 0 {
+		return
+	}
+
+	if _, err := rdb.CreateParticipantNote(
+		participant.ID.Hex(),
+		rlID,
+		fmt.Sprintf("Responses changed in study: %s", strings.Join(parts, "; ")),
+		"",
+		"<system>",
+	); err != nil {
+		slog.Error("could not add participant note", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,205 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	sDB "github.com/case-framework/case-backend/pkg/db/study"
+	rDB "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+	"github.com/robfig/cron/v3"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type SchedulerConfig struct {
+	// used for lists without their own schedule, lists are not scheduled if empty
+	DefaultSchedule rDB.SyncSchedule
+	// random delay up to this duration is added to every run, to spread the load on the study DB
+	MaxJitter time.Duration
+	// how often the scheduler checks for due lists
+	CheckInterval time.Duration
+}
+
+type scheduledList struct {
+	scheduleSpec string
+	nextRunAt    time.Time
+}
+
+// ParseSyncSchedule returns the schedule defined by a cron expression or an interval.
+// Returns nil if neither is set.
+func ParseSyncSchedule(schedule rDB.SyncSchedule) (cron.Schedule, error) {
+	if schedule.Cron != "" && schedule.Interval != "" {
+		return nil, errors.New("only one of cron and interval can be set")
+	}
+	if schedule.Cron != "" {
+		return cron.ParseStandard(schedule.Cron)
+	}
+	if schedule.Interval != "" {
+		interval, err := time.ParseDuration(schedule.Interval)
+		if err != nil {
+			return nil, err
+		}
+		if interval < time.Minute {
+			return nil, errors.New("interval must be at least one minute")
+		}
+		return cron.Every(interval), nil
+	}
+	return nil, nil
+}
+
+// RunScheduler runs the participant and data sync for every list according to its schedule until ctx is cancelled.
+// Due lists are synced one after another. The next run time of every list is stored in its sync info.
+func RunScheduler(
+	ctx context.Context,
+	rdb *rDB.RecruitmentListDBService,
+	studyDB *sDB.StudyDBService,
+	instanceID string,
+	globalStudySecret string,
+	config SchedulerConfig,
+) {
+	scheduledLists := make(map[string]*scheduledList)
+
+	ticker := time.NewTicker(config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		lists, err := getListsForScheduler(rdb)
+		if err != nil {
+			slog.Error("could not get recruitment lists", slog.String("error", err.Error()))
+		}
+
+		knownLists := make(map[string]struct{}, len(lists))
+		for _, rl := range lists {
+			if ctx.Err() != nil {
+				return
+			}
+
+			rlID := rl.ID.Hex()
+			knownLists[rlID] = struct{}{}
+
+			schedule, spec, err := getEffectiveSchedule(rl, config.DefaultSchedule)
+			if err != nil {
+				slog.Error("invalid sync schedule", slog.String("recruitmentListID", rlID), slog.String("error", err.Error()))
+				continue
+			}
+
+			if schedule == nil || isSchedulePaused(rl) {
+				if _, ok := scheduledLists[rlID]; ok {
+					slog.Info("sync not scheduled anymore", slog.String("recruitmentListID", rlID))
+					delete(scheduledLists, rlID)
+					if err := rdb.UpdateSyncNextRunAt(rlID, nil); err != nil {
+						slog.Error("could not update next sync run", slog.String("recruitmentListID", rlID), slog.String("error", err.Error()))
+					}
+				}
+				continue
+			}
+
+			current, ok := scheduledLists[rlID]
+			if !ok || current.scheduleSpec != spec {
+				current = &scheduledList{
+					scheduleSpec: spec,
+					nextRunAt:    getInitialNextRun(rdb, rlID, schedule, config.MaxJitter),
+				}
+				scheduledLists[rlID] = current
+				saveNextRunAt(rdb, rlID, current.nextRunAt)
+			}
+
+			if time.Now().Before(current.nextRunAt) {
+				continue
+			}
+
+			slog.Info("start scheduled sync", slog.String("id", rlID), slog.String("name", rl.Name))
+			syncRecruitmentList(ctx, rdb, studyDB, rlID, instanceID, globalStudySecret)
+			if ctx.Err() != nil {
+				// interrupted, keep the next run as it was
+				return
+			}
+
+			current.nextRunAt = schedule.Next(time.Now()).Add(getJitter(config.MaxJitter))
+			saveNextRunAt(rdb, rlID, current.nextRunAt)
+			slog.Info("scheduled sync finished", slog.String("id", rlID), slog.Time("nextRunAt", current.nextRunAt))
+		}
+
+		// forget deleted lists
+		if err == nil {
+			for rlID := range scheduledLists {
+				if _, ok := knownLists[rlID]; !ok {
+					delete(scheduledLists, rlID)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func getListsForScheduler(rdb *rDB.RecruitmentListDBService) ([]*rDB.RecruitmentList, error) {
+	var lists []*rDB.RecruitmentList
+	err := rdb.FindAndExecuteOnRecruitmentLists(bson.M{}, func(list *rDB.RecruitmentList) error {
+		lists = append(lists, list)
+		return nil
+	})
+	return lists, err
+}
+
+func getEffectiveSchedule(rl *rDB.RecruitmentList, defaultSchedule rDB.SyncSchedule) (cron.Schedule, string, error) {
+	scheduleDef := defaultSchedule
+	if s := rl.SyncConfig.Schedule; s != nil && (s.Cron != "" || s.Interval != "") {
+		scheduleDef = *s
+	}
+	schedule, err := ParseSyncSchedule(scheduleDef)
+	return schedule, scheduleDef.Cron + "|" + scheduleDef.Interval, err
+}
+
+func isSchedulePaused(rl *rDB.RecruitmentList) bool {
+	return rl.SyncConfig.Schedule != nil && rl.SyncConfig.Schedule.Paused
+}
+
+// getInitialNextRun keeps a stored next run from a previous scheduler process, if any
+func getInitialNextRun(rdb *rDB.RecruitmentListDBService, rlID string, schedule cron.Schedule, maxJitter time.Duration) time.Time {
+	next := schedule.Next(time.Now()).Add(getJitter(maxJitter))
+	syncInfo, err := rdb.GetSyncInfoByRLID(rlID)
+	if err == nil && syncInfo.NextRunAt != nil && syncInfo.NextRunAt.Before(next) {
+		return *syncInfo.NextRunAt
+	}
+	return next
+}
+
+func saveNextRunAt(rdb *rDB.RecruitmentListDBService, rlID string, nextRunAt time.Time) {
+	if err := rdb.UpdateSyncNextRunAt(rlID, &nextRunAt); err != nil {
+		slog.Error("could not update next sync run", slog.String("recruitmentListID", rlID), slog.String("error", err.Error()))
+	}
+}
+
+func getJitter(maxJitter time.Duration) time.Duration {
+	if maxJitter <= 0 {
+		return 0
+	}
+	return rand.N(maxJitter)
+}
+
+// syncRecruitmentList runs the participant sync followed by the data sync for one list
+func syncRecruitmentList(
+	ctx context.Context,
+	rdb *rDB.RecruitmentListDBService,
+	studyDB *sDB.StudyDBService,
+	rlID string,
+	instanceID string,
+	globalStudySecret string,
+) {
+	if err := SyncParticipantsForRL(ctx, rdb, studyDB, rlID, instanceID); err != nil {
+		slog.Error("could not sync participants", slog.String("id", rlID), slog.String("error", err.Error()))
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if err := SyncResearchDataForRL(ctx, rdb, studyDB, rlID, instanceID, globalStudySecret); err != nil {
+		slog.Error("could not sync research data", slog.String("id", rlID), slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,58 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	rDB "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+)
+
+func TestParseSyncSchedule(t *testing.T) {
+	ref := time.Date(2024, 3, 10, 10, 15, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		schedule rDB.SyncSchedule
+		wantErr  bool
+		wantNil  bool
+		wantNext time.Time
+	}{
+		{name: "empty", schedule: rDB.SyncSchedule{}, wantNil: true},
+		{name: "cron", schedule: rDB.SyncSchedule{Cron: "0 3 * * *"}, wantNext: time.Date(2024, 3, 11, 3, 0, 0, 0, time.UTC)},
+		{name: "cron every 30 minutes", schedule: rDB.SyncSchedule{Cron: "*/30 * * * *"}, wantNext: time.Date(2024, 3, 10, 10, 30, 0, 0, time.UTC)},
+		{name: "invalid cron", schedule: rDB.SyncSchedule{Cron: "0 3 * *"}, wantErr: true},
+		{name: "interval", schedule: rDB.SyncSchedule{Interval: "6h"}, wantNext: ref.Add(6 * time.Hour)},
+		{name: "interval of one minute", schedule: rDB.SyncSchedule{Interval: "1m"}, wantNext: ref.Add(time.Minute)},
+		{name: "interval below one minute", schedule: rDB.SyncSchedule{Interval: "59s"}, wantErr: true},
+		{name: "invalid interval", schedule: rDB.SyncSchedule{Interval: "daily"}, wantErr: true},
+		{name: "cron and interval", schedule: rDB.SyncSchedule{Cron: "0 3 * * *", Interval: "6h"}, wantErr: true},
+		{name: "paused is ignored", schedule: rDB.SyncSchedule{Interval: "1h", Paused: true}, wantNext: ref.Add(time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseSyncSchedule(tt.schedule)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got schedule %v", schedule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantNil {
+				if schedule != nil {
+					t.Fatalf("expected nil schedule, got %v", schedule)
+				}
+				return
+			}
+			if schedule == nil {
+				t.Fatal("expected schedule, got nil")
+			}
+			if next := schedule.Next(ref); !next.Equal(tt.wantNext) {
+				t.Errorf("next run: got %v, want %v", next, tt.wantNext)
+			}
+		})
+	}
+}
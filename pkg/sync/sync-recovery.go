@@ -0,0 +1,99 @@
+package sync
+
+import (
+	"errors"
+	"log/slog"
+	gosync "sync"
+	"time"
+
+	rDB "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+)
+
+const (
+	syncHeartbeatInterval = 30 * time.Second
+)
+
+var (
+	// ErrSyncInterrupted is returned if a sync stopped early because its context was cancelled
+	ErrSyncInterrupted = errors.New("sync interrupted")
+
+	// StaleSyncTimeout is the time without heartbeat after which a running sync is considered dead
+	StaleSyncTimeout = 10 * time.Minute
+)
+
+// RecoverStaleSyncs marks running syncs of processes that were killed as interrupted,
+// so the next sync of the list resumes them
+func RecoverStaleSyncs(rdb *rDB.RecruitmentListDBService) error {
+	count, err := rdb.MarkStaleSyncsInterrupted(time.Now().Add(-StaleSyncTimeout))
+	if err != nil {
+		slog.Error("could not recover stale syncs", slog.String("error", err.Error()))
+		return err
+	}
+	if count > 0 {
+		slog.Warn("marked stale syncs as interrupted", slog.Int64("count", count))
+	}
+	return nil
+}
+
+// checkpointTracker keeps track of the last participant up to which all participants (in dispatch order) are synced,
+// while participants are synced in parallel
+type checkpointTracker struct {
+	mu       gosync.Mutex
+	pending  []string
+	done     map[string]bool
+	lastDone string
+}
+
+func newCheckpointTracker(lastDone string) *checkpointTracker {
+	return &checkpointTracker{
+		done:     make(map[string]bool),
+		lastDone: lastDone,
+	}
+}
+
+func (t *checkpointTracker) add(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = append(t.pending, id)
+}
+
+func (t *checkpointTracker) markDone(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done[id] = true
+	for len(t.pending) > 0 && t.done[t.pending[0]] {
+		t.lastDone = t.pending[0]
+		delete(t.done, t.pending[0])
+		t.pending = t.pending[1:]
+	}
+}
+
+func (t *checkpointTracker) last() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastDone
+}
+
+// startHeartbeat calls beat in the given interval until the returned stop function is called
+func startHeartbeat(interval time.Duration, beat func()) (stop func()) {
+	done := make(chan struct{})
+	var wg gosync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				beat()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,199 @@
+package sync
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	gosync "sync"
+
+	surveyresponses "github.com/case-framework/case-backend/pkg/study/exporter/survey-responses"
+	rDB "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+	"github.com/expr-lang/expr/vm"
+)
+
+// SyncSession holds the state shared by the participant syncs of one sync run.
+// Create a new session for every run, so parsers of different studies or survey versions are never mixed up.
+type SyncSession struct {
+	// recorded as source of participant info changes
+	Source string
+
+	responseParsers *responseParserCache
+	computedInfos   *computedInfoCache
+	stats           *syncStats
+	infoChanges     *infoChangeNotifications
+}
+
+func NewSyncSession() *SyncSession {
+	return &SyncSession{
+		Source:          rDB.INFO_CHANGE_SOURCE_SYNC,
+		responseParsers: newResponseParserCache(),
+		computedInfos:   newComputedInfoCache(),
+		stats:           newSyncStats(),
+		infoChanges:     newInfoChangeNotifications(),
+	}
+}
+
+// syncStats counts what a sync run changed and is safe for concurrent use
+type syncStats struct {
+	mu                 gosync.Mutex
+	participantsSynced int
+	importedResponses  map[string]int64
+	deletedResponses   map[string]int64
+	updatedResponses   map[string]int64
+	failedParticipants int
+	lastError          string
+}
+
+func newSyncStats() *syncStats {
+	return &syncStats{
+		importedResponses: make(map[string]int64),
+		deletedResponses:  make(map[string]int64),
+		updatedResponses:  make(map[string]int64),
+	}
+}
+
+// continueFrom adds the counts of a previous (interrupted) run
+func (s *syncStats) continueFrom(stats *rDB.DataSyncStats) {
+	if stats == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.participantsSynced += stats.ParticipantsSynced
+	addCounts(s.importedResponses, stats.ImportedResponses)
+	addCounts(s.deletedResponses, stats.DeletedResponses)
+	addCounts(s.updatedResponses, stats.UpdatedResponses)
+	s.failedParticipants += stats.FailedParticipants
+	s.lastError = stats.LastError
+}
+
+func (s *syncStats) addParticipantSynced() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.participantsSynced++
+}
+
+func (s *syncStats) addParticipantFailed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failedParticipants++
+	s.lastError = err.Error()
+}
+
+func (s *syncStats) setLastError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err.Error()
+}
+
+func (s *syncStats) addImportedResponses(surveyKey string, count int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.importedResponses[surveyKey] += count
+}
+
+func (s *syncStats) addDeletedResponses(surveyKey string, count int64) {
+	if count == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deletedResponses[surveyKey] += count
+}
+
+func (s *syncStats) addUpdatedResponses(surveyKey string, count int64) {
+	if count == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updatedResponses[surveyKey] += count
+}
+
+func (s *syncStats) toDataSyncStats() rDB.DataSyncStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return rDB.DataSyncStats{
+		ParticipantsSynced: s.participantsSynced,
+		ImportedResponses:  maps.Clone(s.importedResponses),
+		DeletedResponses:   maps.Clone(s.deletedResponses),
+		UpdatedResponses:   maps.Clone(s.updatedResponses),
+		FailedParticipants: s.failedParticipants,
+		LastError:          s.lastError,
+	}
+}
+
+func addCounts(target map[string]int64, counts map[string]int64) {
+	for key, count := range counts {
+		target[key] += count
+	}
+}
+
+// responseParserCache holds initialised response parsers and is safe for concurrent use
+type responseParserCache struct {
+	mu      gosync.Mutex
+	parsers map[string]*surveyresponses.ResponseParser
+}
+
+func newResponseParserCache() *responseParserCache {
+	return &responseParserCache{
+		parsers: make(map[string]*surveyresponses.ResponseParser),
+	}
+}
+
+// getOrInit returns the parser stored for key, or creates it with initFn if missing.
+// The lock is held while initFn runs so the same parser is not built twice in parallel.
+func (c *responseParserCache) getOrInit(
+	key string,
+	initFn func() (*surveyresponses.ResponseParser, error),
+) (*surveyresponses.ResponseParser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if respParser, ok := c.parsers[key]; ok {
+		return respParser, nil
+	}
+
+	respParser, err := initFn()
+	if err != nil {
+		return nil, err
+	}
+	c.parsers[key] = respParser
+	return respParser, nil
+}
+
+// responseParserCacheKey identifies a parser by study, survey and the columns excluded from it
+func responseParserCacheKey(studyKey string, surveyKey string, excludedCols []string) string {
+	cols := slices.Clone(excludedCols)
+	slices.Sort(cols)
+	return studyKey + "|" + surveyKey + "|" + strings.Join(cols, ",")
+}
+
+// computedInfoCache holds the compiled expressions of computed participant infos, so each is compiled once per run
+type computedInfoCache struct {
+	mu       gosync.Mutex
+	programs map[string]*vm.Program
+}
+
+func newComputedInfoCache() *computedInfoCache {
+	return &computedInfoCache{
+		programs: make(map[string]*vm.Program),
+	}
+}
+
+// getOrCompile returns the program compiled from the expression
+func (c *computedInfoCache) getOrCompile(expression string) (*vm.Program, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if program, ok := c.programs[expression]; ok {
+		return program, nil
+	}
+
+	program, err := compileComputedInfo(expression)
+	if err != nil {
+		return nil, err
+	}
+	c.programs[expression] = program
+	return program, nil
+}
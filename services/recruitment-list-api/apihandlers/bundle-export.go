@@ -0,0 +1,431 @@
+package apihandlers
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	jwthandling "github.com/case-framework/case-backend/pkg/jwt-handling"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	rdb "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+)
+
+const (
+	bundleFileResponses        = "responses"
+	bundleFileParticipantInfos = "participantInfos"
+	bundleFileNotes            = "notes"
+	bundleFileStatusHistory    = "statusHistory"
+)
+
+type StartBundleDownloadRequest struct {
+	// surveys of the list's research data, all if empty
+	SurveyKeys []string   `json:"surveyKeys"`
+	StartDate  *time.Time `json:"startDate"`
+	EndDate    *time.Time `json:"endDate"`
+	// only data of participants matching the query
+	Filter *rdb.ParticipantQuery `json:"filter,omitempty"`
+	// encrypts the file for the requester
+	Encryption *DownloadEncryptionRequest `json:"encryption,omitempty"`
+}
+
+// BundleManifest describes the content of a bundle download, it is added to the ZIP as manifest.json
+type BundleManifest struct {
+	RecruitmentListID   string                `json:"recruitmentListId"`
+	RecruitmentListName string                `json:"recruitmentListName"`
+	StudyKey            string                `json:"studyKey"`
+	CreatedAt           time.Time             `json:"createdAt"`
+	CreatedBy           string                `json:"createdBy"`
+	FilterInfo          string                `json:"filterInfo"`
+	StartDate           *time.Time            `json:"startDate,omitempty"`
+	EndDate             *time.Time            `json:"endDate,omitempty"`
+	Filter              *rdb.ParticipantQuery `json:"filter,omitempty"`
+	Files               []BundleFile          `json:"files"`
+}
+
+type BundleFile struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	SurveyKey string `json:"surveyKey,omitempty"`
+	Rows      int    `json:"rows"`
+}
+
+func (h *HttpEndpoints) startBundleDownload(c *gin.Context) {
+	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
+
+	recruitmentListID := c.Param("id")
+	if recruitmentListID == "" {
+		slog.Warn("no recruitmentListID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recruitmentListID"})
+		return
+	}
+
+	var req StartBundleDownloadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("failed to bind request", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.Info("start bundle download", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID))
+
+	recruitmentList, err := h.recruitmentListDBConn.GetRecruitmentListByID(recruitmentListID)
+	if err != nil {
+		slog.Error("could not get recruitment list", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get recruitment list"})
+		return
+	}
+
+	surveyKeys := []string{}
+	for _, respDef := range recruitmentList.ParticipantData.ResearchData {
+		if !slices.Contains(surveyKeys, respDef.SurveyKey) {
+			surveyKeys = append(surveyKeys, respDef.SurveyKey)
+		}
+	}
+	if len(req.SurveyKeys) > 0 {
+		for _, surveyKey := range req.SurveyKeys {
+			if !slices.Contains(surveyKeys, surveyKey) {
+				slog.Warn("survey is not part of the research data", slog.String("surveyKey", surveyKey))
+				c.JSON(http.StatusBadRequest, gin.H{"error": "survey is not part of the research data: " + surveyKey})
+				return
+			}
+		}
+		surveyKeys = req.SurveyKeys
+	}
+
+	filterInfo := "Bundle: " + strings.Join(surveyKeys, ", ") + " "
+	if req.StartDate != nil {
+		filterInfo += "from " + req.StartDate.Format("2006-01-02") + " "
+	}
+	if req.EndDate != nil {
+		filterInfo += "to " + req.EndDate.Format("2006-01-02") + " "
+	}
+
+	var queryFilter bson.M
+	if req.Filter != nil {
+		queryFilter, err = h.participantQueryFilter(recruitmentList, req.Filter)
+		if err != nil {
+			slog.Error("invalid participant query", slog.String("error", err.Error()))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filter: " + err.Error()})
+			return
+		}
+		filterInfo += "for filtered participants "
+	}
+
+	encryption, err := h.getDownloadEncryption(token.Subject, req.Encryption)
+	if err != nil {
+		slog.Warn("invalid download encryption", slog.String("userID", token.Subject), slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := "bundle_" + time.Now().Format("2006-01-02-15-04-05") + ".zip"
+	exportFolder := ""
+	downloadFileName := encryptedFileName(filename, encryption)
+	path := filepath.Join(exportFolder, downloadFileName)
+
+	downloadInfo, err := h.recruitmentListDBConn.CreateDownload(
+		recruitmentListID,
+		strings.TrimSpace(filterInfo),
+		rdb.FILE_TYPE_ZIP,
+		downloadFileName,
+		path,
+		token.Subject,
+		h.downloadEncryptionInfo(encryption),
+	)
+	if err != nil {
+		slog.Error("could not create download", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create download"})
+		return
+	}
+
+	go func() {
+		file, err := h.createDownloadFile(path, filename, encryption)
+		if err != nil {
+			slog.Error("could not create file", slog.String("file path", path), slog.String("error", err.Error()))
+			if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DOWNLOAD_STATUS_ERROR); err != nil {
+				slog.Error("could not update download status", slog.String("error", err.Error()))
+			}
+			return
+		}
+		defer file.Close()
+
+		manifest := BundleManifest{
+			RecruitmentListID:   recruitmentListID,
+			RecruitmentListName: recruitmentList.Name,
+			StudyKey:            recruitmentList.ParticipantInclusion.StudyKey,
+			CreatedAt:           downloadInfo.CreatedAt,
+			CreatedBy:           downloadInfo.CreatedBy,
+			FilterInfo:          downloadInfo.FilterInfo,
+			StartDate:           req.StartDate,
+			EndDate:             req.EndDate,
+			Filter:              req.Filter,
+		}
+		if err := h.writeBundle(file, recruitmentList, surveyKeys, queryFilter, &manifest); err != nil {
+			slog.Error("failed to write bundle", slog.String("recruitmentListID", recruitmentListID), slog.String("error", err.Error()))
+			if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DOWNLOAD_STATUS_ERROR); err != nil {
+				slog.Error("could not update download status", slog.String("error", err.Error()))
+			}
+			return
+		}
+
+		h.closeDownloadFile(file, downloadInfo.ID.Hex())
+	}()
+
+	c.JSON(http.StatusOK, downloadInfo)
+}
+
+// writeBundle writes the ZIP with one response file per survey, participant infos, notes, status history and the manifest
+func (h *HttpEndpoints) writeBundle(w io.Writer, recruitmentList *rdb.RecruitmentList, surveyKeys []string, queryFilter bson.M, manifest *BundleManifest) error {
+	recruitmentListID := recruitmentList.ID.Hex()
+	zipWriter := zip.NewWriter(w)
+
+	// participant document IDs (used by notes) to participant IDs, only with filter
+	var participants map[string]string
+	if queryFilter != nil {
+		participants = map[string]string{}
+		if err := h.recruitmentListDBConn.IterateParticipantsByRecruitmentListID(
+			recruitmentListID,
+			queryFilter,
+			func(participant *rdb.Participant) error {
+				participants[participant.ID.Hex()] = participant.ParticipantID
+				return nil
+			},
+		); err != nil {
+			return err
+		}
+	}
+	participantIDs := map[string]bool{}
+	for _, participantID := range participants {
+		participantIDs[participantID] = true
+	}
+	includesParticipant := func(participantID string) bool {
+		return participants == nil || participantIDs[participantID]
+	}
+
+	for _, surveyKey := range surveyKeys {
+		filter := bson.M{
+			"recruitmentListId": recruitmentListID,
+			"surveyKey":         surveyKey,
+		}
+		arrivedAt := bson.M{}
+		if manifest.StartDate != nil {
+			arrivedAt["$gte"] = manifest.StartDate.Unix()
+		}
+		if manifest.EndDate != nil {
+			arrivedAt["$lte"] = manifest.EndDate.Unix()
+		}
+		if len(arrivedAt) > 0 {
+			filter["arrivedAt"] = arrivedAt
+		}
+
+		name := "responses/" + strings.ReplaceAll(surveyKey, "/", "_") + ".csv"
+		f, err := zipWriter.Create(name)
+		if err != nil {
+			return err
+		}
+		// the participants are filtered in memory, as their IDs could exceed the size limit of a query
+		rows, err := h.writeResponsesCSV(f, filter, h.getResponseExportHeaders(filter, responseExportFirstCols), includesParticipant)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, BundleFile{Name: name, Type: bundleFileResponses, SurveyKey: surveyKey, Rows: rows})
+	}
+
+	f, err := zipWriter.Create("participant-infos.csv")
+	if err != nil {
+		return err
+	}
+	rows, err := h.writeParticipantInfosCSV(f, recruitmentList, queryFilter)
+	if err != nil {
+		return err
+	}
+	manifest.Files = append(manifest.Files, BundleFile{Name: "participant-infos.csv", Type: bundleFileParticipantInfos, Rows: rows})
+
+	f, err = zipWriter.Create("notes.csv")
+	if err != nil {
+		return err
+	}
+	rows, err = h.writeParticipantNotesCSV(f, recruitmentListID, participants)
+	if err != nil {
+		return err
+	}
+	manifest.Files = append(manifest.Files, BundleFile{Name: "notes.csv", Type: bundleFileNotes, Rows: rows})
+
+	f, err = zipWriter.Create("status-history.csv")
+	if err != nil {
+		return err
+	}
+	rows, err = h.writeStatusHistoryCSV(f, recruitmentListID, includesParticipant)
+	if err != nil {
+		return err
+	}
+	manifest.Files = append(manifest.Files, BundleFile{Name: "status-history.csv", Type: bundleFileStatusHistory, Rows: rows})
+
+	f, err = zipWriter.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+
+	return zipWriter.Close()
+}
+
+// writeParticipantInfosCSV writes the participants matching the query with their infos and returns the number of rows
+func (h *HttpEndpoints) writeParticipantInfosCSV(w io.Writer, rlInfos *rdb.RecruitmentList, queryFilter bson.M) (int, error) {
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	// Prepare header line
+	record := []string{}
+	record = append(record, "Participant ID")
+	record = append(record, "Recruitment Status")
+	record = append(record, "Imported At")
+	record = append(record, "Deleted At")
+	for _, infoDef := range rlInfos.ParticipantData.ParticipantInfos {
+		record = append(record, infoDef.Label)
+	}
+	if err := writer.Write(record); err != nil {
+		return 0, err
+	}
+
+	// Content
+	rows := 0
+	if err := h.recruitmentListDBConn.IterateParticipantsByRecruitmentListID(
+		rlInfos.ID.Hex(),
+		queryFilter,
+		func(participant *rdb.Participant) error {
+			record := []string{}
+			record = append(record, participant.ParticipantID)
+			record = append(record, participant.RecruitmentStatus)
+			record = append(record, participant.IncludedAt.Format(time.RFC3339))
+
+			if participant.DeletedAt != nil {
+				record = append(record, participant.DeletedAt.Format(time.RFC3339))
+			} else {
+				record = append(record, "")
+			}
+
+			for _, infoDef := range rlInfos.ParticipantData.ParticipantInfos {
+				valueStr := ""
+				value, ok := participant.Infos[infoDef.Label]
+				if !ok {
+					valueStr = ""
+				} else {
+					switch typedValue := value.(type) {
+					case string:
+						valueStr = typedValue
+					case float64:
+						valueStr = strconv.FormatFloat(typedValue, 'f', -1, 64)
+					case int64:
+						valueStr = strconv.FormatInt(typedValue, 10)
+					case bool:
+						valueStr = strconv.FormatBool(typedValue)
+					case primitive.DateTime:
+						valueStr = typedValue.Time().UTC().Format(time.RFC3339)
+					case primitive.A:
+						items := make([]string, len(typedValue))
+						for i, item := range typedValue {
+							items[i] = fmt.Sprint(item)
+						}
+						valueStr = strings.Join(items, ",")
+					}
+				}
+				record = append(record, valueStr)
+			}
+			if err := writer.Write(record); err != nil {
+				slog.Error("failed to write to export file", slog.String("error", err.Error()))
+				return err
+			}
+			rows++
+			return nil
+		},
+	); err != nil {
+		slog.Error("could not iterate on participants", slog.String("error", err.Error()))
+		return rows, err
+	}
+	return rows, nil
+}
+
+// writeParticipantNotesCSV writes the notes of the list, only of the given participants (by document ID) if not nil
+func (h *HttpEndpoints) writeParticipantNotesCSV(w io.Writer, recruitmentListID string, participants map[string]string) (int, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"Participant ID", "Created At", "Created By", "Note"}); err != nil {
+		return 0, err
+	}
+
+	// without filter, the participant IDs are looked up per participant
+	rows := 0
+	lastPID, lastParticipantID := "", ""
+	if err := h.recruitmentListDBConn.IterateParticipantNotes(
+		recruitmentListID,
+		func(note *rdb.ParticipantNote) error {
+			participantID, ok := "", false
+			if participants != nil {
+				participantID, ok = participants[note.PID]
+				if !ok {
+					return nil
+				}
+			} else if note.PID == lastPID {
+				participantID = lastParticipantID
+			} else {
+				participant, err := h.recruitmentListDBConn.GetParticipantByID(note.PID, recruitmentListID)
+				if err == nil {
+					participantID = participant.ParticipantID
+				}
+				lastPID, lastParticipantID = note.PID, participantID
+			}
+
+			if err := writer.Write([]string{participantID, note.CreatedAt.Format(time.RFC3339), note.CreatedBy, note.Note}); err != nil {
+				return err
+			}
+			rows++
+			return nil
+		},
+	); err != nil {
+		return rows, err
+	}
+	writer.Flush()
+	return rows, writer.Error()
+}
+
+func (h *HttpEndpoints) writeStatusHistoryCSV(w io.Writer, recruitmentListID string, includesParticipant func(participantID string) bool) (int, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"Participant ID", "Changed At", "Changed By", "Old Status", "New Status"}); err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	if err := h.recruitmentListDBConn.IterateParticipantStatusChanges(
+		recruitmentListID,
+		func(change *rdb.ParticipantStatusChange) error {
+			if !includesParticipant(change.ParticipantID) {
+				return nil
+			}
+			if err := writer.Write([]string{change.ParticipantID, change.ChangedAt.Format(time.RFC3339), change.ChangedBy, change.OldStatus, change.NewStatus}); err != nil {
+				return err
+			}
+			rows++
+			return nil
+		},
+	); err != nil {
+		return rows, err
+	}
+	writer.Flush()
+	return rows, writer.Error()
+}
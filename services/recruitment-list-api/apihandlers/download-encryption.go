@@ -0,0 +1,258 @@
+package apihandlers
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	jwthandling "github.com/case-framework/case-backend/pkg/jwt-handling"
+	"github.com/gin-gonic/gin"
+
+	rdb "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+	"github.com/case-framework/recruitment-list-backend/pkg/filecrypt"
+)
+
+// DownloadEncryptionRequest encrypts a download for the requester, in addition to the encryption at rest
+type DownloadEncryptionRequest struct {
+	// password (AES encrypted ZIP) or publicKey (age, for the requester's registered key)
+	Method string `json:"method"`
+	// only for method password, it is not stored
+	Password string `json:"password,omitempty"`
+}
+
+type downloadEncryption struct {
+	method    string
+	password  string
+	recipient age.Recipient
+}
+
+// getDownloadEncryption validates the requested encryption, nil if the download is not encrypted for the requester
+func (h *HttpEndpoints) getDownloadEncryption(userID string, req *DownloadEncryptionRequest) (*downloadEncryption, error) {
+	if req == nil || req.Method == "" {
+		return nil, nil
+	}
+
+	switch req.Method {
+	case rdb.DOWNLOAD_ENCRYPTION_PASSWORD:
+		if len(req.Password) < filecrypt.MinPasswordLength {
+			return nil, errors.New("password must have at least 8 characters")
+		}
+		return &downloadEncryption{method: req.Method, password: req.Password}, nil
+	case rdb.DOWNLOAD_ENCRYPTION_PUBLIC_KEY:
+		user, err := h.recruitmentListDBConn.GetResearcherUserByID(userID)
+		if err != nil {
+			return nil, errors.New("could not get user")
+		}
+		if user.EncryptionPublicKey == "" {
+			return nil, errors.New("no public key registered")
+		}
+		recipient, err := age.ParseX25519Recipient(user.EncryptionPublicKey)
+		if err != nil {
+			return nil, errors.New("registered public key is invalid")
+		}
+		return &downloadEncryption{method: req.Method, recipient: recipient}, nil
+	default:
+		return nil, errors.New("unknown encryption method: " + req.Method)
+	}
+}
+
+// downloadEncryptionInfo is stored with the download, nil if the file is not encrypted
+func (h *HttpEndpoints) downloadEncryptionInfo(encryption *downloadEncryption) *rdb.DownloadEncryption {
+	if encryption == nil && h.filestoreKey == nil {
+		return nil
+	}
+	info := &rdb.DownloadEncryption{AtRest: h.filestoreKey != nil}
+	if encryption != nil {
+		info.Method = encryption.method
+	}
+	return info
+}
+
+// encryptedFileName is the name of the download file after the encryption for the requester
+func encryptedFileName(fileName string, encryption *downloadEncryption) string {
+	if encryption == nil {
+		return fileName
+	}
+	if encryption.method == rdb.DOWNLOAD_ENCRYPTION_PASSWORD {
+		return fileName + ".zip"
+	}
+	return fileName + ".age"
+}
+
+// downloadFile writes a download to the filestore, encrypted for the requester and at rest if configured.
+// Close has to succeed before the download is available.
+type downloadFile struct {
+	w io.Writer
+	// closed in order, the encryption layers before the file
+	closers []io.Closer
+	closed  bool
+}
+
+// createDownloadFile creates the file of a download, fileName is the name of the file inside an encrypted ZIP
+func (h *HttpEndpoints) createDownloadFile(path string, fileName string, encryption *downloadEncryption) (*downloadFile, error) {
+	file, err := os.Create(h.getFullFilePath(path))
+	if err != nil {
+		return nil, err
+	}
+	df := &downloadFile{w: file, closers: []io.Closer{file}}
+
+	if h.filestoreKey != nil {
+		w, err := filecrypt.NewWriter(df.w, h.filestoreKey)
+		if err != nil {
+			df.Close()
+			return nil, err
+		}
+		df.push(w)
+	}
+
+	if encryption != nil {
+		var w io.WriteCloser
+		if encryption.method == rdb.DOWNLOAD_ENCRYPTION_PASSWORD {
+			w, err = filecrypt.NewPasswordZipWriter(df.w, fileName, encryption.password)
+		} else {
+			w, err = age.Encrypt(df.w, encryption.recipient)
+		}
+		if err != nil {
+			df.Close()
+			return nil, err
+		}
+		df.push(w)
+	}
+	return df, nil
+}
+
+func (df *downloadFile) push(w io.WriteCloser) {
+	df.w = w
+	df.closers = append([]io.Closer{w}, df.closers...)
+}
+
+func (df *downloadFile) Write(p []byte) (int, error) {
+	return df.w.Write(p)
+}
+
+func (df *downloadFile) WriteString(s string) (int, error) {
+	return io.WriteString(df.w, s)
+}
+
+func (df *downloadFile) Close() error {
+	if df.closed {
+		return nil
+	}
+	df.closed = true
+
+	var firstErr error
+	for _, closer := range df.closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// openDownloadFile opens the stored file of the download, decrypted if encrypted at rest, with the size of the content
+func (h *HttpEndpoints) openDownloadFile(download *rdb.Download) (io.ReadCloser, int64, error) {
+	file, err := os.Open(h.getFullFilePath(download.Path))
+	if err != nil {
+		return nil, 0, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	if download.Encryption == nil || !download.Encryption.AtRest {
+		return file, stat.Size(), nil
+	}
+
+	if h.filestoreKey == nil {
+		file.Close()
+		return nil, 0, errors.New("file is encrypted, but no filestore key is configured")
+	}
+	r, err := filecrypt.NewReader(file, h.filestoreKey)
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, file}, filecrypt.PlaintextSize(stat.Size()), nil
+}
+
+// closeDownloadFile completes the file and makes the download available, or marks it as failed
+func (h *HttpEndpoints) closeDownloadFile(file *downloadFile, downloadID string) {
+	status := rdb.DONWLOAD_STATUS_AVAILABLE
+	if err := file.Close(); err != nil {
+		slog.Error("could not complete download file", slog.String("downloadID", downloadID), slog.String("error", err.Error()))
+		status = rdb.DOWNLOAD_STATUS_ERROR
+	}
+	if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadID, status); err != nil {
+		slog.Error("could not update download status", slog.String("error", err.Error()))
+	}
+}
+
+type UpdateEncryptionKeyRequest struct {
+	// age public key (age1...)
+	PublicKey string `json:"publicKey"`
+}
+
+func (h *HttpEndpoints) getMyEncryptionKey(c *gin.Context) {
+	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
+
+	slog.Info("get my encryption key", slog.String("userID", token.Subject))
+
+	user, err := h.recruitmentListDBConn.GetResearcherUserByID(token.Subject)
+	if err != nil {
+		slog.Error("could not get user", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"publicKey": user.EncryptionPublicKey})
+}
+
+func (h *HttpEndpoints) updateMyEncryptionKey(c *gin.Context) {
+	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
+
+	var req UpdateEncryptionKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("failed to bind request", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.Info("update my encryption key", slog.String("userID", token.Subject))
+
+	publicKey := strings.TrimSpace(req.PublicKey)
+	if _, err := age.ParseX25519Recipient(publicKey); err != nil {
+		slog.Warn("invalid public key", slog.String("userID", token.Subject), slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid public key, expected an age public key (age1...)"})
+		return
+	}
+
+	if err := h.recruitmentListDBConn.UpdateResearcherUserEncryptionPublicKey(token.Subject, publicKey); err != nil {
+		slog.Error("could not update encryption key", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update encryption key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"publicKey": publicKey})
+}
+
+func (h *HttpEndpoints) deleteMyEncryptionKey(c *gin.Context) {
+	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
+
+	slog.Info("delete my encryption key", slog.String("userID", token.Subject))
+
+	if err := h.recruitmentListDBConn.UpdateResearcherUserEncryptionPublicKey(token.Subject, ""); err != nil {
+		slog.Error("could not delete encryption key", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete encryption key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "encryption key deleted"})
+}
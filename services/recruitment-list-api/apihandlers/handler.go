@@ -24,7 +24,9 @@ type HttpEndpoints struct {
 	studyDBConn           *sdb.StudyDBService
 	tokenSignKey          string
 	filestorePath         string
+	filestoreKey          []byte
 	ttls                  TTLs
+	staleSyncTimeout      time.Duration
 	studyServiceConf      struct {
 		GlobalSecret string
 		InstanceID   string
@@ -36,7 +38,9 @@ func NewHTTPHandler(
 	recruitmentListDBConn *rdb.RecruitmentListDBService,
 	studyDBConn *sdb.StudyDBService,
 	filestorePath string,
+	filestoreKey []byte,
 	ttls TTLs,
+	staleSyncTimeout time.Duration,
 	studyGlobalSecret string,
 	studyInstanceID string,
 ) *HttpEndpoints {
@@ -47,7 +51,9 @@ func NewHTTPHandler(
 		recruitmentListDBConn: recruitmentListDBConn,
 		studyDBConn:           studyDBConn,
 		filestorePath:         filestorePath,
+		filestoreKey:          filestoreKey,
 		ttls:                  ttls,
+		staleSyncTimeout:      staleSyncTimeout,
 		studyServiceConf: struct {
 			GlobalSecret string
 			InstanceID   string
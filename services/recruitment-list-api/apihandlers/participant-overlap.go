@@ -0,0 +1,169 @@
+package apihandlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	jwthandling "github.com/case-framework/case-backend/pkg/jwt-handling"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+
+	rdb "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+	pc "github.com/case-framework/recruitment-list-backend/pkg/permission-checker"
+)
+
+// ParticipantInOtherList is the entry of a participant in another list of the same study
+type ParticipantInOtherList struct {
+	RecruitmentListID   string     `json:"recruitmentListId"`
+	RecruitmentListName string     `json:"recruitmentListName"`
+	ID                  string     `json:"id"`
+	RecruitmentStatus   string     `json:"recruitmentStatus"`
+	IncludedAt          time.Time  `json:"includedAt"`
+	DeletedAt           *time.Time `json:"deletedAt,omitempty"`
+}
+
+func (h *HttpEndpoints) getParticipantOtherLists(c *gin.Context) {
+	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
+
+	recruitmentListID := c.Param("id")
+	if recruitmentListID == "" {
+		slog.Warn("no recruitmentListID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recruitmentListID"})
+		return
+	}
+
+	participantID := c.Param("participantID")
+	if participantID == "" {
+		slog.Warn("no participantID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no participantID"})
+		return
+	}
+
+	slog.Info("get participant in other lists", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID), slog.String("participantID", participantID))
+
+	participant, err := h.recruitmentListDBConn.GetParticipantByID(participantID, recruitmentListID)
+	if err != nil {
+		slog.Error("could not get participant", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get participant"})
+		return
+	}
+
+	recruitmentList, err := h.recruitmentListDBConn.GetRecruitmentListByID(recruitmentListID)
+	if err != nil {
+		slog.Error("could not get recruitment list", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get recruitment list"})
+		return
+	}
+
+	// participant IDs are only unique within a study
+	listNames := map[string]string{}
+	if err := h.recruitmentListDBConn.FindAndExecuteOnRecruitmentLists(
+		bson.M{"participantInclusion.studyKey": recruitmentList.ParticipantInclusion.StudyKey},
+		func(list *rdb.RecruitmentList) error {
+			listNames[list.ID.Hex()] = list.Name
+			return nil
+		},
+	); err != nil {
+		slog.Error("could not get recruitment lists", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get recruitment lists"})
+		return
+	}
+
+	entries, err := h.recruitmentListDBConn.GetParticipantInOtherLists(participant.ParticipantID, recruitmentListID)
+	if err != nil {
+		slog.Error("could not get participant in other lists", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get participant in other lists"})
+		return
+	}
+
+	var permissions []rdb.Permission
+	if !token.IsAdmin {
+		permissions, err = h.recruitmentListDBConn.GetPermissionsByUserID(token.Subject)
+		if err != nil {
+			slog.Error("could not get permissions", slog.String("error", err.Error()))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get permissions"})
+			return
+		}
+	}
+
+	otherLists := []ParticipantInOtherList{}
+	for _, entry := range entries {
+		name, ok := listNames[entry.RecruitmentListID]
+		if !ok {
+			continue
+		}
+		if !token.IsAdmin {
+			visible, err := h.isParticipantVisible(entry, permissions)
+			if err != nil {
+				slog.Error("could not check participant visibility", slog.String("error", err.Error()))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not check permissions"})
+				return
+			}
+			if !visible {
+				continue
+			}
+		}
+		otherLists = append(otherLists, ParticipantInOtherList{
+			RecruitmentListID:   entry.RecruitmentListID,
+			RecruitmentListName: name,
+			ID:                  entry.ID.Hex(),
+			RecruitmentStatus:   entry.RecruitmentStatus,
+			IncludedAt:          entry.IncludedAt,
+			DeletedAt:           entry.DeletedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"otherLists": otherLists})
+}
+
+// isParticipantVisible checks if the permissions give access to the participant's list and the limiters allow the participant
+func (h *HttpEndpoints) isParticipantVisible(participant rdb.Participant, permissions []rdb.Permission) (bool, error) {
+	listPermissions := []rdb.Permission{}
+	for _, permission := range permissions {
+		if permission.ResourceID == participant.RecruitmentListID && (permission.Action == pc.ACTION_ACCESS_RECRUITMENT_LIST ||
+			permission.Action == pc.ACTION_MANAGE_RECRUITMENT_LIST ||
+			permission.Action == pc.ACTION_DELETE_RECRUITMENT_LIST) {
+			listPermissions = append(listPermissions, permission)
+		}
+	}
+	if len(listPermissions) == 0 {
+		return false, nil
+	}
+
+	limiterFilter, err := rdb.ParticipantFilterForPermissions(listPermissions, h.limiterValueConverter(participant.RecruitmentListID))
+	if err != nil {
+		return false, err
+	}
+	if limiterFilter == nil {
+		return true, nil
+	}
+	count, err := h.recruitmentListDBConn.CountParticipants(bson.M{"$and": bson.A{bson.M{"_id": participant.ID}, limiterFilter}})
+	return count > 0, err
+}
+
+// validateExcludeIfInLists checks that the excluding lists exist and belong to the same study
+func (h *HttpEndpoints) validateExcludeIfInLists(recruitmentList *rdb.RecruitmentList) error {
+	seen := []string{}
+	for _, listID := range recruitmentList.ParticipantInclusion.ExcludeIfInLists {
+		if !recruitmentList.ID.IsZero() && listID == recruitmentList.ID.Hex() {
+			return errors.New("a list cannot exclude itself")
+		}
+		if slices.Contains(seen, listID) {
+			return fmt.Errorf("duplicate list: %s", listID)
+		}
+		seen = append(seen, listID)
+
+		list, err := h.recruitmentListDBConn.GetRecruitmentListByID(listID)
+		if err != nil {
+			return fmt.Errorf("unknown list: %s", listID)
+		}
+		if list.ParticipantInclusion.StudyKey != recruitmentList.ParticipantInclusion.StudyKey {
+			return fmt.Errorf("list %s belongs to another study", listID)
+		}
+	}
+	return nil
+}
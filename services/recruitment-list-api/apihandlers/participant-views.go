@@ -0,0 +1,286 @@
+package apihandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	jwthandling "github.com/case-framework/case-backend/pkg/jwt-handling"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	rdb "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+)
+
+const maxParticipantViewPageSize = 500
+
+type ParticipantViewRequest struct {
+	Name     string                `json:"name"`
+	Filter   *rdb.ParticipantQuery `json:"filter,omitempty"`
+	Sort     *rdb.ParticipantSort  `json:"sort,omitempty"`
+	Columns  []string              `json:"columns,omitempty"`
+	PageSize int64                 `json:"pageSize,omitempty"`
+	Shared   bool                  `json:"shared"`
+}
+
+func (h *HttpEndpoints) getParticipantViews(c *gin.Context) {
+	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
+
+	recruitmentListID := c.Param("id")
+	if recruitmentListID == "" {
+		slog.Warn("no recruitmentListID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recruitmentListID"})
+		return
+	}
+
+	slog.Info("get participant views", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID))
+
+	views, err := h.recruitmentListDBConn.GetParticipantViewsForUser(recruitmentListID, token.Subject)
+	if err != nil {
+		slog.Error("could not get participant views", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get participant views"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"views": views})
+}
+
+func (h *HttpEndpoints) createParticipantView(c *gin.Context) {
+	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
+
+	recruitmentListID := c.Param("id")
+	if recruitmentListID == "" {
+		slog.Warn("no recruitmentListID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recruitmentListID"})
+		return
+	}
+
+	var req ParticipantViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("failed to bind request", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.Info("create participant view", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID))
+
+	if err := h.validateParticipantView(recruitmentListID, &req); err != nil {
+		slog.Warn("invalid participant view", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid participant view: " + err.Error()})
+		return
+	}
+
+	view, err := h.recruitmentListDBConn.CreateParticipantView(rdb.ParticipantView{
+		RecruitmentListID: recruitmentListID,
+		OwnerID:           token.Subject,
+		Name:              req.Name,
+		Filter:            req.Filter,
+		Sort:              req.Sort,
+		Columns:           req.Columns,
+		PageSize:          req.PageSize,
+		Shared:            req.Shared,
+	})
+	if err != nil {
+		slog.Error("could not create participant view", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create participant view"})
+		return
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+func (h *HttpEndpoints) updateParticipantView(c *gin.Context) {
+	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
+
+	recruitmentListID := c.Param("id")
+	if recruitmentListID == "" {
+		slog.Warn("no recruitmentListID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recruitmentListID"})
+		return
+	}
+
+	viewID := c.Param("viewID")
+	if viewID == "" {
+		slog.Warn("no viewID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no viewID"})
+		return
+	}
+
+	var req ParticipantViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("failed to bind request", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.Info("update participant view", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID), slog.String("viewID", viewID))
+
+	view, ok := h.getOwnParticipantView(c, token.Subject, recruitmentListID, viewID)
+	if !ok {
+		return
+	}
+
+	if err := h.validateParticipantView(recruitmentListID, &req); err != nil {
+		slog.Warn("invalid participant view", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid participant view: " + err.Error()})
+		return
+	}
+
+	view.Name = req.Name
+	view.Filter = req.Filter
+	view.Sort = req.Sort
+	view.Columns = req.Columns
+	view.PageSize = req.PageSize
+	view.Shared = req.Shared
+	if !view.Shared {
+		view.IsDefault = false
+	}
+
+	if err := h.recruitmentListDBConn.UpdateParticipantView(*view); err != nil {
+		slog.Error("could not update participant view", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update participant view"})
+		return
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+func (h *HttpEndpoints) deleteParticipantView(c *gin.Context) {
+	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
+
+	recruitmentListID := c.Param("id")
+	if recruitmentListID == "" {
+		slog.Warn("no recruitmentListID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recruitmentListID"})
+		return
+	}
+
+	viewID := c.Param("viewID")
+	if viewID == "" {
+		slog.Warn("no viewID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no viewID"})
+		return
+	}
+
+	slog.Info("delete participant view", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID), slog.String("viewID", viewID))
+
+	if _, ok := h.getOwnParticipantView(c, token.Subject, recruitmentListID, viewID); !ok {
+		return
+	}
+
+	if err := h.recruitmentListDBConn.DeleteParticipantView(viewID); err != nil {
+		slog.Error("could not delete participant view", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete participant view"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "participant view deleted"})
+}
+
+func (h *HttpEndpoints) setDefaultParticipantView(c *gin.Context) {
+	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
+
+	recruitmentListID := c.Param("id")
+	if recruitmentListID == "" {
+		slog.Warn("no recruitmentListID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recruitmentListID"})
+		return
+	}
+
+	var req struct {
+		ViewID string `json:"viewId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("failed to bind request", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.Info("set default participant view", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID), slog.String("viewID", req.ViewID))
+
+	if err := h.recruitmentListDBConn.SetDefaultParticipantView(recruitmentListID, req.ViewID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only shared views of the list can be the default view"})
+			return
+		}
+		slog.Error("could not set default participant view", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not set default participant view"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "default participant view set"})
+}
+
+// getOwnParticipantView loads the view and writes the error response if it doesn't exist or belongs to another user
+func (h *HttpEndpoints) getOwnParticipantView(c *gin.Context, userID string, recruitmentListID string, viewID string) (*rdb.ParticipantView, bool) {
+	view, err := h.recruitmentListDBConn.GetParticipantViewByID(viewID, recruitmentListID)
+	if err != nil {
+		slog.Error("could not get participant view", slog.String("error", err.Error()))
+		c.JSON(http.StatusNotFound, gin.H{"error": "participant view not found"})
+		return nil, false
+	}
+	if view.OwnerID != userID {
+		slog.Warn("participant view belongs to another user", slog.String("userID", userID), slog.String("viewID", viewID))
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the owner can change the participant view"})
+		return nil, false
+	}
+	return view, true
+}
+
+func (h *HttpEndpoints) validateParticipantView(recruitmentListID string, req *ParticipantViewRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if req.PageSize < 0 || req.PageSize > maxParticipantViewPageSize {
+		return errors.New("page size must not be negative or above 500")
+	}
+
+	recruitmentList, err := h.recruitmentListDBConn.GetRecruitmentListByID(recruitmentListID)
+	if err != nil {
+		return err
+	}
+	infoLabels := map[string]bool{}
+	for _, pInfoDef := range recruitmentList.ParticipantData.ParticipantInfos {
+		infoLabels[pInfoDef.Label] = true
+	}
+
+	seenColumns := map[string]bool{}
+	for _, column := range req.Columns {
+		if !infoLabels[column] {
+			return errors.New("unknown column: " + column)
+		}
+		if seenColumns[column] {
+			return errors.New("duplicate column: " + column)
+		}
+		seenColumns[column] = true
+	}
+	if req.Sort != nil {
+		if !rdb.IsParticipantQueryField(req.Sort.Field) {
+			return errors.New("unknown sort field: " + req.Sort.Field)
+		}
+		if label, ok := strings.CutPrefix(req.Sort.Field, "infos."); ok && !infoLabels[label] {
+			return errors.New("unknown sort field: " + req.Sort.Field)
+		}
+		if req.Sort.Order != "asc" && req.Sort.Order != "desc" {
+			return errors.New("sort order must be asc or desc")
+		}
+	}
+	if req.Filter != nil {
+		// the filter is stored as given, converting the values only checks it
+		raw, err := json.Marshal(req.Filter)
+		if err != nil {
+			return err
+		}
+		var query rdb.ParticipantQuery
+		if err := json.Unmarshal(raw, &query); err != nil {
+			return err
+		}
+		if _, err := h.participantQueryFilter(recruitmentList, &query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,12 +1,15 @@
 package apihandlers
 
 import (
-	"encoding/csv"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -16,6 +19,7 @@ import (
 	jwthandling "github.com/case-framework/case-backend/pkg/jwt-handling"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	studyService "github.com/case-framework/case-backend/pkg/study"
 	studyTypes "github.com/case-framework/case-backend/pkg/study/types"
@@ -30,6 +34,7 @@ func (h *HttpEndpoints) AddRecruitmentListsAPI(rg *gin.RouterGroup) {
 	{
 		recruitmentListsGroup.GET("", h.getRecruitmentLists)
 		recruitmentListsGroup.GET("/tags", h.getRecruitmentListTags)
+		recruitmentListsGroup.GET("/overview", mw.IsAdminUser(), h.getRecruitmentListsOverview)
 		recruitmentListsGroup.POST("",
 			mw.RequirePayload(),
 			h.useAuthorisedHandler(
@@ -75,6 +80,9 @@ func (h *HttpEndpoints) AddRecruitmentListsAPI(rg *gin.RouterGroup) {
 			rlManageGroup.POST("/sync-responses", h.syncResponses)
 			rlManageGroup.POST("/reset-participant-sync", h.resetParticipantSync)
 			rlManageGroup.POST("/reset-data-sync", h.resetDataSync)
+			rlManageGroup.POST("/pause-sync", h.pauseSync)
+			rlManageGroup.POST("/resume-sync", h.resumeSync)
+			rlManageGroup.PUT("/default-participant-view", mw.RequirePayload(), h.setDefaultParticipantView)
 		}
 
 		// Access recruitment list
@@ -94,7 +102,10 @@ func (h *HttpEndpoints) AddRecruitmentListsAPI(rg *gin.RouterGroup) {
 			participantGroup := rlAccessGroup.Group("/participants")
 			{
 				participantGroup.GET("", h.getParticipants)
+				participantGroup.GET("/info-changes", h.getRecentParticipantInfoChanges)
+				participantGroup.GET("/search", h.searchParticipants)
 				participantGroup.GET("/:participantID", h.getParticipant)
+				participantGroup.GET("/:participantID/other-lists", h.getParticipantOtherLists)
 				participantGroup.POST("/:participantID/status", h.updateParticipantStatus)
 				participantGroup.GET("/:participantID/notes", h.getParticipantNotes)
 				participantGroup.POST("/:participantID/notes", h.addParticipantNote)
@@ -102,13 +113,24 @@ func (h *HttpEndpoints) AddRecruitmentListsAPI(rg *gin.RouterGroup) {
 				participantGroup.DELETE("/:participantID/notes/:noteID", h.deleteParticipantNote)
 			}
 
+			participantViewGroup := rlAccessGroup.Group("/participant-views")
+			{
+				participantViewGroup.GET("", h.getParticipantViews)
+				participantViewGroup.POST("", mw.RequirePayload(), h.createParticipantView)
+				participantViewGroup.PUT("/:viewID", mw.RequirePayload(), h.updateParticipantView)
+				participantViewGroup.DELETE("/:viewID", h.deleteParticipantView)
+			}
+
 			rlAccessGroup.GET("/available-responses", h.getAvailableResponses)
+			rlAccessGroup.GET("/stats", h.getRecruitmentListStats)
 
 			downloadGroup := rlAccessGroup.Group("/downloads")
 			{
 				downloadGroup.GET("", h.getDownloads)
 				downloadGroup.POST("/prepare-response-file", mw.RequirePayload(), h.startResponseDownload)
 				downloadGroup.POST("/prepare-participant-infos-file", mw.RequirePayload(), h.startParticipantInfosDownload)
+				downloadGroup.POST("/prepare-bundle-file", mw.RequirePayload(), h.startBundleDownload)
+				downloadGroup.POST("/prepare-wide-file", mw.RequirePayload(), h.startWideDownload)
 				downloadGroup.GET("/:downloadID/status", h.getDownload)
 				downloadGroup.GET("/:downloadID", h.serveDownloadFile)
 				downloadGroup.DELETE("/:downloadID", h.deleteDownload)
@@ -130,6 +152,32 @@ func (h *HttpEndpoints) createRecruitmentList(c *gin.Context) {
 
 	slog.Info("create recruitment list", slog.String("userID", token.Subject))
 
+	if req.SyncConfig.Schedule != nil {
+		if _, err := sync.ParseSyncSchedule(*req.SyncConfig.Schedule); err != nil {
+			slog.Error("invalid sync schedule", slog.String("error", err.Error()))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sync schedule: " + err.Error()})
+			return
+		}
+	}
+
+	if _, err := sync.ParseResponseCheckInterval(req.SyncConfig.ResponseCheckInterval); err != nil {
+		slog.Error("invalid response check interval", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid response check interval: " + err.Error()})
+		return
+	}
+
+	if err := sync.ValidateParticipantInfos(req.ParticipantData.ParticipantInfos); err != nil {
+		slog.Error("invalid participant infos", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid participant infos: " + err.Error()})
+		return
+	}
+
+	if err := h.validateExcludeIfInLists(&req); err != nil {
+		slog.Error("invalid excluding lists", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid excludeIfInLists: " + err.Error()})
+		return
+	}
+
 	rl, err := h.recruitmentListDBConn.CreateRecruitmentList(req, token.Subject)
 	if err != nil {
 		slog.Error("could not create recruitment list", slog.String("error", err.Error()))
@@ -202,6 +250,40 @@ func (h *HttpEndpoints) getRecruitmentLists(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
+func (h *HttpEndpoints) getRecruitmentListsOverview(c *gin.Context) {
+	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
+
+	slog.Info("get recruitment lists overview", slog.String("userID", token.Subject))
+
+	overviews, err := h.recruitmentListDBConn.GetRecruitmentListsOverview(time.Now().Add(-h.staleSyncTimeout))
+	if err != nil {
+		slog.Error("could not get recruitment lists overview", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get recruitment lists overview"})
+		return
+	}
+
+	summary := gin.H{}
+	var participants, preparingDownloads int64
+	syncProblems := []string{}
+	for _, o := range overviews {
+		participants += o.ActiveParticipants
+		preparingDownloads += o.PreparingDownloads
+		if o.SyncHealth == rdb.SYNC_HEALTH_STUCK || o.SyncHealth == rdb.SYNC_HEALTH_FAILING {
+			syncProblems = append(syncProblems, o.RecruitmentList.ID.Hex())
+		}
+	}
+	summary["recruitmentLists"] = len(overviews)
+	summary["activeParticipants"] = participants
+	summary["preparingDownloads"] = preparingDownloads
+	// IDs of the lists with stuck or failing syncs
+	summary["syncProblems"] = syncProblems
+
+	c.JSON(http.StatusOK, gin.H{
+		"overviews": overviews,
+		"summary":   summary,
+	})
+}
+
 func (h *HttpEndpoints) getRecruitmentListTags(c *gin.Context) {
 	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
 
@@ -258,6 +340,49 @@ func (h *HttpEndpoints) updateRecruitmentList(c *gin.Context) {
 
 	slog.Info("update recruitment list", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID))
 
+	if req.SyncConfig.Schedule != nil {
+		if _, err := sync.ParseSyncSchedule(*req.SyncConfig.Schedule); err != nil {
+			slog.Error("invalid sync schedule", slog.String("error", err.Error()))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sync schedule: " + err.Error()})
+			return
+		}
+	}
+
+	if _, err := sync.ParseResponseCheckInterval(req.SyncConfig.ResponseCheckInterval); err != nil {
+		slog.Error("invalid response check interval", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid response check interval: " + err.Error()})
+		return
+	}
+
+	if err := sync.ValidateParticipantInfos(req.ParticipantData.ParticipantInfos); err != nil {
+		slog.Error("invalid participant infos", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid participant infos: " + err.Error()})
+		return
+	}
+
+	if err := h.validateExcludeIfInLists(&req); err != nil {
+		slog.Error("invalid excluding lists", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid excludeIfInLists: " + err.Error()})
+		return
+	}
+
+	storedList, err := h.recruitmentListDBConn.GetRecruitmentListByID(recruitmentListID)
+	if err != nil {
+		slog.Error("could not get recruitment list", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get recruitment list"})
+		return
+	}
+
+	// the paused state is only changed via the pause and resume endpoints
+	if storedList.SyncConfig.Schedule != nil && storedList.SyncConfig.Schedule.Paused {
+		if req.SyncConfig.Schedule == nil {
+			req.SyncConfig.Schedule = &rdb.SyncSchedule{}
+		}
+		req.SyncConfig.Schedule.Paused = true
+	} else if req.SyncConfig.Schedule != nil {
+		req.SyncConfig.Schedule.Paused = false
+	}
+
 	if err := h.recruitmentListDBConn.SaveRecruitmentList(req); err != nil {
 		slog.Error("could not update recruitment list", slog.String("error", err.Error()))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update recruitment list"})
@@ -384,6 +509,18 @@ func (h *HttpEndpoints) importParticipant(c *gin.Context) {
 		return
 	}
 
+	excluded, err := sync.IsExcludedByOtherLists(h.recruitmentListDBConn, rl, req.ParticipantID)
+	if err != nil {
+		slog.Error("could not check excluding lists", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not check excluding lists"})
+		return
+	}
+	if excluded {
+		slog.Warn("participant is in an excluding list", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID), slog.String("participantID", req.ParticipantID))
+		c.JSON(http.StatusConflict, gin.H{"error": "participant is already in a list that excludes it from this list"})
+		return
+	}
+
 	_, err = h.recruitmentListDBConn.CreateParticipant(req.ParticipantID, recruitmentListID, token.Subject)
 	if err != nil {
 		slog.Error("could not create participant", slog.String("error", err.Error()))
@@ -516,6 +653,7 @@ func (h *HttpEndpoints) syncParticipants(c *gin.Context) {
 
 	go func() {
 		if err := sync.SyncParticipantsForRL(
+			context.Background(),
 			h.recruitmentListDBConn,
 			h.studyDBConn,
 			recruitmentListID,
@@ -543,6 +681,7 @@ func (h *HttpEndpoints) syncResponses(c *gin.Context) {
 
 	go func() {
 		if err := sync.SyncResearchDataForRL(
+			context.Background(),
 			h.recruitmentListDBConn,
 			h.studyDBConn,
 			recruitmentListID,
@@ -569,12 +708,25 @@ func (h *HttpEndpoints) resetParticipantSync(c *gin.Context) {
 
 	slog.Info("reset all data", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID))
 
-	if err := h.recruitmentListDBConn.ResetParticipantSyncTime(recruitmentListID); err != nil {
-		slog.Error("could not reset participant sync", slog.String("error", err.Error()))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not reset participant sync"})
+	synced, ok := h.prepareSyncReset(c, recruitmentListID, true)
+	if !ok {
 		return
 	}
 
+	// reset sync info first, so nothing is deleted if a sync started in the meantime
+	if synced {
+		if err := h.recruitmentListDBConn.ResetParticipantSyncTime(recruitmentListID); err != nil {
+			slog.Error("could not reset participant sync", slog.String("error", err.Error()))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not reset participant sync"})
+			return
+		}
+		if err := h.recruitmentListDBConn.ResetDataSyncTime(recruitmentListID); err != nil {
+			slog.Error("could not reset data sync", slog.String("error", err.Error()))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not reset data sync"})
+			return
+		}
+	}
+
 	if err := h.recruitmentListDBConn.DeleteAllParticipantsByRecruitmentListID(recruitmentListID); err != nil {
 		slog.Error("could not delete all participants", slog.String("error", err.Error()))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete all participants"})
@@ -587,16 +739,21 @@ func (h *HttpEndpoints) resetParticipantSync(c *gin.Context) {
 		return
 	}
 
-	if err := h.recruitmentListDBConn.DeleteResearchDataByRecruitmentListID(recruitmentListID); err != nil {
-		slog.Error("could not delete all responses", slog.String("error", err.Error()))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete all responses"})
+	if err := h.recruitmentListDBConn.DeleteParticipantInfoChangesByRecruitmentListID(recruitmentListID); err != nil {
+		slog.Error("could not delete all participant info changes", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete all participant info changes"})
 		return
 	}
 
-	// reset sync info
-	if err := h.recruitmentListDBConn.ResetDataSyncTime(recruitmentListID); err != nil {
-		slog.Error("could not reset data sync", slog.String("error", err.Error()))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not reset data sync"})
+	if err := h.recruitmentListDBConn.DeleteParticipantStatusChangesByRecruitmentListID(recruitmentListID); err != nil {
+		slog.Error("could not delete all participant status changes", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete all participant status changes"})
+		return
+	}
+
+	if err := h.recruitmentListDBConn.DeleteResearchDataByRecruitmentListID(recruitmentListID); err != nil {
+		slog.Error("could not delete all responses", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete all responses"})
 		return
 	}
 
@@ -615,6 +772,20 @@ func (h *HttpEndpoints) resetDataSync(c *gin.Context) {
 
 	slog.Info("reset data sync", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID))
 
+	synced, ok := h.prepareSyncReset(c, recruitmentListID, false)
+	if !ok {
+		return
+	}
+
+	// reset sync info first, so nothing is deleted if a sync started in the meantime
+	if synced {
+		if err := h.recruitmentListDBConn.ResetDataSyncTime(recruitmentListID); err != nil {
+			slog.Error("could not reset data sync", slog.String("error", err.Error()))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not reset data sync"})
+			return
+		}
+	}
+
 	// remove all responses
 	if err := h.recruitmentListDBConn.DeleteResearchDataByRecruitmentListID(recruitmentListID); err != nil {
 		slog.Error("could not delete all responses", slog.String("error", err.Error()))
@@ -622,15 +793,78 @@ func (h *HttpEndpoints) resetDataSync(c *gin.Context) {
 		return
 	}
 
-	// reset sync info
-	if err := h.recruitmentListDBConn.ResetDataSyncTime(recruitmentListID); err != nil {
-		slog.Error("could not reset data sync", slog.String("error", err.Error()))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not reset data sync"})
+	if err := h.recruitmentListDBConn.ResetParticipantsDataSync(recruitmentListID); err != nil {
+		slog.Error("could not reset participants data sync", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not reset participants data sync"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "data sync reset"})
 }
 
+// prepareSyncReset responds with a conflict if a sync of the list is running (the participant sync only if checkParticipantSync)
+// and marks syncs without heartbeat for the stale sync timeout as interrupted, so they can be reset.
+// Returns whether the list has been synced before, and false for ok if a response was sent.
+func (h *HttpEndpoints) prepareSyncReset(c *gin.Context, recruitmentListID string, checkParticipantSync bool) (synced bool, ok bool) {
+	syncInfo, err := h.recruitmentListDBConn.GetSyncInfoByRLID(recruitmentListID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, true
+	} else if err != nil {
+		slog.Error("could not get sync info", slog.String("recruitmentListID", recruitmentListID), slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get sync info"})
+		return false, false
+	}
+
+	staleBefore := time.Now().Add(-h.staleSyncTimeout)
+	if checkParticipantSync && syncInfo.IsParticipantSyncActive(staleBefore) {
+		c.JSON(http.StatusConflict, gin.H{"error": "sync is running"})
+		return false, false
+	}
+	if syncInfo.IsDataSyncActive(staleBefore) {
+		c.JSON(http.StatusConflict, gin.H{"error": "data sync is running"})
+		return false, false
+	}
+
+	if err := h.recruitmentListDBConn.MarkStaleSyncsOfListInterrupted(recruitmentListID, staleBefore); err != nil {
+		slog.Error("could not mark stale syncs as interrupted", slog.String("recruitmentListID", recruitmentListID), slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not reset sync"})
+		return false, false
+	}
+	return true, true
+}
+
+func (h *HttpEndpoints) pauseSync(c *gin.Context) {
+	h.setSyncPaused(c, true)
+}
+
+func (h *HttpEndpoints) resumeSync(c *gin.Context) {
+	h.setSyncPaused(c, false)
+}
+
+func (h *HttpEndpoints) setSyncPaused(c *gin.Context, paused bool) {
+	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
+
+	recruitmentListID := c.Param("id")
+	if recruitmentListID == "" {
+		slog.Warn("no recruitmentListID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recruitmentListID"})
+		return
+	}
+
+	slog.Info("set sync paused", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID), slog.Bool("paused", paused))
+
+	if err := h.recruitmentListDBConn.UpdateRecruitmentListSyncPaused(recruitmentListID, paused); err != nil {
+		slog.Error("could not update sync paused", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update sync paused"})
+		return
+	}
+
+	if paused {
+		c.JSON(http.StatusOK, gin.H{"message": "sync paused"})
+	} else {
+		c.JSON(http.StatusOK, gin.H{"message": "sync resumed"})
+	}
+}
+
 func (h *HttpEndpoints) getParticipants(c *gin.Context) {
 	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
 
@@ -679,7 +913,40 @@ func (h *HttpEndpoints) getParticipants(c *gin.Context) {
 	}
 	participantIDFilter := c.DefaultQuery("participantId", "")
 	recruitmentStatusFilter := c.DefaultQuery("recruitmentStatus", "")
-	infosFilter := c.QueryMap("infos")
+
+	recruitmentList, err := h.recruitmentListDBConn.GetRecruitmentListByID(recruitmentListID)
+	if err != nil {
+		slog.Error("could not get recruitment list", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get recruitment list"})
+		return
+	}
+	infosFilter, infoRanges, err := parseInfoFilters(
+		recruitmentList.ParticipantData.ParticipantInfos,
+		c.QueryMap("infos"),
+		c.QueryMap("infosMin"),
+		c.QueryMap("infosMax"),
+	)
+	if err != nil {
+		slog.Error("could not parse infos filter", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "could not parse infos filter: " + err.Error()})
+		return
+	}
+
+	var queryFilter bson.M
+	if queryParam := c.DefaultQuery("filter", ""); queryParam != "" {
+		var query rdb.ParticipantQuery
+		if err := json.Unmarshal([]byte(queryParam), &query); err != nil {
+			slog.Error("could not parse participant query", slog.String("error", err.Error()))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "could not parse filter"})
+			return
+		}
+		queryFilter, err = h.participantQueryFilter(recruitmentList, &query)
+		if err != nil {
+			slog.Error("invalid participant query", slog.String("error", err.Error()))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filter: " + err.Error()})
+			return
+		}
+	}
 
 	// sort config
 	sortBy := c.DefaultQuery("sortBy", "includedAt")
@@ -691,6 +958,8 @@ func (h *HttpEndpoints) getParticipants(c *gin.Context) {
 		ParticipantID:     participantIDFilter,
 		RecruitmentStatus: recruitmentStatusFilter,
 		Infos:             infosFilter,
+		InfoRanges:        infoRanges,
+		Query:             queryFilter,
 	}
 
 	sort := rdb.ParticipantSort{
@@ -698,6 +967,35 @@ func (h *HttpEndpoints) getParticipants(c *gin.Context) {
 		Order: sortOrder,
 	}
 
+	// cursor mode: keyset pagination, total count only on request
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		if !rdb.IsParticipantQueryField(sort.Field) {
+			slog.Warn("invalid sort field for cursor", slog.String("sortBy", sort.Field))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sortBy"})
+			return
+		}
+		withCount := c.DefaultQuery("withCount", "false") == "true"
+
+		slog.Info("get participants", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID), slog.Bool("cursor", cursor != ""), slog.String("limit", limit), slog.Any("filter", pFilter), slog.Any("sort", sort))
+
+		participants, paginationInfo, err := h.recruitmentListDBConn.GetParticipantsByCursor(recruitmentListID, limitInt, pFilter, sort, cursor, withCount)
+		if err != nil {
+			if errors.Is(err, rdb.ErrInvalidCursor) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+				return
+			}
+			slog.Error("could not get participants", slog.String("error", err.Error()))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get participants"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"participants": participants,
+			"pagination":   paginationInfo,
+		})
+		return
+	}
+
 	slog.Info("get participants", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID), slog.String("page", page), slog.String("limit", limit), slog.Any("filter", pFilter), slog.Any("sort", sort))
 
 	participants, paginationInfo, err := h.recruitmentListDBConn.GetParticipantsByRecruitmentListID(recruitmentListID, pageInt, limitInt, pFilter, sort)
@@ -713,6 +1011,119 @@ func (h *HttpEndpoints) getParticipants(c *gin.Context) {
 	})
 }
 
+// parseInfoFilters converts the filter values of the participant infos to their value type.
+// An exact date matches the whole day, infos without definition are compared as strings.
+func parseInfoFilters(
+	pInfoDefs []rdb.ParticipantInfo,
+	exact map[string]string,
+	minValues map[string]string,
+	maxValues map[string]string,
+) (map[string]any, map[string]rdb.InfoRange, error) {
+	defsByLabel := map[string]rdb.ParticipantInfo{}
+	for _, pInfoDef := range pInfoDefs {
+		defsByLabel[pInfoDef.Label] = pInfoDef
+	}
+	convert := func(label string, value string) (any, error) {
+		pInfoDef, ok := defsByLabel[label]
+		if !ok {
+			return value, nil
+		}
+		// filter values are given in the default formats, not the mapped ones
+		pInfoDef.MappingOptions = nil
+		converted, err := sync.ConvertInfoValue(pInfoDef, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", label, err)
+		}
+		return converted, nil
+	}
+
+	infos := map[string]any{}
+	ranges := map[string]rdb.InfoRange{}
+	for label, value := range exact {
+		converted, err := convert(label, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch typedValue := converted.(type) {
+		case time.Time:
+			ranges[label] = rdb.InfoRange{Min: typedValue, Max: typedValue.Add(24*time.Hour - time.Millisecond)}
+		case []any:
+			// list infos match if they contain the value
+			infos[label] = value
+		default:
+			infos[label] = converted
+		}
+	}
+	for label, value := range minValues {
+		converted, err := convert(label, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		infoRange := ranges[label]
+		infoRange.Min = converted
+		ranges[label] = infoRange
+	}
+	for label, value := range maxValues {
+		converted, err := convert(label, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		infoRange := ranges[label]
+		infoRange.Max = converted
+		ranges[label] = infoRange
+	}
+	return infos, ranges, nil
+}
+
+// participantQueryFilter converts the values of participant info conditions to the value type of the info
+// and translates the query to a filter on the participants of the list
+func (h *HttpEndpoints) participantQueryFilter(recruitmentList *rdb.RecruitmentList, query *rdb.ParticipantQuery) (bson.M, error) {
+	defsByLabel := participantInfosByLabel(recruitmentList)
+
+	if err := query.ConvertValues(func(q *rdb.ParticipantQuery, value any) (any, error) {
+		label, ok := q.InfoLabel()
+		if !ok || q.Op == rdb.QueryOpContains || q.Op == rdb.QueryOpStartsWith {
+			return value, nil
+		}
+		return convertInfoQueryValue(defsByLabel, label, value)
+	}); err != nil {
+		return nil, err
+	}
+
+	return h.recruitmentListDBConn.ParticipantQueryFilter(recruitmentList.ID.Hex(), query)
+}
+
+func participantInfosByLabel(recruitmentList *rdb.RecruitmentList) map[string]rdb.ParticipantInfo {
+	defsByLabel := map[string]rdb.ParticipantInfo{}
+	for _, pInfoDef := range recruitmentList.ParticipantData.ParticipantInfos {
+		defsByLabel[pInfoDef.Label] = pInfoDef
+	}
+	return defsByLabel
+}
+
+// convertInfoQueryValue converts a value compared with a participant info to the value type of the info
+func convertInfoQueryValue(defsByLabel map[string]rdb.ParticipantInfo, label string, value any) (any, error) {
+	pInfoDef, ok := defsByLabel[label]
+	if !ok || pInfoDef.ValueType == rdb.InfoValueTypeList {
+		// list infos match if one of their items matches
+		return value, nil
+	}
+	pInfoDef.MappingOptions = nil
+	converted, err := sync.ConvertInfoValue(pInfoDef, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", label, err)
+	}
+	return converted, nil
+}
+
+func (h *HttpEndpoints) getParticipantQueryFilterForList(recruitmentListID string, query *rdb.ParticipantQuery) (bson.M, error) {
+	recruitmentList, err := h.recruitmentListDBConn.GetRecruitmentListByID(recruitmentListID)
+	if err != nil {
+		return nil, err
+	}
+	return h.participantQueryFilter(recruitmentList, query)
+}
+
 func (h *HttpEndpoints) getParticipant(c *gin.Context) {
 	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
 
@@ -739,9 +1150,106 @@ func (h *HttpEndpoints) getParticipant(c *gin.Context) {
 		return
 	}
 
+	participant.InfoHistory, err = h.recruitmentListDBConn.GetParticipantInfoChanges(participant.ParticipantID, recruitmentListID)
+	if err != nil {
+		slog.Error("could not get participant info changes", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get participant info changes"})
+		return
+	}
+
 	c.JSON(http.StatusOK, participant)
 }
 
+func (h *HttpEndpoints) getRecentParticipantInfoChanges(c *gin.Context) {
+	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
+
+	recruitmentListID := c.Param("id")
+	if recruitmentListID == "" {
+		slog.Warn("no recruitmentListID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recruitmentListID"})
+		return
+	}
+
+	limit := c.DefaultQuery("limit", "100")
+	limitInt, err := strconv.ParseInt(limit, 10, 64)
+	if err != nil || limitInt < 1 {
+		slog.Error("could not parse limit", slog.String("limit", limit))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "could not parse limit"})
+		return
+	}
+
+	sinceFilter := c.DefaultQuery("since", "")
+	var since *time.Time
+	if sinceFilter != "" {
+		t, err := time.Parse(time.RFC3339, sinceFilter)
+		if err != nil {
+			slog.Error("could not parse since", slog.String("error", err.Error()))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "could not parse since"})
+			return
+		}
+		since = &t
+	}
+
+	labels := c.QueryArray("label")
+
+	slog.Info("get recent participant info changes", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID), slog.String("since", sinceFilter), slog.Any("labels", labels))
+
+	changes, err := h.recruitmentListDBConn.GetRecentParticipantInfoChanges(recruitmentListID, since, labels, limitInt)
+	if err != nil {
+		slog.Error("could not get participant info changes", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get participant info changes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"changes": changes})
+}
+
+const maxParticipantSearchLimit = 100
+
+func (h *HttpEndpoints) searchParticipants(c *gin.Context) {
+	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
+
+	recruitmentListID := c.Param("id")
+	if recruitmentListID == "" {
+		slog.Warn("no recruitmentListID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recruitmentListID"})
+		return
+	}
+
+	searchText := strings.TrimSpace(c.DefaultQuery("q", ""))
+	if len([]rune(searchText)) < 2 {
+		slog.Warn("search text too short")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "search text must have at least 2 characters"})
+		return
+	}
+
+	limit := c.DefaultQuery("limit", "20")
+	limitInt, err := strconv.ParseInt(limit, 10, 64)
+	if err != nil || limitInt < 1 || limitInt > maxParticipantSearchLimit {
+		slog.Error("could not parse limit", slog.String("limit", limit))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "could not parse limit"})
+		return
+	}
+
+	slog.Info("search participants", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID))
+
+	restriction, err := h.getParticipantLimiterFilter(token, recruitmentListID)
+	if err != nil {
+		slog.Error("could not get participant limiter", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get permissions"})
+		return
+	}
+
+	hits, err := h.recruitmentListDBConn.SearchParticipants(recruitmentListID, searchText, restriction, limitInt)
+	if err != nil {
+		slog.Error("could not search participants", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not search participants"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"hits": hits})
+}
+
 type UpdateParticipantStatusRequest struct {
 	Status string `json:"status"`
 }
@@ -771,11 +1279,31 @@ func (h *HttpEndpoints) updateParticipantStatus(c *gin.Context) {
 
 	slog.Info("update participant status", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID), slog.String("participantID", participantID))
 
+	participant, err := h.recruitmentListDBConn.GetParticipantByID(participantID, recruitmentListID)
+	if err != nil {
+		slog.Error("could not get participant", slog.String("error", err.Error()))
+		c.JSON(http.StatusNotFound, gin.H{"error": "participant not found"})
+		return
+	}
+
 	if err := h.recruitmentListDBConn.UpdateParticipantStatus(participantID, recruitmentListID, req.Status); err != nil {
 		slog.Error("could not update participant status", slog.String("error", err.Error()))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update participant status"})
 		return
 	}
+
+	if participant.RecruitmentStatus != req.Status {
+		if err := h.recruitmentListDBConn.SaveParticipantStatusChange(rdb.ParticipantStatusChange{
+			ParticipantID:     participant.ParticipantID,
+			RecruitmentListID: recruitmentListID,
+			OldStatus:         participant.RecruitmentStatus,
+			NewStatus:         req.Status,
+			ChangedAt:         time.Now(),
+			ChangedBy:         token.Subject,
+		}); err != nil {
+			slog.Error("could not save participant status change", slog.String("error", err.Error()))
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "participant status updated"})
 }
 
@@ -1040,11 +1568,14 @@ func (h *HttpEndpoints) executeParticipantAction(c *gin.Context) {
 			DataSyncStartedAt: &old,
 		}
 	}
-	if err := sync.SyncDataForParticipant(h.recruitmentListDBConn, h.studyDBConn, recruitmentList, ruiParticipant, h.studyServiceConf.InstanceID, studyKey, lastDataSyncInfo, h.studyServiceConf.GlobalSecret, true); err != nil {
+	session := sync.NewSyncSession()
+	session.Source = rdb.INFO_CHANGE_SOURCE_ACTION
+	if err := sync.SyncDataForParticipant(session, h.recruitmentListDBConn, h.studyDBConn, recruitmentList, ruiParticipant, h.studyServiceConf.InstanceID, studyKey, lastDataSyncInfo, h.studyServiceConf.GlobalSecret, true); err != nil {
 		slog.Error("could not sync data for participant", slog.String("error", err.Error()))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not sync data for participant"})
 		return
 	}
+	sync.SendInfoChangeNotifications(session, recruitmentList)
 
 	c.JSON(http.StatusOK, gin.H{"message": "participant action executed"})
 }
@@ -1095,6 +1626,66 @@ func (h *HttpEndpoints) getAvailableResponses(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"infos": infos})
 }
 
+func (h *HttpEndpoints) getRecruitmentListStats(c *gin.Context) {
+	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
+
+	recruitmentListID := c.Param("id")
+	if recruitmentListID == "" {
+		slog.Warn("no recruitmentListID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recruitmentListID"})
+		return
+	}
+
+	opts := rdb.StatsOptions{
+		Interval: c.DefaultQuery("interval", rdb.STATS_INTERVAL_DAY),
+		TimeZone: c.DefaultQuery("tz", ""),
+	}
+	switch opts.Interval {
+	case rdb.STATS_INTERVAL_DAY:
+		opts.Since = time.Now().AddDate(0, 0, -90)
+	case rdb.STATS_INTERVAL_WEEK:
+		opts.Since = time.Now().AddDate(0, 0, -7*52)
+	default:
+		slog.Warn("invalid stats interval", slog.String("interval", opts.Interval))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be day or week"})
+		return
+	}
+	if opts.TimeZone != "" {
+		if _, err := time.LoadLocation(opts.TimeZone); err != nil {
+			slog.Warn("invalid time zone", slog.String("tz", opts.TimeZone))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tz"})
+			return
+		}
+	}
+	if sinceQuery := c.DefaultQuery("since", ""); sinceQuery != "" {
+		t, err := time.Parse(time.RFC3339, sinceQuery)
+		if err != nil {
+			slog.Error("could not parse since", slog.String("error", err.Error()))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "could not parse since"})
+			return
+		}
+		opts.Since = t
+	}
+
+	slog.Info("get recruitment list stats", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID), slog.String("interval", opts.Interval))
+
+	recruitmentList, err := h.recruitmentListDBConn.GetRecruitmentListByID(recruitmentListID)
+	if err != nil {
+		slog.Error("could not get recruitment list", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get recruitment list"})
+		return
+	}
+	opts.StatusValues = recruitmentList.Customization.RecruitmentStatusValues
+
+	stats, err := h.recruitmentListDBConn.GetRecruitmentListStats(recruitmentListID, opts)
+	if err != nil {
+		slog.Error("could not get recruitment list stats", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get recruitment list stats"})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
 func (h *HttpEndpoints) getDownloads(c *gin.Context) {
 	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
 
@@ -1126,6 +1717,12 @@ type StartResponseDownloadRequest struct {
 	StartDate     *time.Time `json:"startDate"`
 	EndDate       *time.Time `json:"endDate"`
 	Format        string     `json:"format"`
+	// only responses of participants matching the query
+	Filter *rdb.ParticipantQuery `json:"filter,omitempty"`
+	// language of the variable and value labels of the sav and csv-codebook formats
+	LabelLanguage string `json:"labelLanguage,omitempty"`
+	// encrypts the file for the requester
+	Encryption *DownloadEncryptionRequest `json:"encryption,omitempty"`
 }
 
 func contains(slice []string, str string) bool {
@@ -1156,13 +1753,23 @@ func (h *HttpEndpoints) startResponseDownload(c *gin.Context) {
 		return
 	}
 
-	ext := ".csv"
-	if req.Format == rdb.FILE_TYPE_JSON {
-		ext = ".json"
+	switch req.Format {
+	case rdb.FILE_TYPE_JSON, rdb.FILE_TYPE_XLSX, rdb.FILE_TYPE_SAV, rdb.FILE_TYPE_CSV_CODEBOOK:
+	default:
+		req.Format = rdb.FILE_TYPE_CSV
 	}
+	ext := downloadFileExtension(req.Format)
+	encryption, err := h.getDownloadEncryption(token.Subject, req.Encryption)
+	if err != nil {
+		slog.Warn("invalid download encryption", slog.String("userID", token.Subject), slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	filename := "responses_" + req.SurveyKey + "_" + time.Now().Format("2006-01-02-15-04-05") + ext
 	exportFolder := ""
-	path := filepath.Join(exportFolder, filename)
+	downloadFileName := encryptedFileName(filename, encryption)
+	path := filepath.Join(exportFolder, downloadFileName)
 
 	filterInfo := req.SurveyKey + " "
 	if req.StartDate != nil {
@@ -1175,13 +1782,31 @@ func (h *HttpEndpoints) startResponseDownload(c *gin.Context) {
 		filterInfo += "for participant " + req.ParticipantID + " "
 	}
 
+	var filteredParticipantIDs []string
+	if req.Filter != nil {
+		queryFilter, err := h.getParticipantQueryFilterForList(recruitmentListID, req.Filter)
+		if err != nil {
+			slog.Error("invalid participant query", slog.String("error", err.Error()))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filter: " + err.Error()})
+			return
+		}
+		filteredParticipantIDs, err = h.recruitmentListDBConn.GetParticipantIDsByQuery(recruitmentListID, queryFilter)
+		if err != nil {
+			slog.Error("could not get participants for filter", slog.String("error", err.Error()))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get participants for filter"})
+			return
+		}
+		filterInfo += "for filtered participants "
+	}
+
 	downloadInfo, err := h.recruitmentListDBConn.CreateDownload(
 		recruitmentListID,
 		filterInfo,
 		req.Format,
-		filename,
+		downloadFileName,
 		path,
 		token.Subject,
+		h.downloadEncryptionInfo(encryption),
 	)
 	if err != nil {
 		slog.Error("could not create download", slog.String("error", err.Error()))
@@ -1190,10 +1815,9 @@ func (h *HttpEndpoints) startResponseDownload(c *gin.Context) {
 	}
 
 	go func() {
-		fullpath := h.getFullFilePath(path)
-		file, err := os.Create(fullpath)
+		file, err := h.createDownloadFile(path, filename, encryption)
 		if err != nil {
-			slog.Error("could not create file", slog.String("file path", fullpath), slog.String("error", err.Error()))
+			slog.Error("could not create file", slog.String("file path", path), slog.String("error", err.Error()))
 			if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DOWNLOAD_STATUS_ERROR); err != nil {
 				slog.Error("could not update download status", slog.String("error", err.Error()))
 			}
@@ -1208,92 +1832,23 @@ func (h *HttpEndpoints) startResponseDownload(c *gin.Context) {
 		if req.ParticipantID != "" {
 			filter["participantId"] = req.ParticipantID
 		}
+		if req.Filter != nil {
+			filter["$and"] = bson.A{bson.M{"participantId": bson.M{"$in": filteredParticipantIDs}}}
+		}
 		if req.StartDate != nil && req.EndDate != nil {
 			filter["arrivedAt"] = bson.M{"$gte": req.StartDate.Unix(), "$lte": req.EndDate.Unix()}
 		}
 
 		if req.Format == rdb.FILE_TYPE_CSV {
-			firstCols := []string{
-				"ID", "participantID", "submitted",
-			}
-
-			headerSet := make(map[string]struct{})
-
-			if err := h.recruitmentListDBConn.IterateOnResponseData(
-				filter,
-				func(responseData *rdb.ResponseData) error {
-					for key := range responseData.Response {
-						if !contains(firstCols, key) {
-							headerSet[key] = struct{}{}
-						}
-					}
-					return nil
-				},
-			); err != nil {
-				slog.Error("unexpected error", slog.String("error", err.Error()))
-			}
-
-			// Convert the remaining set to a slice and sort it
-			var otherHeaders []string
-			for key := range headerSet {
-				otherHeaders = append(otherHeaders, key)
-			}
-			sort.Slice(otherHeaders, func(i, j int) bool {
-				return strings.ToLower(otherHeaders[i]) < strings.ToLower(otherHeaders[j])
-			})
-
-			// Combine firstColumns with otherHeaders
-			headers := append(firstCols, otherHeaders...)
+			otherHeaders := h.getResponseExportHeaders(filter, responseExportFirstCols)
 
-			writer := csv.NewWriter(file)
-			defer writer.Flush()
-
-			err = writer.Write(headers)
-			if err != nil {
+			if _, err := h.writeResponsesCSV(file, filter, otherHeaders, nil); err != nil {
 				slog.Error("failed to write header", slog.String("error", err.Error()))
 				if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DOWNLOAD_STATUS_ERROR); err != nil {
 					slog.Error("could not update download status", slog.String("error", err.Error()))
 				}
 				return
 			}
-
-			if err := h.recruitmentListDBConn.IterateOnResponseData(
-				filter,
-				func(responseData *rdb.ResponseData) error {
-					record := []string{}
-					record = append(record, responseData.ResponseID)
-					record = append(record, responseData.ParticipantID)
-					record = append(record, strconv.FormatInt(responseData.Response["submitted"].(int64), 10))
-
-					for _, key := range otherHeaders {
-						valueStr := ""
-						value, ok := responseData.Response[key]
-						if !ok {
-							valueStr = ""
-						} else {
-							switch typedValue := value.(type) {
-							case string:
-								valueStr = typedValue
-							case float64:
-								valueStr = strconv.FormatFloat(typedValue, 'f', -1, 64)
-							case int64:
-								valueStr = strconv.FormatInt(typedValue, 10)
-							case bool:
-								valueStr = strconv.FormatBool(typedValue)
-							}
-						}
-						record = append(record, valueStr)
-					}
-					err = writer.Write(record)
-					if err != nil {
-						slog.Error("failed to write to export file", slog.String("error", err.Error()))
-						return err
-					}
-					return nil
-				},
-			); err != nil {
-				slog.Error("unexpected error", slog.String("error", err.Error()))
-			}
 		} else if req.Format == rdb.FILE_TYPE_JSON {
 			_, err = file.WriteString("{\"responses\": [")
 			if err != nil {
@@ -1342,18 +1897,100 @@ func (h *HttpEndpoints) startResponseDownload(c *gin.Context) {
 					slog.Error("failed to write footer", slog.String("error", err.Error()))
 				}
 			}
-		}
+		} else if req.Format == rdb.FILE_TYPE_XLSX {
+			otherHeaders := h.getResponseExportHeaders(filter, responseExportFirstCols)
 
-		if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DONWLOAD_STATUS_AVAILABLE); err != nil {
-			slog.Error("could not update download status", slog.String("error", err.Error()))
+			xlsx, err := newXLSXExport(slices.Concat(responseExportFirstCols, otherHeaders))
+			if err != nil {
+				slog.Error("failed to create xlsx export", slog.String("error", err.Error()))
+				if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DOWNLOAD_STATUS_ERROR); err != nil {
+					slog.Error("could not update download status", slog.String("error", err.Error()))
+				}
+				return
+			}
+
+			if err := h.recruitmentListDBConn.IterateOnResponseData(
+				filter,
+				func(responseData *rdb.ResponseData) error {
+					row := []any{responseData.ResponseID, responseData.ParticipantID, nil}
+					if submitted, ok := responseData.Response["submitted"].(int64); ok {
+						row[2] = time.Unix(submitted, 0)
+					}
+					for _, key := range otherHeaders {
+						row = append(row, responseData.Response[key])
+					}
+					if err := xlsx.WriteRow(row); err != nil {
+						slog.Error("failed to write to export file", slog.String("error", err.Error()))
+						return err
+					}
+					return nil
+				},
+			); err != nil {
+				slog.Error("could not iterate on response data", slog.String("error", err.Error()))
+				xlsx.Close()
+				if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DOWNLOAD_STATUS_ERROR); err != nil {
+					slog.Error("could not update download status", slog.String("error", err.Error()))
+				}
+				return
+			}
+
+			if err := xlsx.Save(file, xlsxExportMetadata("Responses", downloadInfo, xlsx.Rows())); err != nil {
+				slog.Error("failed to write xlsx export", slog.String("error", err.Error()))
+				if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DOWNLOAD_STATUS_ERROR); err != nil {
+					slog.Error("could not update download status", slog.String("error", err.Error()))
+				}
+				return
+			}
+		} else if req.Format == rdb.FILE_TYPE_SAV || req.Format == rdb.FILE_TYPE_CSV_CODEBOOK {
+			if err := h.writeLabelledResponses(file, req.Format, recruitmentListID, req.SurveyKey, req.LabelLanguage, filter); err != nil {
+				slog.Error("failed to write labelled export", slog.String("format", req.Format), slog.String("error", err.Error()))
+				if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DOWNLOAD_STATUS_ERROR); err != nil {
+					slog.Error("could not update download status", slog.String("error", err.Error()))
+				}
+				return
+			}
 		}
+
+		h.closeDownloadFile(file, downloadInfo.ID.Hex())
 	}()
 
 	c.JSON(http.StatusOK, downloadInfo)
 }
 
+// getResponseExportHeaders collects the response keys of the matching responses that are not in firstCols, sorted case-insensitively
+func (h *HttpEndpoints) getResponseExportHeaders(filter bson.M, firstCols []string) []string {
+	headerSet := make(map[string]struct{})
+
+	if err := h.recruitmentListDBConn.IterateOnResponseData(
+		filter,
+		func(responseData *rdb.ResponseData) error {
+			for key := range responseData.Response {
+				if !contains(firstCols, key) {
+					headerSet[key] = struct{}{}
+				}
+			}
+			return nil
+		},
+	); err != nil {
+		slog.Error("unexpected error", slog.String("error", err.Error()))
+	}
+
+	// Convert the remaining set to a slice and sort it
+	var otherHeaders []string
+	for key := range headerSet {
+		otherHeaders = append(otherHeaders, key)
+	}
+	sort.Slice(otherHeaders, func(i, j int) bool {
+		return strings.ToLower(otherHeaders[i]) < strings.ToLower(otherHeaders[j])
+	})
+	return otherHeaders
+}
+
 type StartParticipantInfosDownloadRequest struct {
-	Format string `json:"format"`
+	Format string                `json:"format"`
+	Filter *rdb.ParticipantQuery `json:"filter,omitempty"`
+	// encrypts the file for the requester
+	Encryption *DownloadEncryptionRequest `json:"encryption,omitempty"`
 }
 
 func (h *HttpEndpoints) startParticipantInfosDownload(c *gin.Context) {
@@ -1375,26 +2012,47 @@ func (h *HttpEndpoints) startParticipantInfosDownload(c *gin.Context) {
 
 	slog.Info("start participant infos download", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID), slog.String("format", req.Format))
 
-	ext := ".csv"
-	if req.Format == rdb.FILE_TYPE_JSON {
-		ext = ".json"
-	} else {
+	switch req.Format {
+	case rdb.FILE_TYPE_JSON, rdb.FILE_TYPE_XLSX:
+	default:
 		req.Format = rdb.FILE_TYPE_CSV
 	}
+	ext := downloadFileExtension(req.Format)
+
+	encryption, err := h.getDownloadEncryption(token.Subject, req.Encryption)
+	if err != nil {
+		slog.Warn("invalid download encryption", slog.String("userID", token.Subject), slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	filename := "participant-infos_" + time.Now().Format("2006-01-02-15-04-05") + ext
 	exportFolder := ""
-	path := filepath.Join(exportFolder, filename)
+	downloadFileName := encryptedFileName(filename, encryption)
+	path := filepath.Join(exportFolder, downloadFileName)
 
 	filterInfo := "Participant infos"
 
+	var queryFilter bson.M
+	if req.Filter != nil {
+		var err error
+		queryFilter, err = h.getParticipantQueryFilterForList(recruitmentListID, req.Filter)
+		if err != nil {
+			slog.Error("invalid participant query", slog.String("error", err.Error()))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filter: " + err.Error()})
+			return
+		}
+		filterInfo += " (filtered)"
+	}
+
 	downloadInfo, err := h.recruitmentListDBConn.CreateDownload(
 		recruitmentListID,
 		filterInfo,
 		req.Format,
-		filename,
+		downloadFileName,
 		path,
 		token.Subject,
+		h.downloadEncryptionInfo(encryption),
 	)
 	if err != nil {
 		slog.Error("could not create download", slog.String("error", err.Error()))
@@ -1403,10 +2061,9 @@ func (h *HttpEndpoints) startParticipantInfosDownload(c *gin.Context) {
 	}
 
 	go func() {
-		fullpath := h.getFullFilePath(path)
-		file, err := os.Create(fullpath)
+		file, err := h.createDownloadFile(path, filename, encryption)
 		if err != nil {
-			slog.Error("could not create file", slog.String("file path", fullpath), slog.String("error", err.Error()))
+			slog.Error("could not create file", slog.String("file path", path), slog.String("error", err.Error()))
 			if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DOWNLOAD_STATUS_ERROR); err != nil {
 				slog.Error("could not update download status", slog.String("error", err.Error()))
 			}
@@ -1424,71 +2081,13 @@ func (h *HttpEndpoints) startParticipantInfosDownload(c *gin.Context) {
 				return
 			}
 
-			writer := csv.NewWriter(file)
-			defer writer.Flush()
-
-			// Prepare header line
-			record := []string{}
-			record = append(record, "Participant ID")
-			record = append(record, "Recruitment Status")
-			record = append(record, "Imported At")
-			record = append(record, "Deleted At")
-			for _, infoDef := range rlInfos.ParticipantData.ParticipantInfos {
-				record = append(record, infoDef.Label)
-			}
-			err = writer.Write(record)
-			if err != nil {
+			if _, err := h.writeParticipantInfosCSV(file, rlInfos, queryFilter); err != nil {
 				slog.Error("failed to write header", slog.String("error", err.Error()))
 				if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DOWNLOAD_STATUS_ERROR); err != nil {
 					slog.Error("could not update download status", slog.String("error", err.Error()))
 				}
 				return
 			}
-
-			// Content
-			if err := h.recruitmentListDBConn.IterateParticipantsByRecruitmentListID(
-				recruitmentListID,
-				func(participant *rdb.Participant) error {
-					record := []string{}
-					record = append(record, participant.ParticipantID)
-					record = append(record, participant.RecruitmentStatus)
-					record = append(record, participant.IncludedAt.Format(time.RFC3339))
-
-					if participant.DeletedAt != nil {
-						record = append(record, participant.DeletedAt.Format(time.RFC3339))
-					} else {
-						record = append(record, "")
-					}
-
-					for _, infoDef := range rlInfos.ParticipantData.ParticipantInfos {
-						valueStr := ""
-						value, ok := participant.Infos[infoDef.Label]
-						if !ok {
-							valueStr = ""
-						} else {
-							switch typedValue := value.(type) {
-							case string:
-								valueStr = typedValue
-							case float64:
-								valueStr = strconv.FormatFloat(typedValue, 'f', -1, 64)
-							case int64:
-								valueStr = strconv.FormatInt(typedValue, 10)
-							case bool:
-								valueStr = strconv.FormatBool(typedValue)
-							}
-						}
-						record = append(record, valueStr)
-					}
-					err = writer.Write(record)
-					if err != nil {
-						slog.Error("failed to write to export file", slog.String("error", err.Error()))
-						return err
-					}
-					return nil
-				},
-			); err != nil {
-				slog.Error("could not iterate on response data", slog.String("error", err.Error()))
-			}
 		} else if req.Format == rdb.FILE_TYPE_JSON {
 			_, err = file.WriteString("{\"participantInfos\": [")
 			if err != nil {
@@ -1503,6 +2102,7 @@ func (h *HttpEndpoints) startParticipantInfosDownload(c *gin.Context) {
 
 			if err := h.recruitmentListDBConn.IterateParticipantsByRecruitmentListID(
 				recruitmentListID,
+				queryFilter,
 				func(participant *rdb.Participant) error {
 					if counter > 0 {
 						_, err = file.WriteString(",")
@@ -1537,11 +2137,62 @@ func (h *HttpEndpoints) startParticipantInfosDownload(c *gin.Context) {
 					slog.Error("failed to write footer", slog.String("error", err.Error()))
 				}
 			}
-		}
+		} else if req.Format == rdb.FILE_TYPE_XLSX {
+			rlInfos, err := h.recruitmentListDBConn.GetRecruitmentListByID(recruitmentListID)
+			if err != nil {
+				slog.Error("could not get recruitment list", slog.String("error", err.Error()))
+				if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DOWNLOAD_STATUS_ERROR); err != nil {
+					slog.Error("could not update download status", slog.String("error", err.Error()))
+				}
+				return
+			}
+
+			headers := []string{"Participant ID", "Recruitment Status", "Imported At", "Deleted At"}
+			for _, infoDef := range rlInfos.ParticipantData.ParticipantInfos {
+				headers = append(headers, infoDef.Label)
+			}
+			xlsx, err := newXLSXExport(headers)
+			if err != nil {
+				slog.Error("failed to create xlsx export", slog.String("error", err.Error()))
+				if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DOWNLOAD_STATUS_ERROR); err != nil {
+					slog.Error("could not update download status", slog.String("error", err.Error()))
+				}
+				return
+			}
+
+			if err := h.recruitmentListDBConn.IterateParticipantsByRecruitmentListID(
+				recruitmentListID,
+				queryFilter,
+				func(participant *rdb.Participant) error {
+					row := []any{participant.ParticipantID, participant.RecruitmentStatus, participant.IncludedAt, participant.DeletedAt}
+					for _, infoDef := range rlInfos.ParticipantData.ParticipantInfos {
+						row = append(row, participant.Infos[infoDef.Label])
+					}
+					if err := xlsx.WriteRow(row); err != nil {
+						slog.Error("failed to write to export file", slog.String("error", err.Error()))
+						return err
+					}
+					return nil
+				},
+			); err != nil {
+				slog.Error("could not iterate on participants", slog.String("error", err.Error()))
+				xlsx.Close()
+				if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DOWNLOAD_STATUS_ERROR); err != nil {
+					slog.Error("could not update download status", slog.String("error", err.Error()))
+				}
+				return
+			}
 
-		if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DONWLOAD_STATUS_AVAILABLE); err != nil {
-			slog.Error("could not update download status", slog.String("error", err.Error()))
+			if err := xlsx.Save(file, xlsxExportMetadata("Participant infos", downloadInfo, xlsx.Rows())); err != nil {
+				slog.Error("failed to write xlsx export", slog.String("error", err.Error()))
+				if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DOWNLOAD_STATUS_ERROR); err != nil {
+					slog.Error("could not update download status", slog.String("error", err.Error()))
+				}
+				return
+			}
 		}
+
+		h.closeDownloadFile(file, downloadInfo.ID.Hex())
 	}()
 
 	c.JSON(http.StatusOK, downloadInfo)
@@ -1595,19 +2246,56 @@ func (h *HttpEndpoints) serveDownloadFile(c *gin.Context) {
 		return
 	}
 
-	fullpath := h.getFullFilePath(download.Path)
-
-	// Check if file exists
-	if _, err := os.Stat(fullpath); os.IsNotExist(err) {
-		slog.Error("file does not exist", slog.String("path", fullpath))
+	file, size, err := h.openDownloadFile(download)
+	if os.IsNotExist(err) {
+		slog.Error("file does not exist", slog.String("path", download.Path))
 		c.JSON(http.StatusNotFound, gin.H{"error": "file does not exist"})
 		return
+	} else if err != nil {
+		slog.Error("could not open download file", slog.String("path", download.Path), slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not open download file"})
+		return
 	}
+	defer file.Close()
 
-	// Return file from file system
-	c.Header("Content-Disposition", "attachment; filename="+download.FileName)
-	c.Header("Content-Type", download.FileType)
-	c.File(fullpath)
+	contentType := downloadContentType(download.FileType)
+	if download.Encryption != nil {
+		switch download.Encryption.Method {
+		case rdb.DOWNLOAD_ENCRYPTION_PASSWORD:
+			contentType = "application/zip"
+		case rdb.DOWNLOAD_ENCRYPTION_PUBLIC_KEY:
+			contentType = "application/octet-stream"
+		}
+	}
+
+	// Return file from file system, decrypted if encrypted at rest
+	c.DataFromReader(http.StatusOK, size, contentType, file, map[string]string{
+		"Content-Disposition": "attachment; filename=" + download.FileName,
+	})
+}
+
+func downloadFileExtension(fileType string) string {
+	if fileType == rdb.FILE_TYPE_CSV_CODEBOOK {
+		return ".zip"
+	}
+	return "." + fileType
+}
+
+func downloadContentType(fileType string) string {
+	switch fileType {
+	case rdb.FILE_TYPE_CSV:
+		return "text/csv"
+	case rdb.FILE_TYPE_JSON:
+		return "application/json"
+	case rdb.FILE_TYPE_XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case rdb.FILE_TYPE_SAV:
+		return "application/x-spss-sav"
+	case rdb.FILE_TYPE_CSV_CODEBOOK, rdb.FILE_TYPE_ZIP:
+		return "application/zip"
+	default:
+		return fileType
+	}
 }
 
 func (h *HttpEndpoints) deleteDownload(c *gin.Context) {
@@ -1684,6 +2372,22 @@ func (h *HttpEndpoints) deleteRecruitmentList(c *gin.Context) {
 		slog.Error("could not delete participant notes", slog.String("error", err.Error()))
 	}
 
+	if err := h.recruitmentListDBConn.DeleteParticipantInfoChangesByRecruitmentListID(recruitmentListID); err != nil {
+		slog.Error("could not delete participant info changes", slog.String("error", err.Error()))
+	}
+
+	if err := h.recruitmentListDBConn.DeleteParticipantStatusChangesByRecruitmentListID(recruitmentListID); err != nil {
+		slog.Error("could not delete participant status changes", slog.String("error", err.Error()))
+	}
+
+	if err := h.recruitmentListDBConn.DeleteParticipantViewsByRecruitmentListID(recruitmentListID); err != nil {
+		slog.Error("could not delete participant views", slog.String("error", err.Error()))
+	}
+
+	if err := h.recruitmentListDBConn.RemoveFromExcludeIfInLists(recruitmentListID); err != nil {
+		slog.Error("could not remove list from excluding lists", slog.String("error", err.Error()))
+	}
+
 	downloads, err := h.recruitmentListDBConn.GetDownloadsForRecruitmentList(recruitmentListID)
 	if err == nil {
 		for _, download := range downloads {
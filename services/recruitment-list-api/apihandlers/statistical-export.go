@@ -0,0 +1,408 @@
+package apihandlers
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	rdb "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+	"github.com/case-framework/recruitment-list-backend/pkg/spss"
+	"github.com/case-framework/recruitment-list-backend/pkg/sync"
+)
+
+const (
+	responseVariableCategorical = "categorical"
+	responseVariableNumeric     = "numeric"
+	responseVariableDatetime    = "datetime"
+	responseVariableText        = "text"
+)
+
+var (
+	responseExportFirstCols = []string{"ID", "participantID", "submitted"}
+	// unix timestamps set by the response parser
+	responseTimestampCols = []string{"opened", "submitted", "arrived"}
+
+	numberPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+)
+
+// responseVariable is a response column with the type and labels used by the statistical exports
+type responseVariable struct {
+	Name     string
+	Label    string
+	Type     string
+	Decimals int
+	// byte length of the longest value of text variables
+	Width int
+	// values of categorical variables in code order, codes start at 1 unless all values are numbers
+	Values []sync.ResponseValueLabel
+	codes  map[string]float64
+}
+
+type responseColumnStats struct {
+	categorical bool
+	nonNumeric  bool
+	decimals    int
+	maxLength   int
+	values      map[string]struct{}
+}
+
+func responseValueString(value any) string {
+	switch typedValue := value.(type) {
+	case string:
+		return typedValue
+	case float64:
+		return strconv.FormatFloat(typedValue, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(typedValue, 10)
+	case bool:
+		return strconv.FormatBool(typedValue)
+	}
+	return ""
+}
+
+// writeResponsesCSV writes the matching responses with the first columns followed by otherHeaders and returns the number of rows.
+// If includesParticipant is not nil, only the responses of the participants it accepts are written.
+func (h *HttpEndpoints) writeResponsesCSV(w io.Writer, filter bson.M, otherHeaders []string, includesParticipant func(participantID string) bool) (int, error) {
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	if err := writer.Write(slices.Concat(responseExportFirstCols, otherHeaders)); err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	if err := h.recruitmentListDBConn.IterateOnResponseData(
+		filter,
+		func(responseData *rdb.ResponseData) error {
+			if includesParticipant != nil && !includesParticipant(responseData.ParticipantID) {
+				return nil
+			}
+			record := []string{}
+			record = append(record, responseData.ResponseID)
+			record = append(record, responseData.ParticipantID)
+			record = append(record, strconv.FormatInt(responseData.Response["submitted"].(int64), 10))
+
+			for _, key := range otherHeaders {
+				record = append(record, responseValueString(responseData.Response[key]))
+			}
+			err := writer.Write(record)
+			if err != nil {
+				slog.Error("failed to write to export file", slog.String("error", err.Error()))
+				return err
+			}
+			rows++
+			return nil
+		},
+	); err != nil {
+		slog.Error("could not iterate on response data", slog.String("error", err.Error()))
+		return rows, err
+	}
+	return rows, nil
+}
+
+// writeLabelledResponses writes the matching responses as sav or csv-codebook export with the labels of the survey definition
+func (h *HttpEndpoints) writeLabelledResponses(w io.Writer, format string, recruitmentListID string, surveyKey string, lang string, filter bson.M) error {
+	labels, err := h.getResponseLabels(recruitmentListID, surveyKey, lang)
+	if err != nil {
+		return err
+	}
+	variables, err := h.getResponseVariables(filter, labels)
+	if err != nil {
+		return err
+	}
+	if format == rdb.FILE_TYPE_SAV {
+		return h.writeResponsesSAV(w, filter, variables, "Responses "+surveyKey)
+	}
+	return h.writeResponsesCodebookBundle(w, filter, variables, "responses_"+surveyKey+".csv")
+}
+
+// getResponseLabels loads the labels of the survey's response columns, with the excluded columns of the list's research data
+func (h *HttpEndpoints) getResponseLabels(recruitmentListID string, surveyKey string, lang string) (*sync.ResponseLabels, error) {
+	recruitmentList, err := h.recruitmentListDBConn.GetRecruitmentListByID(recruitmentListID)
+	if err != nil {
+		return nil, err
+	}
+
+	var excludedCols []string
+	for _, respDef := range recruitmentList.ParticipantData.ResearchData {
+		if respDef.SurveyKey == surveyKey {
+			excludedCols = respDef.ExcludedColumns
+			break
+		}
+	}
+
+	return sync.GetResponseLabels(
+		h.studyDBConn,
+		h.studyServiceConf.InstanceID,
+		recruitmentList.ParticipantInclusion.StudyKey,
+		surveyKey,
+		excludedCols,
+		lang,
+	)
+}
+
+// getResponseVariables goes through the matching responses once to find the columns and their types
+func (h *HttpEndpoints) getResponseVariables(filter bson.M, labels *sync.ResponseLabels) ([]responseVariable, error) {
+	stats := map[string]*responseColumnStats{}
+	if err := h.recruitmentListDBConn.IterateOnResponseData(
+		filter,
+		func(responseData *rdb.ResponseData) error {
+			for key, value := range responseData.Response {
+				colStats, ok := stats[key]
+				if !ok {
+					colStats = &responseColumnStats{
+						categorical: len(labels.Column(key).ValueLabels) > 0,
+						values:      map[string]struct{}{},
+					}
+					stats[key] = colStats
+				}
+
+				valueStr := responseValueString(value)
+				if valueStr == "" {
+					continue
+				}
+				colStats.maxLength = max(colStats.maxLength, len(valueStr))
+				if !numberPattern.MatchString(valueStr) {
+					colStats.nonNumeric = true
+				} else if dot := strings.IndexByte(valueStr, '.'); dot >= 0 && !strings.ContainsAny(valueStr, "eE") {
+					colStats.decimals = max(colStats.decimals, len(valueStr)-dot-1)
+				}
+				if colStats.categorical {
+					colStats.values[valueStr] = struct{}{}
+				}
+			}
+			return nil
+		},
+	); err != nil {
+		return nil, err
+	}
+
+	otherHeaders := []string{}
+	for key := range stats {
+		if !slices.Contains(responseExportFirstCols, key) {
+			otherHeaders = append(otherHeaders, key)
+		}
+	}
+	sort.Slice(otherHeaders, func(i, j int) bool {
+		return strings.ToLower(otherHeaders[i]) < strings.ToLower(otherHeaders[j])
+	})
+
+	variables := []responseVariable{}
+	for _, key := range slices.Concat(responseExportFirstCols, otherHeaders) {
+		colStats, ok := stats[key]
+		if !ok {
+			colStats = &responseColumnStats{values: map[string]struct{}{}}
+		}
+		variables = append(variables, newResponseVariable(key, labels.Column(key), colStats))
+	}
+	return variables, nil
+}
+
+func newResponseVariable(name string, label sync.ResponseColumnLabel, stats *responseColumnStats) responseVariable {
+	v := responseVariable{
+		Name:  name,
+		Label: label.Label,
+	}
+	switch {
+	case len(label.ValueLabels) > 0:
+		v.Type = responseVariableCategorical
+		v.Values = slices.Clone(label.ValueLabels)
+		// values that are not in the current survey definition, e.g. of removed options
+		others := []string{}
+		for value := range stats.values {
+			if !slices.ContainsFunc(v.Values, func(l sync.ResponseValueLabel) bool { return l.Value == value }) {
+				others = append(others, value)
+			}
+		}
+		slices.Sort(others)
+		for _, value := range others {
+			v.Values = append(v.Values, sync.ResponseValueLabel{Value: value, Label: value})
+		}
+
+		v.codes = map[string]float64{}
+		numericValues := !slices.ContainsFunc(v.Values, func(l sync.ResponseValueLabel) bool { return !numberPattern.MatchString(l.Value) })
+		for i, valueLabel := range v.Values {
+			code := float64(i + 1)
+			if numericValues {
+				code, _ = strconv.ParseFloat(valueLabel.Value, 64)
+			}
+			if _, ok := v.codes[valueLabel.Value]; !ok {
+				v.codes[valueLabel.Value] = code
+			}
+		}
+	case slices.Contains(responseTimestampCols, name) && !stats.nonNumeric:
+		v.Type = responseVariableDatetime
+	case !stats.nonNumeric && stats.maxLength > 0:
+		v.Type = responseVariableNumeric
+		v.Decimals = min(stats.decimals, 16)
+	default:
+		v.Type = responseVariableText
+		v.Width = stats.maxLength
+	}
+	return v
+}
+
+func (v responseVariable) code(value string) (float64, bool) {
+	code, ok := v.codes[value]
+	return code, ok
+}
+
+// writeResponsesSAV writes the matching responses as SPSS system file, categorical values are coded with value labels
+func (h *HttpEndpoints) writeResponsesSAV(w io.Writer, filter bson.M, variables []responseVariable, fileLabel string) error {
+	spssVars := make([]spss.Variable, len(variables))
+	for i, v := range variables {
+		spssVars[i] = spss.Variable{Name: v.Name, Label: v.Label, Decimals: v.Decimals}
+		switch v.Type {
+		case responseVariableCategorical:
+			for _, valueLabel := range v.Values {
+				code, _ := v.code(valueLabel.Value)
+				spssVars[i].ValueLabels = append(spssVars[i].ValueLabels, spss.ValueLabel{Value: code, Label: valueLabel.Label})
+			}
+		case responseVariableDatetime:
+			spssVars[i].Format = spss.FORMAT_DATETIME
+		case responseVariableText:
+			spssVars[i].Width = min(max(v.Width, 1), spss.MaxStringWidth)
+		}
+	}
+
+	writer, err := spss.NewWriter(w, spssVars, fileLabel, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := h.recruitmentListDBConn.IterateOnResponseData(
+		filter,
+		func(responseData *rdb.ResponseData) error {
+			values := make([]any, len(variables))
+			for i, v := range variables {
+				valueStr := responseValueString(responseData.Response[v.Name])
+				if valueStr == "" {
+					continue
+				}
+				switch v.Type {
+				case responseVariableCategorical:
+					if code, ok := v.code(valueStr); ok {
+						values[i] = code
+					}
+				case responseVariableDatetime:
+					if ts, err := strconv.ParseInt(valueStr, 10, 64); err == nil && ts > 0 {
+						values[i] = time.Unix(ts, 0)
+					}
+				case responseVariableNumeric:
+					if f, err := strconv.ParseFloat(valueStr, 64); err == nil {
+						values[i] = f
+					}
+				default:
+					values[i] = valueStr
+				}
+			}
+			if err := writer.WriteCase(values); err != nil {
+				slog.Error("failed to write to export file", slog.String("error", err.Error()))
+				return err
+			}
+			return nil
+		},
+	); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// writeResponsesCodebookBundle writes a ZIP with the responses as CSV, a codebook and an R script that imports the CSV with labels
+func (h *HttpEndpoints) writeResponsesCodebookBundle(w io.Writer, filter bson.M, variables []responseVariable, csvName string) error {
+	zipWriter := zip.NewWriter(w)
+
+	otherHeaders := []string{}
+	for _, v := range variables[len(responseExportFirstCols):] {
+		otherHeaders = append(otherHeaders, v.Name)
+	}
+	csvFile, err := zipWriter.Create(csvName)
+	if err != nil {
+		return err
+	}
+	if _, err := h.writeResponsesCSV(csvFile, filter, otherHeaders, nil); err != nil {
+		return err
+	}
+
+	codebookFile, err := zipWriter.Create("codebook.csv")
+	if err != nil {
+		return err
+	}
+	if err := writeResponseCodebook(codebookFile, variables); err != nil {
+		return err
+	}
+
+	scriptFile, err := zipWriter.Create("import.R")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(scriptFile, responsesRScript(variables, csvName)); err != nil {
+		return err
+	}
+
+	return zipWriter.Close()
+}
+
+// writeResponseCodebook writes one row per variable, followed by one row per value of categorical variables
+func writeResponseCodebook(w io.Writer, variables []responseVariable) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"variable", "label", "type", "value", "code", "value label"}); err != nil {
+		return err
+	}
+	for _, v := range variables {
+		if err := writer.Write([]string{v.Name, v.Label, v.Type, "", "", ""}); err != nil {
+			return err
+		}
+		for _, valueLabel := range v.Values {
+			code, _ := v.code(valueLabel.Value)
+			if err := writer.Write([]string{v.Name, "", "", valueLabel.Value, strconv.FormatFloat(code, 'f', -1, 64), valueLabel.Label}); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func responsesRScript(variables []responseVariable, csvName string) string {
+	var b strings.Builder
+	b.WriteString("# Imports the responses with variable and value labels, run in the folder of the extracted files.\n")
+	b.WriteString("# Variable labels are stored in the \"label\" attribute of the columns.\n\n")
+	fmt.Fprintf(&b, "responses <- read.csv(%s, colClasses = \"character\", check.names = FALSE, na.strings = \"\", encoding = \"UTF-8\")\n\n", rString(csvName))
+
+	for _, v := range variables {
+		col := "responses[[" + rString(v.Name) + "]]"
+		switch v.Type {
+		case responseVariableCategorical:
+			values := make([]string, len(v.Values))
+			labels := make([]string, len(v.Values))
+			for i, valueLabel := range v.Values {
+				values[i] = rString(valueLabel.Value)
+				labels[i] = rString(valueLabel.Label)
+			}
+			fmt.Fprintf(&b, "%s <- factor(%s, levels = c(%s), labels = c(%s))\n", col, col, strings.Join(values, ", "), strings.Join(labels, ", "))
+		case responseVariableNumeric:
+			fmt.Fprintf(&b, "%s <- as.numeric(%s)\n", col, col)
+		case responseVariableDatetime:
+			fmt.Fprintf(&b, "%s <- as.POSIXct(as.numeric(%s), origin = \"1970-01-01\", tz = \"UTC\")\n", col, col)
+		}
+		if v.Label != "" {
+			fmt.Fprintf(&b, "attr(%s, \"label\") <- %s\n", col, rString(v.Label))
+		}
+	}
+	return b.String()
+}
+
+func rString(s string) string {
+	return strconv.Quote(s)
+}
@@ -23,6 +23,12 @@ func (h *HttpEndpoints) AddResearcherUserManagementAPI(rg *gin.RouterGroup) {
 		h.getRenewTokenForSession)
 
 	authGroup.GET("/permissions", mw.GetAndValidateManagementUserJWT(h.tokenSignKey), h.getMyPermissions)
+	authGroup.GET("/encryption-key", mw.GetAndValidateManagementUserJWT(h.tokenSignKey), h.getMyEncryptionKey)
+	authGroup.PUT("/encryption-key",
+		mw.RequirePayload(),
+		mw.GetAndValidateManagementUserJWT(h.tokenSignKey),
+		h.updateMyEncryptionKey)
+	authGroup.DELETE("/encryption-key", mw.GetAndValidateManagementUserJWT(h.tokenSignKey), h.deleteMyEncryptionKey)
 
 	researcherUsersGroup := rg.Group("/researchers")
 	researcherUsersGroup.Use(mw.GetAndValidateManagementUserJWT(h.tokenSignKey))
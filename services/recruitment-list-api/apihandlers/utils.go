@@ -9,7 +9,9 @@ import (
 
 	jwthandling "github.com/case-framework/case-backend/pkg/jwt-handling"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
 
+	rdb "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
 	pc "github.com/case-framework/recruitment-list-backend/pkg/permission-checker"
 )
 
@@ -83,6 +85,47 @@ func (h *HttpEndpoints) middlewareHasPermissionForRL(
 	}
 }
 
+// getParticipantLimiterFilter returns the filter for the participants the user can see in the list
+// based on the limiters of their permissions, or nil if not limited
+func (h *HttpEndpoints) getParticipantLimiterFilter(token *jwthandling.ManagementUserClaims, recruitmentListID string) (bson.M, error) {
+	if token.IsAdmin {
+		return nil, nil
+	}
+	permissions, err := h.recruitmentListDBConn.GetSpecificPermissionsByUserID(
+		token.Subject,
+		[]string{
+			pc.ACTION_ACCESS_RECRUITMENT_LIST,
+			pc.ACTION_MANAGE_RECRUITMENT_LIST,
+			pc.ACTION_DELETE_RECRUITMENT_LIST,
+		},
+		[]string{recruitmentListID},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return rdb.ParticipantFilterForPermissions(permissions, h.limiterValueConverter(recruitmentListID))
+}
+
+// limiterValueConverter converts limiter values of participant infos to the value type of the info, like in participant queries.
+// The list is only loaded if there are limiter values.
+func (h *HttpEndpoints) limiterValueConverter(recruitmentListID string) func(field string, value string) (any, error) {
+	var defsByLabel map[string]rdb.ParticipantInfo
+	return func(field string, value string) (any, error) {
+		label, ok := strings.CutPrefix(field, "infos.")
+		if !ok {
+			return value, nil
+		}
+		if defsByLabel == nil {
+			recruitmentList, err := h.recruitmentListDBConn.GetRecruitmentListByID(recruitmentListID)
+			if err != nil {
+				return nil, err
+			}
+			defsByLabel = participantInfosByLabel(recruitmentList)
+		}
+		return convertInfoQueryValue(defsByLabel, label, value)
+	}
+}
+
 func (h *HttpEndpoints) getFullFilePath(path string) string {
 	return filepath.Join(h.filestorePath, path)
 }
@@ -0,0 +1,437 @@
+package apihandlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	jwthandling "github.com/case-framework/case-backend/pkg/jwt-handling"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	rdb "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+)
+
+const (
+	wideModeFirst  = "first"
+	wideModeLatest = "latest"
+	wideModeAll    = "all"
+)
+
+// per response columns of the wide export, before the other response columns
+var wideResponseFirstCols = []string{"ID", "submitted"}
+
+type StartWideDownloadRequest struct {
+	Format    string                `json:"format"`
+	Surveys   []WideExportSurvey    `json:"surveys"`
+	StartDate *time.Time            `json:"startDate"`
+	EndDate   *time.Time            `json:"endDate"`
+	Filter    *rdb.ParticipantQuery `json:"filter,omitempty"`
+	// encrypts the file for the requester
+	Encryption *DownloadEncryptionRequest `json:"encryption,omitempty"`
+}
+
+type WideExportSurvey struct {
+	SurveyKey string `json:"surveyKey"`
+	// first, latest (default) or all responses of the participant
+	Mode string `json:"mode"`
+	// prefix of the survey's columns, the survey key if empty
+	Prefix string `json:"prefix"`
+	// with mode all, only the first responses up to this number, all if 0
+	MaxResponses int `json:"maxResponses"`
+}
+
+// wideSurveyColumns are the columns of one survey in the wide export
+type wideSurveyColumns struct {
+	WideExportSurvey
+	// response keys in column order
+	keys []string
+	// number of response column groups, 1 for first and latest
+	slots int
+}
+
+func (h *HttpEndpoints) startWideDownload(c *gin.Context) {
+	token := c.MustGet("validatedToken").(*jwthandling.ManagementUserClaims)
+
+	recruitmentListID := c.Param("id")
+	if recruitmentListID == "" {
+		slog.Warn("no recruitmentListID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recruitmentListID"})
+		return
+	}
+
+	var req StartWideDownloadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("failed to bind request", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch req.Format {
+	case rdb.FILE_TYPE_XLSX:
+	default:
+		req.Format = rdb.FILE_TYPE_CSV
+	}
+
+	slog.Info("start wide download", slog.String("userID", token.Subject), slog.String("recruitmentListID", recruitmentListID), slog.String("format", req.Format))
+
+	recruitmentList, err := h.recruitmentListDBConn.GetRecruitmentListByID(recruitmentListID)
+	if err != nil {
+		slog.Error("could not get recruitment list", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get recruitment list"})
+		return
+	}
+
+	if err := validateWideExportSurveys(recruitmentList, req.Surveys); err != nil {
+		slog.Warn("invalid wide export surveys", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	surveyInfos := make([]string, len(req.Surveys))
+	for i, survey := range req.Surveys {
+		surveyInfos[i] = survey.SurveyKey + " (" + survey.Mode + ")"
+	}
+	filterInfo := "Wide: " + strings.Join(surveyInfos, ", ") + " "
+	if req.StartDate != nil {
+		filterInfo += "from " + req.StartDate.Format("2006-01-02") + " "
+	}
+	if req.EndDate != nil {
+		filterInfo += "to " + req.EndDate.Format("2006-01-02") + " "
+	}
+
+	var queryFilter bson.M
+	if req.Filter != nil {
+		queryFilter, err = h.participantQueryFilter(recruitmentList, req.Filter)
+		if err != nil {
+			slog.Error("invalid participant query", slog.String("error", err.Error()))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filter: " + err.Error()})
+			return
+		}
+		filterInfo += "for filtered participants "
+	}
+
+	encryption, err := h.getDownloadEncryption(token.Subject, req.Encryption)
+	if err != nil {
+		slog.Warn("invalid download encryption", slog.String("userID", token.Subject), slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := "wide_" + time.Now().Format("2006-01-02-15-04-05") + "." + req.Format
+	exportFolder := ""
+	downloadFileName := encryptedFileName(filename, encryption)
+	path := filepath.Join(exportFolder, downloadFileName)
+
+	downloadInfo, err := h.recruitmentListDBConn.CreateDownload(
+		recruitmentListID,
+		strings.TrimSpace(filterInfo),
+		req.Format,
+		downloadFileName,
+		path,
+		token.Subject,
+		h.downloadEncryptionInfo(encryption),
+	)
+	if err != nil {
+		slog.Error("could not create download", slog.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create download"})
+		return
+	}
+
+	go func() {
+		file, err := h.createDownloadFile(path, filename, encryption)
+		if err != nil {
+			slog.Error("could not create file", slog.String("file path", path), slog.String("error", err.Error()))
+			if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DOWNLOAD_STATUS_ERROR); err != nil {
+				slog.Error("could not update download status", slog.String("error", err.Error()))
+			}
+			return
+		}
+		defer file.Close()
+
+		if err := h.writeWideExport(file, req, recruitmentList, queryFilter, downloadInfo); err != nil {
+			slog.Error("failed to write wide export", slog.String("recruitmentListID", recruitmentListID), slog.String("error", err.Error()))
+			if err := h.recruitmentListDBConn.UpdateDownloadStatus(downloadInfo.ID.Hex(), rdb.DOWNLOAD_STATUS_ERROR); err != nil {
+				slog.Error("could not update download status", slog.String("error", err.Error()))
+			}
+			return
+		}
+
+		h.closeDownloadFile(file, downloadInfo.ID.Hex())
+	}()
+
+	c.JSON(http.StatusOK, downloadInfo)
+}
+
+// validateWideExportSurveys checks the surveys are part of the research data and sets the default mode
+func validateWideExportSurveys(recruitmentList *rdb.RecruitmentList, surveys []WideExportSurvey) error {
+	if len(surveys) == 0 {
+		return errors.New("no surveys selected")
+	}
+
+	prefixes := map[string]bool{}
+	for i := range surveys {
+		survey := &surveys[i]
+		found := false
+		for _, respDef := range recruitmentList.ParticipantData.ResearchData {
+			if respDef.SurveyKey == survey.SurveyKey {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("survey is not part of the research data: " + survey.SurveyKey)
+		}
+
+		switch survey.Mode {
+		case "":
+			survey.Mode = wideModeLatest
+		case wideModeFirst, wideModeLatest, wideModeAll:
+		default:
+			return errors.New("invalid mode for survey " + survey.SurveyKey + ": " + survey.Mode)
+		}
+		if survey.MaxResponses < 0 {
+			return errors.New("invalid maxResponses for survey " + survey.SurveyKey)
+		}
+
+		if survey.Prefix == "" {
+			survey.Prefix = survey.SurveyKey
+		}
+		if prefixes[survey.Prefix] {
+			return errors.New("duplicate column prefix: " + survey.Prefix)
+		}
+		prefixes[survey.Prefix] = true
+	}
+	return nil
+}
+
+// writeWideExport writes one row per participant with the participant infos followed by the response columns of each survey.
+// Participants and their responses are streamed twice, first to find the columns and then to write the rows.
+func (h *HttpEndpoints) writeWideExport(w io.Writer, req StartWideDownloadRequest, recruitmentList *rdb.RecruitmentList, queryFilter bson.M, downloadInfo *rdb.Download) error {
+	recruitmentListID := recruitmentList.ID.Hex()
+
+	surveyKeys := make([]string, len(req.Surveys))
+	for i, survey := range req.Surveys {
+		surveyKeys[i] = survey.SurveyKey
+	}
+	responseFilter := bson.M{"surveyKey": bson.M{"$in": surveyKeys}}
+	arrivedAt := bson.M{}
+	if req.StartDate != nil {
+		arrivedAt["$gte"] = req.StartDate.Unix()
+	}
+	if req.EndDate != nil {
+		arrivedAt["$lte"] = req.EndDate.Unix()
+	}
+	if len(arrivedAt) > 0 {
+		responseFilter["arrivedAt"] = arrivedAt
+	}
+
+	surveys, err := h.getWideSurveyColumns(recruitmentListID, req.Surveys, queryFilter, responseFilter)
+	if err != nil {
+		return err
+	}
+
+	headers := []string{"Participant ID", "Recruitment Status", "Imported At", "Deleted At"}
+	for _, infoDef := range recruitmentList.ParticipantData.ParticipantInfos {
+		headers = append(headers, infoDef.Label)
+	}
+	for _, survey := range surveys {
+		headers = append(headers, survey.Prefix+".responseCount")
+		for slot := 1; slot <= survey.slots; slot++ {
+			prefix := survey.Prefix + "."
+			if survey.Mode == wideModeAll {
+				prefix += strconv.Itoa(slot) + "."
+			}
+			for _, key := range survey.keys {
+				headers = append(headers, prefix+key)
+			}
+		}
+	}
+
+	var writeRow func(row []any) error
+	var xlsx *xlsxExport
+	var csvWriter *csv.Writer
+	if req.Format == rdb.FILE_TYPE_XLSX {
+		var err error
+		xlsx, err = newXLSXExport(headers)
+		if err != nil {
+			return err
+		}
+		defer xlsx.Close()
+		writeRow = xlsx.WriteRow
+	} else {
+		csvWriter = csv.NewWriter(w)
+		if err := csvWriter.Write(headers); err != nil {
+			return err
+		}
+		writeRow = func(row []any) error {
+			record := make([]string, len(row))
+			for i, value := range row {
+				record[i] = exportValueString(value)
+			}
+			return csvWriter.Write(record)
+		}
+	}
+
+	if err := h.recruitmentListDBConn.IterateParticipantsWithResponses(
+		recruitmentListID,
+		queryFilter,
+		responseFilter,
+		func(participant *rdb.Participant, responses []rdb.ResponseData) error {
+			row := []any{participant.ParticipantID, participant.RecruitmentStatus, participant.IncludedAt, participant.DeletedAt}
+			for _, infoDef := range recruitmentList.ParticipantData.ParticipantInfos {
+				row = append(row, participant.Infos[infoDef.Label])
+			}
+			for _, survey := range surveys {
+				surveyResponses := responsesOfSurvey(responses, survey.SurveyKey)
+				row = append(row, len(surveyResponses))
+
+				selected := surveyResponses
+				switch survey.Mode {
+				case wideModeFirst:
+					selected = surveyResponses[:min(len(surveyResponses), 1)]
+				case wideModeLatest:
+					selected = surveyResponses[max(len(surveyResponses)-1, 0):]
+				}
+				for slot := 0; slot < survey.slots; slot++ {
+					var response *rdb.ResponseData
+					if slot < len(selected) {
+						response = &selected[slot]
+					}
+					for _, key := range survey.keys {
+						row = append(row, wideResponseValue(response, key, xlsx != nil))
+					}
+				}
+			}
+			return writeRow(row)
+		},
+	); err != nil {
+		return err
+	}
+
+	if xlsx != nil {
+		return xlsx.Save(w, xlsxExportMetadata("Participants with responses", downloadInfo, xlsx.Rows()))
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// getWideSurveyColumns finds the response keys of each survey and, for mode all, the number of column groups
+func (h *HttpEndpoints) getWideSurveyColumns(recruitmentListID string, surveys []WideExportSurvey, queryFilter bson.M, responseFilter bson.M) ([]*wideSurveyColumns, error) {
+	keySets := make([]map[string]bool, len(surveys))
+	maxResponses := make([]int, len(surveys))
+	for i := range surveys {
+		keySets[i] = map[string]bool{}
+	}
+	if err := h.recruitmentListDBConn.IterateParticipantsWithResponses(
+		recruitmentListID,
+		queryFilter,
+		responseFilter,
+		func(participant *rdb.Participant, responses []rdb.ResponseData) error {
+			for i, survey := range surveys {
+				surveyResponses := responsesOfSurvey(responses, survey.SurveyKey)
+				for _, responseData := range surveyResponses {
+					for key := range responseData.Response {
+						if key != "participantID" && !slices.Contains(wideResponseFirstCols, key) {
+							keySets[i][key] = true
+						}
+					}
+				}
+				maxResponses[i] = max(maxResponses[i], len(surveyResponses))
+			}
+			return nil
+		},
+	); err != nil {
+		return nil, err
+	}
+
+	columns := make([]*wideSurveyColumns, len(surveys))
+	for i, survey := range surveys {
+		otherKeys := make([]string, 0, len(keySets[i]))
+		for key := range keySets[i] {
+			otherKeys = append(otherKeys, key)
+		}
+		slices.SortFunc(otherKeys, func(a, b string) int {
+			return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+		})
+
+		slots := 1
+		if survey.Mode == wideModeAll {
+			slots = maxResponses[i]
+			if survey.MaxResponses > 0 {
+				slots = min(slots, survey.MaxResponses)
+			}
+		}
+
+		columns[i] = &wideSurveyColumns{
+			WideExportSurvey: survey,
+			keys:             slices.Concat(wideResponseFirstCols, otherKeys),
+			slots:            slots,
+		}
+	}
+	return columns, nil
+}
+
+// responsesOfSurvey returns the responses of the survey, keeping their order
+func responsesOfSurvey(responses []rdb.ResponseData, surveyKey string) []rdb.ResponseData {
+	surveyResponses := []rdb.ResponseData{}
+	for _, response := range responses {
+		if response.SurveyKey == surveyKey {
+			surveyResponses = append(surveyResponses, response)
+		}
+	}
+	return surveyResponses
+}
+
+// wideResponseValue returns the value of the response column, timestamps as time for xlsx
+func wideResponseValue(response *rdb.ResponseData, key string, asTime bool) any {
+	if response == nil {
+		return nil
+	}
+	if key == "ID" {
+		return response.ResponseID
+	}
+	value := response.Response[key]
+	if timestamp, ok := value.(int64); ok && asTime && slices.Contains(responseTimestampCols, key) {
+		return time.Unix(timestamp, 0)
+	}
+	return value
+}
+
+// exportValueString formats participant infos and response values for CSV exports
+func exportValueString(value any) string {
+	switch typedValue := value.(type) {
+	case nil:
+		return ""
+	case int:
+		return strconv.Itoa(typedValue)
+	case time.Time:
+		if typedValue.IsZero() {
+			return ""
+		}
+		return typedValue.Format(time.RFC3339)
+	case *time.Time:
+		if typedValue == nil {
+			return ""
+		}
+		return exportValueString(*typedValue)
+	case primitive.DateTime:
+		return typedValue.Time().UTC().Format(time.RFC3339)
+	case primitive.A:
+		items := make([]string, len(typedValue))
+		for i, item := range typedValue {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	}
+	return responseValueString(value)
+}
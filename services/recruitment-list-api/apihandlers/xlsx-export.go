@@ -0,0 +1,209 @@
+package apihandlers
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	rdb "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+)
+
+const (
+	xlsxDataSheet     = "Data"
+	xlsxMetadataSheet = "Export info"
+	// excel rejects longer cell texts
+	xlsxMaxCellLength = 32767
+)
+
+// xlsxExport streams rows into the data sheet of a new workbook, the header row is styled and frozen
+type xlsxExport struct {
+	file      *excelize.File
+	sw        *excelize.StreamWriter
+	dateStyle int
+	row       int
+}
+
+func newXLSXExport(headers []string) (*xlsxExport, error) {
+	f := excelize.NewFile()
+	if err := f.SetSheetName("Sheet1", xlsxDataSheet); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	headerStyle, err := f.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true, Color: "FFFFFF"},
+		Fill:      excelize.Fill{Type: "pattern", Color: []string{"4F6D8F"}, Pattern: 1},
+		Alignment: &excelize.Alignment{Vertical: "center"},
+	})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	dateFormat := "yyyy-mm-dd hh:mm:ss"
+	dateStyle, err := f.NewStyle(&excelize.Style{CustomNumFmt: &dateFormat})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	sw, err := f.NewStreamWriter(xlsxDataSheet)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// panes and column widths have to be set before the first row
+	if err := sw.SetPanes(&excelize.Panes{
+		Freeze:      true,
+		YSplit:      1,
+		TopLeftCell: "A2",
+		ActivePane:  "bottomLeft",
+	}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if len(headers) > 0 {
+		if err := sw.SetColWidth(1, len(headers), 20); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	headerCells := make([]interface{}, len(headers))
+	for i, header := range headers {
+		headerCells[i] = excelize.Cell{StyleID: headerStyle, Value: header}
+	}
+	if err := sw.SetRow("A1", headerCells); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &xlsxExport{
+		file:      f,
+		sw:        sw,
+		dateStyle: dateStyle,
+		row:       1,
+	}, nil
+}
+
+// WriteRow appends a row, numbers and dates are written as typed cells
+func (x *xlsxExport) WriteRow(values []any) error {
+	x.row++
+	cells := make([]interface{}, len(values))
+	for i, value := range values {
+		cells[i] = x.cellValue(value)
+	}
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+	return x.sw.SetRow(cell, cells)
+}
+
+// Rows is the number of written rows without the header
+func (x *xlsxExport) Rows() int {
+	return x.row - 1
+}
+
+// Close removes the temporary files of the workbook, for exports that fail before Save
+func (x *xlsxExport) Close() error {
+	return x.file.Close()
+}
+
+// Save adds the metadata sheet with one key-value pair per row and writes the workbook
+func (x *xlsxExport) Save(w io.Writer, metadata [][2]any) error {
+	defer x.file.Close()
+
+	if err := x.sw.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := x.file.NewSheet(xlsxMetadataSheet); err != nil {
+		return err
+	}
+	labelStyle, err := x.file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	for i, entry := range metadata {
+		row := i + 1
+		if err := x.file.SetCellValue(xlsxMetadataSheet, fmt.Sprintf("A%d", row), entry[0]); err != nil {
+			return err
+		}
+		value := x.cellValue(entry[1])
+		if cell, ok := value.(excelize.Cell); ok {
+			value = cell.Value
+			if err := x.file.SetCellStyle(xlsxMetadataSheet, fmt.Sprintf("B%d", row), fmt.Sprintf("B%d", row), cell.StyleID); err != nil {
+				return err
+			}
+		}
+		if err := x.file.SetCellValue(xlsxMetadataSheet, fmt.Sprintf("B%d", row), value); err != nil {
+			return err
+		}
+	}
+	if len(metadata) > 0 {
+		if err := x.file.SetCellStyle(xlsxMetadataSheet, "A1", fmt.Sprintf("A%d", len(metadata)), labelStyle); err != nil {
+			return err
+		}
+	}
+	if err := x.file.SetColWidth(xlsxMetadataSheet, "A", "A", 20); err != nil {
+		return err
+	}
+	if err := x.file.SetColWidth(xlsxMetadataSheet, "B", "B", 60); err != nil {
+		return err
+	}
+
+	_, err = x.file.WriteTo(w)
+	return err
+}
+
+func (x *xlsxExport) cellValue(value any) any {
+	switch typedValue := value.(type) {
+	case nil:
+		return nil
+	case string:
+		if len(typedValue) > xlsxMaxCellLength {
+			runes := []rune(typedValue)
+			if len(runes) > xlsxMaxCellLength {
+				typedValue = string(runes[:xlsxMaxCellLength])
+			}
+		}
+		return typedValue
+	case float64, float32, int, int32, int64, bool:
+		return typedValue
+	case time.Time:
+		if typedValue.IsZero() {
+			return nil
+		}
+		// excel dates have no time zone
+		return excelize.Cell{StyleID: x.dateStyle, Value: typedValue.UTC()}
+	case *time.Time:
+		if typedValue == nil {
+			return nil
+		}
+		return x.cellValue(*typedValue)
+	case primitive.DateTime:
+		return x.cellValue(typedValue.Time())
+	case primitive.A:
+		items := make([]string, len(typedValue))
+		for i, item := range typedValue {
+			items[i] = fmt.Sprint(item)
+		}
+		return x.cellValue(strings.Join(items, ","))
+	default:
+		return x.cellValue(fmt.Sprint(typedValue))
+	}
+}
+
+func xlsxExportMetadata(export string, download *rdb.Download, rows int) [][2]any {
+	return [][2]any{
+		{"Export", export},
+		{"Filters", download.FilterInfo},
+		{"Created by", download.CreatedBy},
+		{"Created at", download.CreatedAt},
+		{"Rows", rows},
+	}
+}
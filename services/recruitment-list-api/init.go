@@ -17,6 +17,8 @@ import (
 	sdb "github.com/case-framework/case-backend/pkg/db/study"
 	dbutils "github.com/case-framework/recruitment-list-backend/pkg/db"
 	rdb "github.com/case-framework/recruitment-list-backend/pkg/db/recruitment-list"
+	"github.com/case-framework/recruitment-list-backend/pkg/filecrypt"
+	"github.com/case-framework/recruitment-list-backend/pkg/sync"
 )
 
 const (
@@ -31,6 +33,8 @@ const (
 	ENV_STUDY_DB_PASSWORD = "STUDY_DB_PASSWORD"
 
 	ENV_STUDY_GLOBAL_SECRET = "STUDY_GLOBAL_SECRET"
+
+	ENV_FILESTORE_ENCRYPTION_KEY = "FILESTORE_ENCRYPTION_KEY"
 )
 
 type RecruitmentListApiConfig struct {
@@ -71,12 +75,18 @@ type RecruitmentListApiConfig struct {
 	} `json:"db_configs" yaml:"db_configs"`
 
 	FilestorePath string `json:"filestore_path" yaml:"filestore_path"`
+	// base64 encoded 32 byte key, download files are stored encrypted if set
+	FilestoreEncryptionKey string `json:"filestore_encryption_key" yaml:"filestore_encryption_key"`
+
+	// should match the sync job's stale_sync_timeout
+	StaleSyncTimeout time.Duration `json:"stale_sync_timeout" yaml:"stale_sync_timeout"`
 }
 
 var (
 	conf                     RecruitmentListApiConfig
 	recruitmentListDBService *rdb.RecruitmentListDBService
 	studyDBService           *sdb.StudyDBService
+	filestoreKey             []byte
 )
 
 func init() {
@@ -117,6 +127,10 @@ func init() {
 	}
 
 	checkRecruitmentListFilestorePath()
+
+	if conf.StaleSyncTimeout <= 0 {
+		conf.StaleSyncTimeout = sync.StaleSyncTimeout
+	}
 }
 
 func initStudyService() {
@@ -152,6 +166,10 @@ func secretsOverride() {
 		conf.StudyServicesConnection.GlobalSecret = studyGlobalSecret
 	}
 
+	if filestoreEncryptionKey := os.Getenv(ENV_FILESTORE_ENCRYPTION_KEY); filestoreEncryptionKey != "" {
+		conf.FilestoreEncryptionKey = filestoreEncryptionKey
+	}
+
 	// Override API keys for external services
 	for i := range conf.StudyServicesConnection.ExternalServices {
 		service := &conf.StudyServicesConnection.ExternalServices[i]
@@ -205,4 +223,15 @@ func checkRecruitmentListFilestorePath() {
 		slog.Error("Filestore path does not exist", slog.String("path", fsPath))
 		panic("Filestore path does not exist")
 	}
+
+	if conf.FilestoreEncryptionKey == "" {
+		slog.Warn("Filestore encryption key not set, download files are stored unencrypted")
+		return
+	}
+	key, err := filecrypt.ParseKey(conf.FilestoreEncryptionKey)
+	if err != nil {
+		slog.Error("Invalid filestore encryption key", slog.String("error", err.Error()))
+		panic("Invalid filestore encryption key")
+	}
+	filestoreKey = key
 }
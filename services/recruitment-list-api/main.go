@@ -33,9 +33,11 @@ func main() {
 		recruitmentListDBService,
 		studyDBService,
 		conf.FilestorePath,
+		filestoreKey,
 		apihandlers.TTLs{
 			AccessToken: conf.UserManagementConfig.ResearcherUserJWTConfig.ExpiresIn,
 		},
+		conf.StaleSyncTimeout,
 		conf.StudyServicesConnection.GlobalSecret,
 		conf.StudyServicesConnection.InstanceID,
 	)